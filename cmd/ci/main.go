@@ -2,14 +2,21 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"github.com/KirillMironov/ci/config"
+	"github.com/KirillMironov/ci/internal/domain"
 	"github.com/KirillMironov/ci/internal/service"
 	"github.com/KirillMironov/ci/internal/storage"
 	"github.com/KirillMironov/ci/internal/transport"
+	"github.com/KirillMironov/ci/pkg/cas"
+	"github.com/KirillMironov/ci/pkg/migrate"
+	"github.com/KirillMironov/ci/pkg/sqltiming"
 	"github.com/docker/docker/client"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"os"
@@ -40,45 +47,144 @@ func main() {
 	}
 	defer cli.Close()
 
-	// SQLite
-	db, err := sqlx.Connect("sqlite3", cfg.SQLite.Path)
+	// Metrics
+	metrics := service.NewMetrics()
+
+	// Database
+	var (
+		dbDriver      driver.Driver = &sqlite3.SQLiteDriver{}
+		dbDriverName                = "sqlite3"
+		dsn                         = cfg.SQLite.Path + "?_foreign_keys=on"
+		migrationsDir               = cfg.SQLite.Migrations
+	)
+	if cfg.Postgres.DSN != "" {
+		dbDriver, dbDriverName, dsn, migrationsDir = &pq.Driver{}, "postgres", cfg.Postgres.DSN, cfg.Postgres.Migrations
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(sqltiming.NewConnector(dbDriver, dsn, metrics.ObserveQuery)), dbDriverName)
+	defer db.Close()
+
+	err = db.Ping()
 	if err != nil {
 		logger.Fatal(err)
 	}
-	defer db.Close()
 
-	_, err = db.Exec(cfg.SQLite.Schema)
+	// Postgres is vacuumed by its autovacuum daemon.
+	var vacuum func(context.Context) error
+	if cfg.Postgres.DSN == "" {
+		vacuum = func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "VACUUM")
+			return err
+		}
+	}
+
+	// Migrations
+	migrations, err := migrate.Load(migrationsDir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	migrator := migrate.New(db.DB, migrations)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(migrator, os.Args[2:], os.Stdout)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	migrated, err := migrator.Up()
+	for _, migration := range migrated {
+		logger.Infof("applied migration %04d_%s", migration.Version, migration.Name)
+	}
 	if err != nil {
 		logger.Fatal(err)
 	}
 
 	// App
 	var (
-		repositoriesStorage = storage.NewRepositories(db)
-		buildsStorage       = storage.NewBuilds(db)
-		logsStorage         = storage.NewLogs(db)
+		repositoriesStorage  = storage.NewRepositories(db)
+		buildsStorage        = storage.NewBuilds(db)
+		logsStorage          = storage.NewLogs(db)
+		schedulesStorage     = storage.NewSchedules(db)
+		notificationsStorage = storage.NewNotifications(db)
+		watchersStorage      = storage.NewWatchers(db)
+		artifactsStorage     = storage.NewArtifacts(db)
+		testsStorage         = storage.NewTests(db)
+		coverageStorage      = storage.NewCoverage(db)
+		tagsStorage          = storage.NewTags(db)
+
+		httpClient    = &http.Client{Timeout: time.Second * 10}
+		bus           = service.NewBus(logger)
+		artifactFiles = cas.New(cfg.ArtifactsDir)
 
 		archiver  = &service.TarArchiver{}
 		parser    = &service.YAMLParser{}
 		cloner    = service.NewCloner(cfg.RepositoriesDir)
-		executor  = service.NewDockerExecutor(cli, cfg.ContainerWorkingDir, archiver)
-		runner    = service.NewRunner(executor, buildsStorage, logger)
-		poller    = service.NewPoller(cfg.CIFilename, cloner, parser, runner, buildsStorage, logger)
-		scheduler = service.NewScheduler(poller, repositoriesStorage, logger)
-
-		handler = transport.NewHandler(cfg.StaticRootDir, scheduler, repositoriesStorage, buildsStorage, logsStorage)
+		stepCache = service.NewStepCache(cfg.Cache.Dir, cfg.Cache.MaxSize, cfg.Cache.MaxEntrySize)
+		executor  = service.NewDockerExecutor(cli, cfg.ContainerWorkingDir, archiver, artifactFiles, stepCache,
+			metrics, logger)
+		reporter = service.NewStatusReporter(httpClient, cfg.ExternalURL, logger)
+		notifier = service.NewNotifier(httpClient, cfg.ExternalURL, notificationsStorage, logger)
+		mailer   = service.NewEmailNotifier(service.SMTPServer{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}, cfg.ExternalURL, watchersStorage)
+		notifiers = service.Notifiers{notifier, mailer}
+		runner    = service.NewRunner(executor, bus, buildsStorage, artifactsStorage, testsStorage, coverageStorage,
+			artifactFiles, logger)
+		poller = service.NewPoller(cfg.CIFilename, cloner, parser, runner, bus, repositoriesStorage,
+			buildsStorage, tagsStorage, logger)
+		scheduler = service.NewScheduler(poller, bus, repositoriesStorage, schedulesStorage, logger)
+		janitor   = service.NewJanitor(service.JanitorConfig{
+			Interval: cfg.Janitor.Interval,
+			Retention: domain.Retention{
+				KeepLast: cfg.Retention.KeepLast,
+				KeepDays: cfg.Retention.KeepDays,
+			},
+			PruneDocker: cfg.Janitor.PruneDocker,
+			Vacuum:      vacuum,
+		}, repositoriesStorage, buildsStorage, artifactsStorage, cloner, artifactFiles, executor, logger)
+
+		health = service.NewHealth(
+			service.Check{Name: "docker", Check: func(ctx context.Context) error {
+				_, err := cli.Ping(ctx)
+				return err
+			}},
+			service.Check{Name: "database", Check: db.PingContext},
+			service.Check{Name: "repositories_dir", Check: service.WritableDirCheck(cfg.RepositoriesDir)},
+			service.Check{Name: "artifacts_dir", Check: service.WritableDirCheck(cfg.ArtifactsDir)},
+			service.Check{Name: "cache_dir", Check: service.WritableDirCheck(cfg.Cache.Dir)},
+			service.Check{Name: "scheduler", Check: service.AliveCheck(scheduler)},
+			service.Check{Name: "poller", Check: service.AliveCheck(poller)},
+			service.Check{Name: "runner", Check: service.AliveCheck(runner)},
+			service.Check{Name: "janitor", Check: service.AliveCheck(janitor)},
+		)
+
+		handler = transport.NewHandler(cfg.StaticRootDir, scheduler, repositoriesStorage, buildsStorage, logsStorage,
+			schedulesStorage, notificationsStorage, watchersStorage, artifactsStorage, testsStorage, coverageStorage,
+			artifactFiles, janitor, metrics.Handler(), health)
 	)
 
-	// Scheduler & Poller & Runner
+	// Scheduler & Poller & Runner & Notifier & Janitor
 	ctx, cancel := context.WithCancel(context.Background())
 	if err != nil {
 		logger.Fatal(err)
 	}
 	defer cancel()
 
+	bus.Listen(ctx, reporter.HandleEvent)
+	bus.Listen(ctx, notifiers.HandleEvent)
+	bus.Listen(ctx, metrics.HandleEvent)
+
 	go scheduler.Start(ctx)
 	go poller.Start(ctx)
 	go runner.Start(ctx)
+	go notifier.Start(ctx)
+	go janitor.Start(ctx)
 
 	// HTTP Server
 	srv := &http.Server{
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/KirillMironov/ci/pkg/migrate"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+var errMigrateUsage = errors.New("usage: ci migrate status|up|down")
+
+// runMigrate runs the migrate command: status lists the migrations, up applies the pending ones
+// and down reverts the latest applied one.
+func runMigrate(migrator *migrate.Migrator, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		var w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			var appliedAt = "pending"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	case "up":
+		migrated, err := migrator.Up()
+		for _, migration := range migrated {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(migrated) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return nil
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %04d_%s\n", migration.Version, migration.Name)
+		return nil
+	default:
+		return errMigrateUsage
+	}
+}
@@ -1,28 +1,78 @@
 package config
 
 import (
-	_ "embed"
+	"embed"
 	"github.com/kelseyhightower/envconfig"
+	"io/fs"
+	"time"
 )
 
-//go:embed schema.sql
-var schema string
+//go:embed migrations
+var migrations embed.FS
 
 type Config struct {
 	Port string `default:"8080" envconfig:"PORT"`
+	// URL under which the CI is reachable, used in links to builds.
+	ExternalURL string `default:"http://localhost:8080" envconfig:"EXTERNAL_URL"`
 
 	CIFilename          string `default:".ci.yaml" envconfig:"CI_FILENAME"`
 	StaticRootDir       string `default:"./web/" envconfig:"STATIC_ROOT_DIR"`
 	RepositoriesDir     string `default:"./.cache/git/" envconfig:"REPOSITORIES_DIR"`
+	ArtifactsDir        string `default:"./.cache/artifacts/" envconfig:"ARTIFACTS_DIR"`
 	ContainerWorkingDir string `default:"/ci" envconfig:"CONTAINER_WORKING_DIR"`
 
+	// SMTP server used to email broken and fixed builds. Emails are not sent if the host is empty.
+	SMTP struct {
+		Host     string `envconfig:"SMTP_HOST"`
+		Port     string `default:"587" envconfig:"SMTP_PORT"`
+		Username string `envconfig:"SMTP_USERNAME"`
+		Password string `envconfig:"SMTP_PASSWORD"`
+		From     string `default:"ci@localhost" envconfig:"SMTP_FROM"`
+	}
+
+	// Retention of the builds of the repositories without their own rules. Zero rules keep every build.
+	Retention struct {
+		KeepLast int `envconfig:"RETENTION_KEEP_LAST"`
+		KeepDays int `envconfig:"RETENTION_KEEP_DAYS"`
+	}
+
+	// Janitor deletes the expired builds and the unused clones and Docker images.
+	Janitor struct {
+		Interval time.Duration `default:"24h" envconfig:"JANITOR_INTERVAL"`
+		// PruneDocker removes every image not used by a container on the Docker host, not only the step images,
+		// so it is off unless the host is dedicated to the builds.
+		PruneDocker bool `default:"false" envconfig:"JANITOR_PRUNE_DOCKER"`
+	}
+
+	// Cache of the step directories, such as downloaded dependencies. Sizes are in bytes.
+	// The least recently used caches are evicted once the total size exceeds MaxSize.
+	Cache struct {
+		Dir          string `default:"./.cache/steps/" envconfig:"CACHE_DIR"`
+		MaxSize      int64  `default:"10737418240" envconfig:"CACHE_MAX_SIZE"`
+		MaxEntrySize int64  `default:"2147483648" envconfig:"CACHE_MAX_ENTRY_SIZE"`
+	}
+
 	SQLite struct {
-		Path   string `default:"./sqlite.db" envconfig:"SQLITE_PATH"`
-		Schema string `envconfig:"SQLITE_SCHEMA"`
+		Path string `default:"./sqlite.db" envconfig:"SQLITE_PATH"`
+		// Migrations are the numbered SQL files creating and updating the schema.
+		Migrations fs.FS `ignored:"true"`
+	}
+
+	// Postgres is used instead of SQLite if its DSN is set.
+	Postgres struct {
+		DSN        string `envconfig:"POSTGRES_DSN"`
+		Migrations fs.FS  `ignored:"true"`
 	}
 }
 
-func Load() (cfg Config, _ error) {
-	cfg.SQLite.Schema = schema
+func Load() (cfg Config, err error) {
+	cfg.SQLite.Migrations, err = fs.Sub(migrations, "migrations/sqlite")
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Postgres.Migrations, err = fs.Sub(migrations, "migrations/postgres")
+	if err != nil {
+		return Config{}, err
+	}
 	return cfg, envconfig.Process("", &cfg)
 }
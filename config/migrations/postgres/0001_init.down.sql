@@ -0,0 +1,4 @@
+DROP TABLE logs;
+DROP TABLE commits;
+DROP TABLE builds;
+DROP TABLE repositories;
@@ -0,0 +1,35 @@
+CREATE TABLE repositories
+(
+    id TEXT,
+    url TEXT NOT NULL,
+    branch TEXT NOT NULL,
+    polling_interval TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT repositories_pk PRIMARY KEY (id),
+    CONSTRAINT repositories_url_unique UNIQUE (url)
+);
+
+CREATE TABLE builds
+(
+    id TEXT,
+    repo_id TEXT,
+    status INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT builds_pk PRIMARY KEY (id),
+    CONSTRAINT builds_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id) ON DELETE CASCADE,
+    CONSTRAINT builds_status_check CHECK (status IN (0, 1, 2, 3))
+);
+
+CREATE TABLE commits
+(
+    build_id TEXT,
+    hash TEXT,
+    CONSTRAINT commits_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE
+);
+
+CREATE TABLE logs
+(
+    build_id TEXT,
+    data TEXT,
+    CONSTRAINT logs_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE
+);
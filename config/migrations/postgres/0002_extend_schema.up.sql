@@ -0,0 +1,114 @@
+ALTER TABLE commits ADD COLUMN branch TEXT NOT NULL DEFAULT '';
+ALTER TABLE commits ADD COLUMN tag TEXT NOT NULL DEFAULT '';
+ALTER TABLE commits ADD COLUMN pull_request INTEGER;
+ALTER TABLE commits ADD COLUMN pull_request_ref TEXT;
+ALTER TABLE commits ADD COLUMN source_branch TEXT;
+ALTER TABLE commits ADD COLUMN target_branch TEXT;
+ALTER TABLE commits ADD COLUMN author_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE commits ADD COLUMN author_email TEXT NOT NULL DEFAULT '';
+
+UPDATE commits SET branch = (
+    SELECT r.branch FROM builds b JOIN repositories r ON r.id = b.repo_id WHERE b.id = commits.build_id
+);
+
+ALTER TABLE repositories RENAME COLUMN branch TO branches;
+UPDATE repositories SET branches = json_build_array(branches)::TEXT;
+
+ALTER TABLE repositories ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE repositories ADD COLUMN pull_requests BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE repositories ADD COLUMN webhook_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN status_provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN status_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN status_token TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE repositories ADD COLUMN last_polled_at TIMESTAMPTZ;
+ALTER TABLE repositories ADD COLUMN last_poll_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE repositories ADD COLUMN last_seen_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN last_build_number INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE builds ADD COLUMN number INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE builds ADD COLUMN trigger TEXT NOT NULL DEFAULT 'push';
+ALTER TABLE builds ADD COLUMN finished_at TIMESTAMPTZ;
+
+UPDATE builds SET number = (
+    SELECT COUNT(*) FROM builds b WHERE b.repo_id = builds.repo_id
+        AND (b.created_at < builds.created_at OR (b.created_at = builds.created_at AND b.id <= builds.id))
+);
+UPDATE repositories SET last_build_number = (SELECT COUNT(*) FROM builds WHERE repo_id = repositories.id);
+
+ALTER TABLE builds ADD CONSTRAINT builds_repo_id_number_unique UNIQUE (repo_id, number);
+CREATE INDEX builds_repo_id_created_at_idx ON builds (repo_id, created_at, id);
+CREATE INDEX builds_repo_id_status_idx ON builds (repo_id, status);
+
+CREATE INDEX commits_build_id_idx ON commits (build_id);
+CREATE INDEX commits_branch_idx ON commits (branch);
+CREATE INDEX commits_hash_idx ON commits (hash);
+CREATE INDEX commits_author_email_idx ON commits (author_email);
+
+CREATE TABLE steps
+(
+    build_id TEXT,
+    position INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    log TEXT NOT NULL,
+    CONSTRAINT steps_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE,
+    CONSTRAINT steps_status_check CHECK (status IN (0, 1, 2, 3))
+);
+
+CREATE INDEX logs_build_id_idx ON logs (build_id);
+CREATE INDEX steps_build_id_idx ON steps (build_id);
+
+CREATE TABLE schedules
+(
+    id TEXT,
+    repo_id TEXT,
+    expression TEXT NOT NULL,
+    branch TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT schedules_pk PRIMARY KEY (id),
+    CONSTRAINT schedules_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id) ON DELETE CASCADE
+);
+
+CREATE TABLE notification_targets
+(
+    id TEXT,
+    repo_id TEXT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT notification_targets_pk PRIMARY KEY (id),
+    CONSTRAINT notification_targets_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE deliveries
+(
+    id TEXT,
+    target_id TEXT,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    response_code INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT deliveries_pk PRIMARY KEY (id),
+    CONSTRAINT deliveries_notification_target_id_fk FOREIGN KEY (target_id) REFERENCES notification_targets (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE watchers
+(
+    repo_id TEXT,
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT watchers_pk PRIMARY KEY (repo_id, email),
+    CONSTRAINT watchers_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE repositories ADD COLUMN retention_keep_last INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE repositories ADD COLUMN retention_keep_days INTEGER NOT NULL DEFAULT 0;
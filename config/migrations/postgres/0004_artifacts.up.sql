@@ -0,0 +1,13 @@
+CREATE TABLE artifacts
+(
+    build_id TEXT,
+    step TEXT NOT NULL,
+    path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    checksum TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT artifacts_pk PRIMARY KEY (build_id, path),
+    CONSTRAINT artifacts_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE
+);
+
+CREATE INDEX artifacts_checksum_idx ON artifacts (checksum);
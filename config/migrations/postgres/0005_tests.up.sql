@@ -0,0 +1,15 @@
+CREATE TABLE tests
+(
+    build_id TEXT,
+    step TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    class_name TEXT NOT NULL,
+    name TEXT NOT NULL,
+    duration BIGINT NOT NULL,
+    status INTEGER NOT NULL,
+    message TEXT NOT NULL,
+    CONSTRAINT tests_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE,
+    CONSTRAINT tests_status_check CHECK (status IN (0, 1, 2))
+);
+
+CREATE INDEX tests_build_id_idx ON tests (build_id);
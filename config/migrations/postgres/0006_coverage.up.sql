@@ -0,0 +1,11 @@
+CREATE TABLE coverage
+(
+    build_id TEXT,
+    step TEXT NOT NULL,
+    package TEXT NOT NULL,
+    covered BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    CONSTRAINT coverage_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE
+);
+
+CREATE INDEX coverage_build_id_idx ON coverage (build_id);
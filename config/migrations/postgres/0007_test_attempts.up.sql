@@ -0,0 +1 @@
+ALTER TABLE tests ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,15 @@
+CREATE TABLE tag_baselines
+(
+    repo_id TEXT,
+    patterns TEXT NOT NULL,
+    CONSTRAINT tag_baselines_pk PRIMARY KEY (repo_id),
+    CONSTRAINT tag_baselines_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id) ON DELETE CASCADE
+);
+
+CREATE TABLE seen_tags
+(
+    repo_id TEXT,
+    tag TEXT NOT NULL,
+    CONSTRAINT seen_tags_pk PRIMARY KEY (repo_id, tag),
+    CONSTRAINT seen_tags_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id) ON DELETE CASCADE
+);
@@ -0,0 +1,44 @@
+DROP TABLE watchers;
+DROP TABLE deliveries;
+DROP TABLE notification_targets;
+DROP TABLE schedules;
+DROP TABLE steps;
+
+DROP INDEX logs_build_id_idx;
+DROP INDEX commits_author_email_idx;
+DROP INDEX commits_hash_idx;
+DROP INDEX commits_branch_idx;
+DROP INDEX commits_build_id_idx;
+DROP INDEX builds_repo_id_status_idx;
+DROP INDEX builds_repo_id_created_at_idx;
+DROP INDEX builds_repo_id_number_unique;
+
+ALTER TABLE builds DROP COLUMN finished_at;
+ALTER TABLE builds DROP COLUMN trigger;
+ALTER TABLE builds DROP COLUMN number;
+
+ALTER TABLE repositories DROP COLUMN last_build_number;
+ALTER TABLE repositories DROP COLUMN last_seen_hash;
+ALTER TABLE repositories DROP COLUMN consecutive_failures;
+ALTER TABLE repositories DROP COLUMN last_poll_error;
+ALTER TABLE repositories DROP COLUMN last_polled_at;
+ALTER TABLE repositories DROP COLUMN enabled;
+ALTER TABLE repositories DROP COLUMN status_token;
+ALTER TABLE repositories DROP COLUMN status_url;
+ALTER TABLE repositories DROP COLUMN status_provider;
+ALTER TABLE repositories DROP COLUMN webhook_secret;
+ALTER TABLE repositories DROP COLUMN pull_requests;
+ALTER TABLE repositories DROP COLUMN tags;
+ALTER TABLE repositories DROP COLUMN name;
+
+UPDATE repositories SET branches = COALESCE(json_extract(branches, '$[0]'), '');
+ALTER TABLE repositories RENAME COLUMN branches TO branch;
+
+ALTER TABLE commits DROP COLUMN author_email;
+ALTER TABLE commits DROP COLUMN author_name;
+ALTER TABLE commits DROP COLUMN target_branch;
+ALTER TABLE commits DROP COLUMN source_branch;
+ALTER TABLE commits DROP COLUMN pull_request_ref;
+ALTER TABLE commits DROP COLUMN pull_request;
+ALTER TABLE commits DROP COLUMN tag;
+ALTER TABLE commits DROP COLUMN branch;
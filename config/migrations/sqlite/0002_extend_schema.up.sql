@@ -0,0 +1,114 @@
+ALTER TABLE commits ADD COLUMN branch VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE commits ADD COLUMN tag VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE commits ADD COLUMN pull_request INTEGER;
+ALTER TABLE commits ADD COLUMN pull_request_ref VARCHAR(255);
+ALTER TABLE commits ADD COLUMN source_branch VARCHAR(255);
+ALTER TABLE commits ADD COLUMN target_branch VARCHAR(255);
+ALTER TABLE commits ADD COLUMN author_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE commits ADD COLUMN author_email VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE commits SET branch = (
+    SELECT r.branch FROM builds b JOIN repositories r ON r.id = b.repo_id WHERE b.id = commits.build_id
+);
+
+ALTER TABLE repositories RENAME COLUMN branch TO branches;
+UPDATE repositories SET branches = json_array(branches);
+
+ALTER TABLE repositories ADD COLUMN name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN tags VARCHAR NOT NULL DEFAULT '[]';
+ALTER TABLE repositories ADD COLUMN pull_requests BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE repositories ADD COLUMN webhook_secret VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN status_provider VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN status_url VARCHAR(2048) NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN status_token VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE repositories ADD COLUMN last_polled_at TIMESTAMP;
+ALTER TABLE repositories ADD COLUMN last_poll_error VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE repositories ADD COLUMN last_seen_hash VARCHAR(40) NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN last_build_number INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE builds ADD COLUMN number INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE builds ADD COLUMN trigger VARCHAR(20) NOT NULL DEFAULT 'push';
+ALTER TABLE builds ADD COLUMN finished_at TIMESTAMP;
+
+UPDATE builds SET number = (
+    SELECT COUNT(*) FROM builds b WHERE b.repo_id = builds.repo_id
+        AND (b.created_at < builds.created_at OR (b.created_at = builds.created_at AND b.id <= builds.id))
+);
+UPDATE repositories SET last_build_number = (SELECT COUNT(*) FROM builds WHERE repo_id = repositories.id);
+
+CREATE UNIQUE INDEX builds_repo_id_number_unique ON builds (repo_id, number);
+CREATE INDEX builds_repo_id_created_at_idx ON builds (repo_id, created_at, id);
+CREATE INDEX builds_repo_id_status_idx ON builds (repo_id, status);
+
+CREATE INDEX commits_build_id_idx ON commits (build_id);
+CREATE INDEX commits_branch_idx ON commits (branch);
+CREATE INDEX commits_hash_idx ON commits (hash);
+CREATE INDEX commits_author_email_idx ON commits (author_email);
+
+CREATE TABLE steps
+(
+    build_id VARCHAR(20),
+    position INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    attempt INTEGER NOT NULL,
+    status INTEGER NOT NULL,
+    error VARCHAR NOT NULL,
+    log VARCHAR NOT NULL,
+    CONSTRAINT steps_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE,
+    CONSTRAINT steps_status_check CHECK (status IN (0, 1, 2, 3))
+);
+
+CREATE INDEX logs_build_id_idx ON logs (build_id);
+CREATE INDEX steps_build_id_idx ON steps (build_id);
+
+CREATE TABLE schedules
+(
+    id VARCHAR(20),
+    repo_id VARCHAR(20),
+    expression VARCHAR(255) NOT NULL,
+    branch VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT schedules_pk PRIMARY KEY (id),
+    CONSTRAINT schedules_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id) ON DELETE CASCADE
+);
+
+CREATE TABLE notification_targets
+(
+    id VARCHAR(20),
+    repo_id VARCHAR(20),
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR NOT NULL,
+    events VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT notification_targets_pk PRIMARY KEY (id),
+    CONSTRAINT notification_targets_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE deliveries
+(
+    id VARCHAR(20),
+    target_id VARCHAR(20),
+    event VARCHAR(20) NOT NULL,
+    payload VARCHAR NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL,
+    response_code INTEGER NOT NULL,
+    error VARCHAR NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT deliveries_pk PRIMARY KEY (id),
+    CONSTRAINT deliveries_notification_target_id_fk FOREIGN KEY (target_id) REFERENCES notification_targets (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE watchers
+(
+    repo_id VARCHAR(20),
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT watchers_pk PRIMARY KEY (repo_id, email),
+    CONSTRAINT watchers_repository_id_fk FOREIGN KEY (repo_id) REFERENCES repositories (id) ON DELETE CASCADE
+);
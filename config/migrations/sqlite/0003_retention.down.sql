@@ -0,0 +1,2 @@
+ALTER TABLE repositories DROP COLUMN retention_keep_days;
+ALTER TABLE repositories DROP COLUMN retention_keep_last;
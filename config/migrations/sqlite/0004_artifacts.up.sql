@@ -0,0 +1,13 @@
+CREATE TABLE artifacts
+(
+    build_id VARCHAR(20),
+    step VARCHAR NOT NULL,
+    path VARCHAR NOT NULL,
+    size INTEGER NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT artifacts_pk PRIMARY KEY (build_id, path),
+    CONSTRAINT artifacts_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE
+);
+
+CREATE INDEX artifacts_checksum_idx ON artifacts (checksum);
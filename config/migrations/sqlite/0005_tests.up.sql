@@ -0,0 +1,15 @@
+CREATE TABLE tests
+(
+    build_id VARCHAR(20),
+    step VARCHAR NOT NULL,
+    position INTEGER NOT NULL,
+    class_name VARCHAR NOT NULL,
+    name VARCHAR NOT NULL,
+    duration INTEGER NOT NULL,
+    status INTEGER NOT NULL,
+    message VARCHAR NOT NULL,
+    CONSTRAINT tests_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE,
+    CONSTRAINT tests_status_check CHECK (status IN (0, 1, 2))
+);
+
+CREATE INDEX tests_build_id_idx ON tests (build_id);
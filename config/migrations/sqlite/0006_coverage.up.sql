@@ -0,0 +1,11 @@
+CREATE TABLE coverage
+(
+    build_id VARCHAR(20),
+    step VARCHAR NOT NULL,
+    package VARCHAR NOT NULL,
+    covered INTEGER NOT NULL,
+    total INTEGER NOT NULL,
+    CONSTRAINT coverage_build_id_fk FOREIGN KEY (build_id) REFERENCES builds (id) ON DELETE CASCADE
+);
+
+CREATE INDEX coverage_build_id_idx ON coverage (build_id);
@@ -0,0 +1,2 @@
+DROP TABLE seen_tags;
+DROP TABLE tag_baselines;
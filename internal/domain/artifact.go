@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// Artifact is a file collected from a step container after the step.
+type Artifact struct {
+	BuildId string `json:"-"`
+	Step    string `json:"step"`
+	// Path of the file relative to the container working directory.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Checksum is the hex-encoded SHA-256 of the file content, under which the file is stored.
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ArtifactsStorage interface {
+	// Save stores the artifact, replacing the artifact of the build with the same path.
+	Save(Artifact) error
+	GetAllByBuildId(buildId string) ([]Artifact, error)
+	GetByPath(buildId, path string) (Artifact, error)
+	// Referenced reports whether any artifact has the checksum.
+	Referenced(checksum string) (bool, error)
+}
@@ -6,32 +6,112 @@ import (
 )
 
 type Build struct {
-	Id        string
-	RepoId    string
-	Commit    Commit
-	Log       Log
-	Status    Status
-	CreatedAt time.Time
+	Id         string
+	RepoId     string
+	Number     int
+	Commit     Commit
+	Trigger    Trigger
+	Log        Log
+	Steps      []StepAttempt
+	Status     Status
+	CreatedAt  time.Time
+	FinishedAt time.Time
+	// Coverage of the build, if known. It is not stored with the build.
+	Coverage *Coverage
+}
+
+// Duration returns the duration of a finished build.
+func (b Build) Duration() time.Duration {
+	if b.FinishedAt.IsZero() {
+		return 0
+	}
+	return b.FinishedAt.Sub(b.CreatedAt)
 }
 
 func (b Build) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Id        string    `json:"id"`
-		Commit    Commit    `json:"commit"`
-		Status    string    `json:"status"`
-		CreatedAt time.Time `json:"created_at"`
+		Id         string           `json:"id"`
+		Number     int              `json:"number"`
+		Commit     Commit           `json:"commit"`
+		Trigger    Trigger          `json:"trigger"`
+		Steps      []StepAttempt    `json:"steps,omitempty"`
+		Status     string           `json:"status"`
+		CreatedAt  time.Time        `json:"created_at"`
+		FinishedAt *time.Time       `json:"finished_at,omitempty"`
+		Coverage   *coverageSummary `json:"coverage,omitempty"`
 	}{
 		Id:        b.Id,
+		Number:    b.Number,
 		Commit:    b.Commit,
+		Trigger:   b.Trigger,
+		Steps:     b.Steps,
 		Status:    b.Status.String(),
 		CreatedAt: b.CreatedAt,
+		FinishedAt: func() *time.Time {
+			if b.FinishedAt.IsZero() {
+				return nil
+			}
+			return &b.FinishedAt
+		}(),
+		Coverage: func() *coverageSummary {
+			if b.Coverage == nil {
+				return nil
+			}
+			return &coverageSummary{Percent: b.Coverage.Percent(), Delta: b.Coverage.Delta}
+		}(),
 	})
 }
 
+// coverageSummary is the coverage shown along with a build.
+type coverageSummary struct {
+	Percent float64  `json:"percent"`
+	Delta   *float64 `json:"delta,omitempty"`
+}
+
+// BuildsFilter selects a page of the builds of a repository.
+type BuildsFilter struct {
+	RepoId string
+	Status *Status
+	Branch string
+	// Commit is a prefix of the commit hash.
+	Commit string
+	// Author is the name or email of the commit author.
+	Author string
+	// Since and Until bound the creation time of the builds, if set. Until is exclusive.
+	Since, Until time.Time
+	// Ascending orders the builds from the oldest to the newest. By default, the newest builds come first.
+	Ascending bool
+	// Cursor is the NextCursor of the previous page. It is empty for the first page.
+	Cursor string
+	Limit  int
+}
+
+// BuildsPage is a page of builds matching a BuildsFilter.
+type BuildsPage struct {
+	Builds []Build
+	// Total is the number of builds matching the filter on all pages.
+	Total int
+	// NextCursor selects the next page. It is empty on the last page.
+	NextCursor string
+}
+
 type BuildsStorage interface {
-	Create(Build) error
+	// Create stores the build and returns its number, assigned in sequence per repository.
+	Create(Build) (number int, err error)
 	Update(Build) error
 	Delete(id string) error
+	// DeleteExpired deletes the finished builds of the repository created before the given time, except for
+	// the keepLast latest builds and the latest successful build, and returns the number of deleted builds.
+	DeleteExpired(repoId string, keepLast int, before time.Time) (deleted int, err error)
 	GetAllByRepoId(repoId string) ([]Build, error)
+	GetPage(BuildsFilter) (BuildsPage, error)
 	GetById(id string) (Build, error)
+	GetByNumber(repoId string, number int) (Build, error)
+	GetLatestByBranch(repoId, branch string) (Build, error)
+	// GetLatestFinished returns the latest finished build of the branch, or of any branch if the branch is empty.
+	// Tag and pull request builds are skipped.
+	GetLatestFinished(repoId, branch string) (Build, error)
+	GetLatestByTag(repoId, tag string) (Build, error)
+	GetLatestByPullRequest(repoId string, number int) (Build, error)
+	GetAllByPullRequest(repoId string, number int) ([]Build, error)
 }
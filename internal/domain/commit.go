@@ -1,5 +1,26 @@
 package domain
 
+// Commit is a commit referenced by a branch, a tag or a pull request.
 type Commit struct {
-	Hash string `json:"hash"`
+	Hash        string       `json:"hash"`
+	Branch      string       `json:"branch,omitempty"`
+	Tag         string       `json:"tag,omitempty"`
+	PullRequest *PullRequest `json:"pull_request,omitempty"`
+	// Author is known once the commit is checked out.
+	Author *Author `json:"author,omitempty"`
+}
+
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// PullRequest is a pull request (GitHub, Gitea) or a merge request (GitLab).
+type PullRequest struct {
+	Number int `json:"number"`
+	// Provider reference of the pull request head, e.g. refs/pull/1/head or refs/merge-requests/1/head.
+	Ref string `json:"ref"`
+	// Source and target branches are only known for pull requests received by webhook.
+	SourceBranch string `json:"source_branch,omitempty"`
+	TargetBranch string `json:"target_branch,omitempty"`
 }
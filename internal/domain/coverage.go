@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Coverage of a build or of one of its steps, summed from the packages of the collected coverage reports.
+type Coverage struct {
+	BuildId  string
+	Covered  int64
+	Total    int64
+	Packages []PackageCoverage
+	// Delta is the change of the percentage against the previous successful build of the branch.
+	// It is nil if there is no such build. It is not stored.
+	Delta *float64
+}
+
+// PackageCoverage is the number of the covered and all statements or lines of a package.
+type PackageCoverage struct {
+	Name    string
+	Covered int64
+	Total   int64
+}
+
+// Percent returns the percentage of the covered statements.
+func (c Coverage) Percent() float64 {
+	return percent(c.Covered, c.Total)
+}
+
+func (c Coverage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Percent  float64           `json:"percent"`
+		Delta    *float64          `json:"delta,omitempty"`
+		Covered  int64             `json:"covered"`
+		Total    int64             `json:"total"`
+		Packages []PackageCoverage `json:"packages"`
+	}{
+		Percent:  c.Percent(),
+		Delta:    c.Delta,
+		Covered:  c.Covered,
+		Total:    c.Total,
+		Packages: c.Packages,
+	})
+}
+
+func (pc PackageCoverage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name    string  `json:"name"`
+		Percent float64 `json:"percent"`
+		Covered int64   `json:"covered"`
+		Total   int64   `json:"total"`
+	}{
+		Name:    pc.Name,
+		Percent: percent(pc.Covered, pc.Total),
+		Covered: pc.Covered,
+		Total:   pc.Total,
+	})
+}
+
+func percent(covered, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+type CoverageStorage interface {
+	// Save stores the package coverage of the step of the build, replacing the one stored before.
+	Save(buildId, step string, packages []PackageCoverage) error
+	// GetByBuildId returns the coverage of the build. A package reported by several steps is counted once,
+	// with the highest coverage among them.
+	GetByBuildId(buildId string) (Coverage, error)
+	// GetByStep returns the coverage of the step of the build.
+	GetByStep(buildId, step string) (Coverage, error)
+	// GetPrevious returns the coverage of the latest successful build of the branch created before the time.
+	// If the branch is empty, the builds of every branch are considered. Tag and pull request builds are skipped.
+	// If the step is not empty, only the coverage of the step is returned, from the latest build that has it.
+	GetPrevious(repoId, branch, step string, before time.Time) (Coverage, error)
+}
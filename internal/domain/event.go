@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+// EventKind is the kind of event published on the event bus.
+type EventKind string
+
+const (
+	EventRepositoryAdded   EventKind = "repository.added"
+	EventRepositoryRemoved EventKind = "repository.removed"
+	EventRepositoryUpdated EventKind = "repository.updated"
+	// EventRepositoryPolled is published after the latest commits of a repository have been listed.
+	EventRepositoryPolled EventKind = "repository.polled"
+	EventBuildQueued      EventKind = "build.queued"
+	EventBuildStarted     EventKind = "build.started"
+	EventStepStarted      EventKind = "step.started"
+	EventStepFinished     EventKind = "step.finished"
+	EventBuildFinished    EventKind = "build.finished"
+	// EventBuildAborted is published instead of EventBuildStarted if a queued build fails to start.
+	EventBuildAborted EventKind = "build.aborted"
+)
+
+// Event is a repository or build lifecycle event.
+type Event struct {
+	Kind       EventKind  `json:"kind"`
+	Time       time.Time  `json:"time"`
+	Repository Repository `json:"repository"`
+	// Build is set for build and step events.
+	Build *Build `json:"build,omitempty"`
+	// Step is the step attempt of step events.
+	Step *StepAttempt `json:"step,omitempty"`
+	// Previous is the previous build of the same branch, tag or pull request, set for finished builds.
+	Previous *Build `json:"previous,omitempty"`
+	// Commits, Error and Duration are the result of a poll.
+	Commits  []Commit      `json:"commits,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// NewEvent returns an event of the given kind about the repository.
+func NewEvent(kind EventKind, repo Repository) Event {
+	return Event{Kind: kind, Time: time.Now(), Repository: repo}
+}
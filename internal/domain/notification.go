@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// NotificationEvent is a build lifecycle event that notification targets can subscribe to.
+type NotificationEvent string
+
+const (
+	EventStarted   NotificationEvent = "started"
+	EventSucceeded NotificationEvent = "succeeded"
+	EventFailed    NotificationEvent = "failed"
+	// EventFixed is a successful build following a failed one.
+	EventFixed NotificationEvent = "fixed"
+	// EventBroken is a failed build following a successful one.
+	EventBroken NotificationEvent = "broken"
+)
+
+// NotificationTarget is a URL that receives signed JSON payloads on build lifecycle events.
+type NotificationTarget struct {
+	Id     string `json:"id"`
+	RepoId string `json:"repo_id"`
+	URL    string `json:"url"`
+	// Key used to sign payloads.
+	Secret    string              `json:"-"`
+	Events    []NotificationEvent `json:"events"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// Subscribed reports whether the target is subscribed to the event.
+func (nt NotificationTarget) Subscribed(event NotificationEvent) bool {
+	for _, e := range nt.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Delivery is a notification payload sent, or to be sent, to a target.
+type Delivery struct {
+	Id            string            `json:"id"`
+	TargetId      string            `json:"target_id"`
+	Event         NotificationEvent `json:"event"`
+	Payload       json.RawMessage   `json:"payload"`
+	Status        DeliveryStatus    `json:"status"`
+	Attempts      int               `json:"attempts"`
+	ResponseCode  int               `json:"response_code,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type NotificationsStorage interface {
+	CreateTarget(NotificationTarget) error
+	DeleteTarget(id string) error
+	GetTargetById(id string) (NotificationTarget, error)
+	GetTargetsByRepoId(repoId string) ([]NotificationTarget, error)
+	CreateDelivery(Delivery) error
+	UpdateDelivery(Delivery) error
+	// GetDueDeliveries returns pending deliveries whose next attempt is due at the given time.
+	GetDueDeliveries(time.Time) ([]Delivery, error)
+	GetDeliveriesByTargetId(targetId string) ([]Delivery, error)
+}
@@ -2,21 +2,74 @@ package domain
 
 import (
 	"github.com/KirillMironov/ci/pkg/duration"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"strings"
 	"time"
 )
 
 type Repository struct {
 	Id              string            `json:"id"`
+	Name            string            `json:"name"`
 	URL             string            `json:"url"`
-	Branch          string            `json:"branch"`
+	Branches        pattern.List      `json:"branches"`
+	Tags            pattern.List      `json:"tags"`
+	PullRequests    bool              `json:"pull_requests"`
+	WebhookSecret   string            `json:"-"`
+	StatusProvider  StatusProvider    `json:"status_provider"`
+	StatusURL       string            `json:"status_url"`
+	StatusToken     string            `json:"-"`
 	PollingInterval duration.Duration `json:"polling_interval"`
+	Enabled         bool              `json:"enabled"`
+	Retention       Retention         `json:"retention"`
 	CreatedAt       time.Time         `json:"created_at"`
+	PollStatus      PollStatus        `json:"poll_status"`
 }
 
+// DefaultBranch returns the first branch pattern without wildcards, or an empty string if there is none.
+func (r Repository) DefaultBranch() string {
+	for _, branch := range r.Branches {
+		if !strings.ContainsAny(branch, `*?[\`) {
+			return branch
+		}
+	}
+	return ""
+}
+
+// PollStatus is the outcome of the latest polls of a repository.
+type PollStatus struct {
+	LastPolledAt        *time.Time `json:"last_polled_at"`
+	LastError           string     `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	// LastSeenHash is the latest commit of the first matching branch seen by a successful poll.
+	LastSeenHash string `json:"last_seen_hash,omitempty"`
+}
+
+// Healthy reports whether the latest poll succeeded.
+func (ps PollStatus) Healthy() bool {
+	return ps.ConsecutiveFailures == 0
+}
+
+// StatusProvider is a Git host API used to report commit statuses.
+type StatusProvider string
+
+const (
+	GitHub StatusProvider = "github"
+	GitLab StatusProvider = "gitlab"
+	Gitea  StatusProvider = "gitea"
+)
+
 type RepositoriesStorage interface {
 	Create(Repository) error
+	// Update updates the settings of the repository. Its URL and poll status are left unchanged.
+	// It returns ErrNotFound if there is no such repository.
+	Update(Repository) error
 	Delete(id string) error
 	GetAll() ([]Repository, error)
 	GetById(id string) (Repository, error)
 	GetByURL(url string) (Repository, error)
+	// GetUnhealthy returns the repositories whose latest poll failed.
+	GetUnhealthy() ([]Repository, error)
+	// UpdatePollStatus records a poll of the repository. A non-empty pollErr increments the consecutive failures
+	// and keeps the last seen hash, otherwise the failures are reset and the hash is replaced.
+	UpdatePollStatus(id string, polledAt time.Time, hash, pollErr string) error
 }
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+// Retention decides which builds of a repository are kept. A build is kept if any rule keeps it,
+// and the latest successful build is always kept. A zero rule keeps nothing, so with no rules set every build is kept.
+type Retention struct {
+	// KeepLast is the number of the latest builds to keep.
+	KeepLast int `json:"keep_last"`
+	// KeepDays is the number of days during which builds are kept.
+	KeepDays int `json:"keep_days"`
+}
+
+// Or returns the retention with the zero rules replaced by the rules of the fallback.
+func (r Retention) Or(fallback Retention) Retention {
+	if r.KeepLast == 0 {
+		r.KeepLast = fallback.KeepLast
+	}
+	if r.KeepDays == 0 {
+		r.KeepDays = fallback.KeepDays
+	}
+	return r
+}
+
+// Enabled reports whether the retention deletes any builds.
+func (r Retention) Enabled() bool {
+	return r.KeepLast > 0 || r.KeepDays > 0
+}
+
+// Cutoff returns the creation time before which builds are no longer kept by KeepDays.
+func (r Retention) Cutoff(now time.Time) time.Time {
+	return now.AddDate(0, 0, -r.KeepDays)
+}
+
+// CleanupReport is what a janitor run removed.
+type CleanupReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Builds is the number of deleted builds, along with their logs and artifacts, by repository id.
+	Builds map[string]int `json:"builds"`
+	// Clones are the ids of the repositories whose local clones were removed.
+	Clones []string `json:"clones"`
+	// Artifacts are the checksums of the removed artifact files no longer referenced by any artifact.
+	Artifacts []string `json:"artifacts"`
+	// Containers are the ids of the removed stopped step containers.
+	Containers []string `json:"containers"`
+	// Images are the references of the removed Docker images.
+	Images []string `json:"images"`
+	// SpaceReclaimed is the disk space in bytes freed by removing the containers and images.
+	SpaceReclaimed uint64   `json:"space_reclaimed"`
+	Vacuumed       bool     `json:"vacuumed"`
+	Errors         []string `json:"errors,omitempty"`
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// Schedule is a cron expression that periodically triggers a build of a repository.
+type Schedule struct {
+	Id         string `json:"id"`
+	RepoId     string `json:"repo_id"`
+	Expression string `json:"expression"`
+	// Branch to build. If empty, all branches matching the repository patterns are built.
+	Branch    string    `json:"branch"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SchedulesStorage interface {
+	Create(Schedule) error
+	Update(Schedule) error
+	Delete(id string) error
+	GetAll() ([]Schedule, error)
+	GetAllByRepoId(repoId string) ([]Schedule, error)
+	GetById(id string) (Schedule, error)
+}
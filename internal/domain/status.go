@@ -1,5 +1,7 @@
 package domain
 
+import "fmt"
+
 const (
 	Success Status = iota
 	Failure
@@ -12,3 +14,13 @@ type Status uint8
 func (s Status) String() string {
 	return [...]string{"success", "failure", "skipped", "in progress"}[s]
 }
+
+// ParseStatus returns the status with the given name.
+func ParseStatus(name string) (Status, error) {
+	for s := Success; s <= InProgress; s++ {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status %q", name)
+}
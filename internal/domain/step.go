@@ -1,9 +1,159 @@
 package domain
 
+import (
+	"encoding/json"
+	"github.com/KirillMironov/ci/pkg/duration"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"time"
+)
+
 type Step struct {
 	Name        string   `yaml:"name"`
 	Image       string   `yaml:"image"`
 	Environment []string `yaml:"env"`
 	Command     []string `yaml:"command"`
 	Args        []string `yaml:"args"`
+	Retry       Retry    `yaml:"retry"`
+	When        When     `yaml:"when"`
+	// Artifacts are the patterns of the files collected from the working directory after the step.
+	// A matching directory is collected with all of its files.
+	Artifacts pattern.List `yaml:"artifacts"`
+	Cache     Cache        `yaml:"cache"`
+	Reports   Reports      `yaml:"reports"`
+}
+
+// Reports describes the test reports collected from the working directory after a step, along with the artifacts.
+type Reports struct {
+	// JUnit are the patterns of the JUnit XML reports.
+	JUnit pattern.List `yaml:"junit"`
+	// Coverage are the patterns of the Go cover profiles and the Cobertura XML reports.
+	Coverage pattern.List `yaml:"coverage"`
+	// MaxCoverageDrop fails the step if its coverage drops by more percentage points than allowed
+	// against the same step of the previous successful build of the branch.
+	MaxCoverageDrop *float64 `yaml:"max_coverage_drop"`
+}
+
+// Cache describes the directories restored before a step and saved after it succeeds,
+// such as downloaded dependencies.
+type Cache struct {
+	// Key names the saved directories. ${hashFiles("pattern", ...)} in the key is replaced with the hash
+	// of the source code files matching any of the patterns, so the key changes along with a lockfile.
+	Key string `yaml:"key"`
+	// RestoreKeys are the key prefixes tried in order if nothing is saved under the key.
+	// The most recently used directories saved under a matching key are restored.
+	RestoreKeys []string `yaml:"restore_keys"`
+	// Paths of the directories, absolute or relative to the working directory.
+	Paths []string `yaml:"paths"`
+	// Scope is set by the runner for every build, it is not read from the pipeline.
+	Scope CacheScope `yaml:"-"`
+}
+
+// CacheScope limits the caches of a step to those of its repository and refs.
+type CacheScope struct {
+	RepoId string
+	// Refs whose caches are restored, tried in order. The caches are saved under the first one.
+	Refs []string
+	// ReadOnly disables saving the caches, as for the untrusted pull request builds.
+	ReadOnly bool
+}
+
+// Enabled reports whether the step has a cache.
+func (c Cache) Enabled() bool {
+	return c.Key != "" && len(c.Paths) > 0
+}
+
+// When describes the conditions under which a step is executed.
+// Empty conditions match any build.
+type When struct {
+	Trigger []Trigger    `yaml:"trigger"`
+	Branch  pattern.List `yaml:"branch"`
+	Tag     pattern.List `yaml:"tag"`
+}
+
+// Match reports whether a build of the commit caused by the trigger satisfies the conditions.
+func (w When) Match(commit Commit, trigger Trigger) bool {
+	if len(w.Trigger) > 0 && !containsTrigger(w.Trigger, trigger) {
+		return false
+	}
+	if len(w.Branch) > 0 && !w.Branch.Match(commit.Branch) {
+		return false
+	}
+	if len(w.Tag) > 0 && !w.Tag.Match(commit.Tag) {
+		return false
+	}
+	return true
+}
+
+func containsTrigger(triggers []Trigger, trigger Trigger) bool {
+	for _, t := range triggers {
+		if t == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// Retry describes how a failed step is retried.
+type Retry struct {
+	// Maximum number of attempts, including the first one.
+	Attempts int `yaml:"attempts"`
+	// Delay before the second attempt, doubled for each following one up to MaxRetryDelay.
+	Backoff duration.Duration `yaml:"backoff"`
+	// Whether to retry when the step exits with a non-zero code.
+	// Infrastructure errors are always retried.
+	OnExitError bool `yaml:"on_exit_error"`
+}
+
+// MaxAttempts returns the maximum number of attempts, which is at least one.
+func (r Retry) MaxAttempts() int {
+	if r.Attempts < 1 {
+		return 1
+	}
+	return r.Attempts
+}
+
+// MaxRetryDelay caps the delay before an attempt of a step.
+const MaxRetryDelay = time.Hour
+
+// Delay returns the delay before the given attempt, at most MaxRetryDelay.
+func (r Retry) Delay(attempt int) time.Duration {
+	var delay = r.Backoff.Duration()
+	if attempt < 2 || delay <= 0 {
+		return 0
+	}
+
+	// The delay is doubled until it reaches the maximum, so that it does not overflow.
+	for i := 2; i < attempt && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > MaxRetryDelay {
+		return MaxRetryDelay
+	}
+	return delay
+}
+
+// StepAttempt is a single execution of a step.
+type StepAttempt struct {
+	Step    string
+	Attempt int
+	Status  Status
+	Error   string
+	Log     Log
+}
+
+func (sa StepAttempt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Step    string `json:"step"`
+		Attempt int    `json:"attempt"`
+		Status  string `json:"status"`
+		Error   string `json:"error,omitempty"`
+		Log     Log    `json:"log"`
+	}{
+		Step:    sa.Step,
+		Attempt: sa.Attempt,
+		Status:  sa.Status.String(),
+		Error:   sa.Error,
+		Log:     sa.Log,
+	})
 }
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"github.com/KirillMironov/ci/pkg/duration"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRetry_Delay(t *testing.T) {
+	tests := map[string]struct {
+		backoff       time.Duration
+		attempt       int
+		expectedDelay time.Duration
+	}{
+		"first attempt": {
+			backoff:       time.Second,
+			attempt:       1,
+			expectedDelay: 0,
+		},
+		"second attempt": {
+			backoff:       time.Second,
+			attempt:       2,
+			expectedDelay: time.Second,
+		},
+		"doubled": {
+			backoff:       time.Second,
+			attempt:       4,
+			expectedDelay: time.Second * 4,
+		},
+		"capped": {
+			backoff:       time.Minute,
+			attempt:       10,
+			expectedDelay: MaxRetryDelay,
+		},
+		"capped without overflow": {
+			backoff:       time.Second,
+			attempt:       100,
+			expectedDelay: MaxRetryDelay,
+		},
+		"backoff above the maximum": {
+			backoff:       time.Hour * 2,
+			attempt:       2,
+			expectedDelay: MaxRetryDelay,
+		},
+		"no backoff": {
+			backoff:       0,
+			attempt:       3,
+			expectedDelay: 0,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var retry = Retry{Attempts: tc.attempt, Backoff: duration.Duration(tc.backoff)}
+			assert.Equal(t, tc.expectedDelay, retry.Delay(tc.attempt))
+		})
+	}
+}
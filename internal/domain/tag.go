@@ -0,0 +1,18 @@
+package domain
+
+import "github.com/KirillMironov/ci/pkg/pattern"
+
+// TagBaseline is the set of tags of a repository present when it was first polled with its tag patterns.
+// These tags are not built, only the ones appearing later are.
+type TagBaseline struct {
+	// Patterns are the repository tag patterns the baseline was taken with.
+	Patterns pattern.List
+	Tags     []string
+}
+
+type TagsStorage interface {
+	// GetBaseline returns the tag baseline of the repository, or ErrNotFound if it was never taken.
+	GetBaseline(repoId string) (TagBaseline, error)
+	// SetBaseline replaces the tag baseline of the repository.
+	SetBaseline(repoId string, baseline TagBaseline) error
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TestCase is a test result parsed from a report collected after a step.
+type TestCase struct {
+	BuildId string
+	Step    string
+	// Attempt of the step the test ran in, starting at 1.
+	Attempt   int
+	ClassName string
+	Name      string
+	Duration  time.Duration
+	// Status is Success, Failure or Skipped.
+	Status Status
+	// Message of the failure, if the test failed.
+	Message string
+	// Flaky reports whether the test both succeeded and failed on the same commit in the latest builds of the branch,
+	// including across the attempts of a retried step. It is not stored.
+	Flaky bool
+}
+
+func (tc TestCase) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Step      string  `json:"step"`
+		Attempt   int     `json:"attempt"`
+		ClassName string  `json:"class_name"`
+		Name      string  `json:"name"`
+		Duration  float64 `json:"duration"`
+		Status    string  `json:"status"`
+		Message   string  `json:"message,omitempty"`
+		Flaky     bool    `json:"flaky"`
+	}{
+		Step:      tc.Step,
+		Attempt:   tc.Attempt,
+		ClassName: tc.ClassName,
+		Name:      tc.Name,
+		Duration:  tc.Duration.Seconds(),
+		Status:    tc.Status.String(),
+		Message:   tc.Message,
+		Flaky:     tc.Flaky,
+	})
+}
+
+type TestsStorage interface {
+	// Save stores the test cases of the attempt of the step of the build, replacing the ones stored before
+	// for the same attempt.
+	Save(buildId, step string, attempt int, tests []TestCase) error
+	GetAllByBuildId(buildId string) ([]TestCase, error)
+	// GetFlaky returns the step, class name and name of the tests which both succeeded and failed on the same commit
+	// in the given number of the latest builds of the branch, either in different builds or in different attempts
+	// of a step.
+	GetFlaky(repoId, branch string, builds int) ([]TestCase, error)
+}
@@ -0,0 +1,15 @@
+package domain
+
+// Trigger is the event that caused a build.
+type Trigger string
+
+const (
+	// TriggerPush is a new commit found by polling.
+	TriggerPush Trigger = "push"
+	// TriggerCron is a cron schedule.
+	TriggerCron Trigger = "cron"
+	// TriggerTag is a new tag found by polling.
+	TriggerTag Trigger = "tag"
+	// TriggerPullRequest is a new commit of a pull or merge request.
+	TriggerPullRequest Trigger = "pull_request"
+)
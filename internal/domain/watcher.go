@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Watcher is an email address notified when the builds of a repository break or get fixed.
+type Watcher struct {
+	RepoId    string    `json:"repo_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WatchersStorage interface {
+	Create(Watcher) error
+	Delete(repoId, email string) error
+	GetAllByRepoId(repoId string) ([]Watcher, error)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/logger"
+	"sync"
+)
+
+// backlogWarning is the number of events pending for a subscriber logged as a warning, and every multiple of it.
+const backlogWarning = 1000
+
+// Bus used to publish repository and build lifecycle events to in-process subscribers.
+// Every subscriber receives all events in the order they were published. The events are queued for each subscriber
+// without a limit, so a slow subscriber neither holds up the publishers nor loses events.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions map[*subscription]struct{}
+	logger        logger.Logger
+}
+
+type subscription struct {
+	events chan domain.Event
+	// queue holds the published events not yet received, ready signals that it is not empty.
+	queue []domain.Event
+	ready chan struct{}
+	mu    sync.Mutex
+	done  chan struct{}
+	once  sync.Once
+}
+
+func NewBus(logger logger.Logger) *Bus {
+	return &Bus{
+		subscriptions: make(map[*subscription]struct{}),
+		logger:        logger,
+	}
+}
+
+// Publish queues the event for every subscriber. It never blocks.
+func (b *Bus) Publish(event domain.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscriptions {
+		pending := sub.push(event)
+		if pending%backlogWarning == 0 {
+			b.logger.Errorf("subscriber is falling behind: %d events pending", pending)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events published from now on
+// and a function that cancels the subscription.
+func (b *Bus) Subscribe() (events <-chan domain.Event, unsubscribe func()) {
+	var sub = &subscription{
+		events: make(chan domain.Event),
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go sub.forward()
+
+	return sub.events, func() {
+		sub.once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscriptions, sub)
+			b.mu.Unlock()
+
+			close(sub.done)
+		})
+	}
+}
+
+// push queues the event and returns the number of pending events.
+func (s *subscription) push(event domain.Event) int {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	var pending = len(s.queue)
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+
+	return pending
+}
+
+// pop removes the oldest queued event, if any.
+func (s *subscription) pop() (event domain.Event, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return domain.Event{}, false
+	}
+
+	event = s.queue[0]
+	s.queue[0] = domain.Event{}
+	s.queue = s.queue[1:]
+
+	return event, true
+}
+
+// forward sends the queued events to the events channel until the subscription is cancelled.
+func (s *subscription) forward() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ready:
+		}
+
+		for event, ok := s.pop(); ok; event, ok = s.pop() {
+			select {
+			case <-s.done:
+				return
+			case s.events <- event:
+			}
+		}
+	}
+}
+
+// Listen subscribes to the bus and calls handle for every event until the context is done.
+// Errors returned by handle are logged.
+func (b *Bus) Listen(ctx context.Context, handle func(context.Context, domain.Event) error) {
+	events, unsubscribe := b.Subscribe()
+
+	go func() {
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				err := handle(ctx, event)
+				if err != nil {
+					b.logger.Errorf("failed to handle %s event: %v", event.Kind, err)
+				}
+			}
+		}
+	}()
+}
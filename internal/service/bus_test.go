@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	var (
+		bus                  = NewBus(mock.Logger{})
+		first, unsubscribe   = bus.Subscribe()
+		second, unsubscribe2 = bus.Subscribe()
+	)
+	defer unsubscribe2()
+
+	var published = []domain.Event{
+		domain.NewEvent(domain.EventBuildQueued, domain.Repository{Id: "0"}),
+		domain.NewEvent(domain.EventBuildStarted, domain.Repository{Id: "0"}),
+	}
+	for _, event := range published {
+		bus.Publish(event)
+	}
+
+	for _, events := range []<-chan domain.Event{first, second} {
+		for _, event := range published {
+			assert.Equal(t, event, <-events)
+		}
+	}
+
+	unsubscribe()
+	unsubscribe()
+
+	// Does not queue events for the unsubscribed channel.
+	for i := 0; i <= backlogWarning; i++ {
+		bus.Publish(published[0])
+		<-second
+	}
+	assert.Empty(t, first)
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	var (
+		bus                 = NewBus(mock.Logger{})
+		events, unsubscribe = bus.Subscribe()
+		published           = make(chan struct{})
+		count               = backlogWarning * 2
+	)
+	defer unsubscribe()
+
+	go func() {
+		for i := 0; i < count; i++ {
+			bus.Publish(domain.Event{Kind: domain.EventBuildQueued, Duration: time.Duration(i)})
+		}
+		close(published)
+	}()
+
+	// Publish does not wait for the subscriber to receive the events.
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish is blocked")
+	}
+
+	for i := 0; i < count; i++ {
+		require.Equal(t, time.Duration(i), (<-events).Duration, "no event is dropped or reordered")
+	}
+}
+
+func TestBus_Listen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		bus     = NewBus(mock.Logger{})
+		handled = make(chan domain.EventKind, 2)
+	)
+
+	bus.Listen(ctx, func(_ context.Context, event domain.Event) error {
+		handled <- event.Kind
+		return errors.New("ignored")
+	})
+
+	bus.Publish(domain.Event{Kind: domain.EventBuildStarted})
+	bus.Publish(domain.Event{Kind: domain.EventBuildFinished})
+
+	require.Equal(t, domain.EventBuildStarted, <-handled)
+	require.Equal(t, domain.EventBuildFinished, <-handled)
+}
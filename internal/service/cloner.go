@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/KirillMironov/ci/internal/domain"
@@ -8,15 +9,27 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	ErrBranchNotFound     = errors.New("branch not found")
-	ErrRepositoryNotFound = errors.New("repository not found")
-	ErrRevisionNotFound   = errors.New("revision not found")
+	ErrBranchNotFound      = errors.New("branch not found")
+	ErrPullRequestNotFound = errors.New("pull request not found")
+	ErrRepositoryNotFound  = errors.New("repository not found")
+	ErrRevisionNotFound    = errors.New("revision not found")
+	ErrTagNotFound         = errors.New("tag not found")
 )
 
+// listReferencesTimeout limits listing the references of a remote repository.
+const listReferencesTimeout = 10 * time.Second
+
 // Cloner used to clone source code repositories.
 type Cloner struct {
 	// Path to the directory where repositories are stored.
@@ -27,57 +40,215 @@ func NewCloner(repositoriesDir string) *Cloner {
 	return &Cloner{repositoriesDir: repositoriesDir}
 }
 
-// GetLatestCommitHash returns the hash of the latest commit in the given repository branch.
-func (Cloner) GetLatestCommitHash(repo domain.Repository) (string, error) {
-	var remote = git.NewRemote(nil, &config.RemoteConfig{URLs: []string{repo.URL}})
-	var targetReference = plumbing.NewBranchReferenceName(repo.Branch).String()
-
-	refs, err := remote.List(&git.ListOptions{})
+// GetLatestCommits returns the latest commit of every repository branch matching the repository branch patterns,
+// followed by the commits of the tags matching the repository tag patterns and, if pull requests are enabled,
+// the heads of pull requests (refs/pull/*/head) and merge requests (refs/merge-requests/*/head).
+func (Cloner) GetLatestCommits(repo domain.Repository) ([]domain.Commit, error) {
+	refs, peeled, err := listReferences(repo.URL)
 	if err != nil {
 		if errors.Is(err, transport.ErrRepositoryNotFound) {
-			return "", ErrRepositoryNotFound
+			return nil, ErrRepositoryNotFound
 		}
-		return "", err
+		return nil, err
 	}
 
+	var branches, tags, pullRequests []domain.Commit
+
 	for _, ref := range refs {
-		if ref.Name().String() == targetReference {
-			return ref.Hash().String(), nil
+		switch {
+		case ref.Name().IsBranch():
+			var branch = strings.TrimPrefix(ref.Name().String(), "refs/heads/")
+			if repo.Branches.Match(branch) {
+				branches = append(branches, domain.Commit{Hash: ref.Hash().String(), Branch: branch})
+			}
+		case ref.Name().IsTag():
+			var tag = strings.TrimPrefix(ref.Name().String(), "refs/tags/")
+			if !repo.Tags.Match(tag) {
+				continue
+			}
+			// Annotated tags point to the tag objects, the commits are advertised as <tag>^{}.
+			var hash = ref.Hash()
+			if commit, ok := peeled[ref.Name().String()]; ok {
+				hash = commit
+			}
+			tags = append(tags, domain.Commit{Hash: hash.String(), Tag: tag})
+		case repo.PullRequests:
+			if number, ok := parsePullRequestRef(ref.Name().String()); ok {
+				pullRequests = append(pullRequests, domain.Commit{
+					Hash:        ref.Hash().String(),
+					PullRequest: &domain.PullRequest{Number: number, Ref: ref.Name().String()},
+				})
+			}
 		}
 	}
 
-	return "", ErrBranchNotFound
+	if len(branches) == 0 {
+		return nil, ErrBranchNotFound
+	}
+
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].Branch < branches[j].Branch
+	})
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+	sort.Slice(pullRequests, func(i, j int) bool {
+		return pullRequests[i].PullRequest.Number < pullRequests[j].PullRequest.Number
+	})
+
+	return append(append(branches, tags...), pullRequests...), nil
 }
 
-// CloneRepository clones a repository and returns the local repository path.
-func (c Cloner) CloneRepository(repo domain.Repository, targetHash string) (srcCodePath string, err error) {
-	repository, srcCodePath, err := c.openOrCloneRepository(repo)
+// listReferences returns the references of the remote repository and the commits of its annotated tags by the tag
+// reference names. remote.List is not used since it drops the latter.
+func listReferences(url string) (refs []*plumbing.Reference, peeled map[string]plumbing.Hash, err error) {
+	endpoint, err := transport.NewEndpoint(url)
 	if err != nil {
-		return "", fmt.Errorf("failed to open or clone repository: %w", err)
+		return nil, nil, err
 	}
 
-	wt, err := repository.Worktree()
+	cli, err := client.NewClient(endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := cli.NewUploadPackSession(endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), listReferencesTimeout)
+	defer cancel()
+
+	advRefs, err := session.AdvertisedReferencesContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	storage, err := advRefs.AllReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iter, err := storage.IterReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+
+	return refs, advRefs.Peeled, err
+}
+
+// parsePullRequestRef returns the pull request number from a refs/pull/<number>/head
+// or refs/merge-requests/<number>/head reference name.
+func parsePullRequestRef(name string) (number int, ok bool) {
+	var parts = strings.Split(name, "/")
+	if len(parts) != 4 || parts[0] != "refs" || parts[3] != "head" {
+		return 0, false
+	}
+	if parts[1] != "pull" && parts[1] != "merge-requests" {
+		return 0, false
+	}
+
+	number, err := strconv.Atoi(parts[2])
+	if err != nil || number < 1 {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// CloneRepository clones a repository, checks out the given commit and returns the local repository path
+// and the commit author.
+func (c Cloner) CloneRepository(repo domain.Repository, commit domain.Commit) (srcCodePath string,
+	author domain.Author, err error) {
+	repository, srcCodePath, err := c.openOrCloneRepository(repo)
 	if err != nil {
-		return "", err
+		return "", domain.Author{}, fmt.Errorf("failed to open or clone repository: %w", err)
 	}
 
-	err = wt.Pull(&git.PullOptions{
-		ReferenceName: plumbing.NewBranchReferenceName(repo.Branch),
-		SingleBranch:  true,
+	refSpec, errNotFound := fetchRefSpec(commit)
+
+	err = repository.Fetch(&git.FetchOptions{
+		RefSpecs: []config.RefSpec{refSpec},
+		Force:    true,
 	})
-	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
-		return "", err
+	switch {
+	case errors.Is(err, git.NoMatchingRefSpecError{}):
+		return "", domain.Author{}, errNotFound
+	case err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate):
+		return "", domain.Author{}, err
+	}
+
+	wt, err := repository.Worktree()
+	if err != nil {
+		return "", domain.Author{}, err
 	}
 
-	revision, err := repository.ResolveRevision(plumbing.Revision(targetHash))
+	revision, err := repository.ResolveRevision(plumbing.Revision(commit.Hash))
 	if err != nil {
 		if errors.Is(err, plumbing.ErrReferenceNotFound) {
-			return "", ErrRevisionNotFound
+			return "", domain.Author{}, ErrRevisionNotFound
+		}
+		return "", domain.Author{}, err
+	}
+
+	commitObject, err := repository.CommitObject(*revision)
+	if err != nil {
+		return "", domain.Author{}, err
+	}
+
+	author = domain.Author{Name: commitObject.Author.Name, Email: commitObject.Author.Email}
+
+	return srcCodePath, author, wt.Checkout(&git.CheckoutOptions{Hash: *revision, Force: true})
+}
+
+// fetchRefSpec returns the refspec used to fetch the commit reference
+// and the error to return if the reference does not exist.
+func fetchRefSpec(commit domain.Commit) (config.RefSpec, error) {
+	if commit.PullRequest != nil {
+		var ref = plumbing.ReferenceName(commit.PullRequest.Ref)
+		return config.RefSpec(fmt.Sprintf("+%s:%s", ref, ref)), ErrPullRequestNotFound
+	}
+	if commit.Tag != "" {
+		var tag = plumbing.NewTagReferenceName(commit.Tag)
+		return config.RefSpec(fmt.Sprintf("+%s:%s", tag, tag)), ErrTagNotFound
+	}
+
+	var (
+		branch = plumbing.NewBranchReferenceName(commit.Branch)
+		remote = plumbing.NewRemoteReferenceName("origin", commit.Branch)
+	)
+	return config.RefSpec(fmt.Sprintf("+%s:%s", branch, remote)), ErrBranchNotFound
+}
+
+// Caches returns the ids of the repositories cloned to the repositories directory.
+func (c Cloner) Caches() (repoIds []string, err error) {
+	entries, err := os.ReadDir(c.repositoriesDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			repoIds = append(repoIds, entry.Name())
 		}
-		return "", err
 	}
 
-	return srcCodePath, wt.Checkout(&git.CheckoutOptions{Hash: *revision})
+	return repoIds, nil
+}
+
+// RemoveCache removes the local clone of the repository.
+func (c Cloner) RemoveCache(repoId string) error {
+	return os.RemoveAll(filepath.Join(c.repositoriesDir, repoId))
 }
 
 func (c Cloner) openOrCloneRepository(repo domain.Repository) (repository *git.Repository, localPath string, _ error) {
@@ -91,15 +262,12 @@ func (c Cloner) openOrCloneRepository(repo domain.Repository) (repository *git.R
 	if err != nil {
 		if errors.Is(err, git.ErrRepositoryNotExists) {
 			repository, err = git.PlainClone(localPath, false, &git.CloneOptions{
-				URL:           repo.URL,
-				ReferenceName: plumbing.NewBranchReferenceName(repo.Branch),
-				NoCheckout:    true,
+				URL:        repo.URL,
+				NoCheckout: true,
 			})
 			switch {
 			case errors.Is(err, transport.ErrRepositoryNotFound):
 				return nil, "", ErrRepositoryNotFound
-			case errors.Is(err, plumbing.ErrReferenceNotFound):
-				return nil, "", ErrBranchNotFound
 			case err != nil:
 				return nil, "", err
 			}
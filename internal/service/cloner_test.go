@@ -2,8 +2,16 @@ package service
 
 import (
 	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const (
@@ -12,26 +20,26 @@ const (
 	latestCommitHash = "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d"
 )
 
-func TestCloner_GetLatestCommitHash(t *testing.T) {
+func TestCloner_GetLatestCommits(t *testing.T) {
 	tests := map[string]struct {
-		repo               domain.Repository
-		expectedCommitHash string
-		expectedError      error
+		repo            domain.Repository
+		expectedCommits []domain.Commit
+		expectedError   error
 	}{
 		"success": {
-			repo:               domain.Repository{Id: "0", URL: url, Branch: branch},
-			expectedCommitHash: latestCommitHash,
-			expectedError:      nil,
+			repo:            domain.Repository{Id: "0", URL: url, Branches: pattern.List{branch}},
+			expectedCommits: []domain.Commit{{Hash: latestCommitHash, Branch: branch}},
+			expectedError:   nil,
 		},
 		"branch not found": {
-			repo:               domain.Repository{Id: "0", URL: url, Branch: "-"},
-			expectedCommitHash: "",
-			expectedError:      ErrBranchNotFound,
+			repo:            domain.Repository{Id: "0", URL: url, Branches: pattern.List{"-"}},
+			expectedCommits: nil,
+			expectedError:   ErrBranchNotFound,
 		},
 		"repository not found": {
-			repo:               domain.Repository{Id: "0", URL: "example.com", Branch: "main"},
-			expectedCommitHash: "",
-			expectedError:      ErrRepositoryNotFound,
+			repo:            domain.Repository{Id: "0", URL: "example.com", Branches: pattern.List{"main"}},
+			expectedCommits: nil,
+			expectedError:   ErrRepositoryNotFound,
 		},
 	}
 
@@ -39,38 +47,143 @@ func TestCloner_GetLatestCommitHash(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			var cloner = NewCloner(t.TempDir())
 
-			commitHash, err := cloner.GetLatestCommitHash(tc.repo)
+			commits, err := cloner.GetLatestCommits(tc.repo)
 
-			assert.Equal(t, tc.expectedCommitHash, commitHash)
+			assert.Equal(t, tc.expectedCommits, commits)
 			assert.ErrorIs(t, err, tc.expectedError)
 		})
 	}
 }
 
+func TestCloner_GetLatestCommits_Patterns(t *testing.T) {
+	var (
+		repoURL, hashes = newLocalRepository(t, "main", "release/1.0", "release/2.0", "feature")
+		cloner          = NewCloner(t.TempDir())
+		repo            = domain.Repository{Id: "0", URL: repoURL, Branches: pattern.List{"main", "release/*"}}
+	)
+
+	commits, err := cloner.GetLatestCommits(repo)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Commit{
+		{Hash: hashes["main"], Branch: "main"},
+		{Hash: hashes["release/1.0"], Branch: "release/1.0"},
+		{Hash: hashes["release/2.0"], Branch: "release/2.0"},
+	}, commits)
+
+	for _, commit := range commits {
+		srcCodePath, author, err := cloner.CloneRepository(repo, commit)
+		require.NoError(t, err)
+		assert.Equal(t, domain.Author{Name: "ci", Email: "ci@example.com"}, author)
+
+		data, err := os.ReadFile(filepath.Join(srcCodePath, "branch"))
+		require.NoError(t, err)
+		assert.Equal(t, commit.Branch, string(data))
+	}
+}
+
+func TestCloner_GetLatestCommits_Tags(t *testing.T) {
+	var (
+		repoURL, hashes = newLocalRepository(t, "main")
+		cloner          = NewCloner(t.TempDir())
+		repo            = domain.Repository{Id: "0", URL: repoURL, Branches: pattern.List{"main"},
+			Tags: pattern.List{"v*"}}
+	)
+
+	repository, err := git.PlainOpen(repoURL)
+	require.NoError(t, err)
+
+	for _, tag := range []string{"v1.0.0", "nightly"} {
+		_, err = repository.CreateTag(tag, plumbing.NewHash(hashes["main"]), nil)
+		require.NoError(t, err)
+	}
+
+	annotated, err := repository.CreateTag("v1.1.0", plumbing.NewHash(hashes["main"]), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "ci", Email: "ci@example.com", When: time.Now()},
+		Message: "v1.1.0",
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, hashes["main"], annotated.Hash().String())
+
+	commits, err := cloner.GetLatestCommits(repo)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Commit{
+		{Hash: hashes["main"], Branch: "main"},
+		{Hash: hashes["main"], Tag: "v1.0.0"},
+		{Hash: hashes["main"], Tag: "v1.1.0"},
+	}, commits)
+
+	for _, commit := range commits[1:] {
+		srcCodePath, _, err := cloner.CloneRepository(repo, commit)
+		require.NoError(t, err)
+		assert.DirExists(t, srcCodePath)
+	}
+
+	_, _, err = cloner.CloneRepository(repo, domain.Commit{Hash: hashes["main"], Tag: "v2.0.0"})
+	assert.ErrorIs(t, err, ErrTagNotFound)
+}
+
+func TestCloner_GetLatestCommits_PullRequests(t *testing.T) {
+	var (
+		repoURL, hashes = newLocalRepository(t, "main", "feature")
+		cloner          = NewCloner(t.TempDir())
+		repo            = domain.Repository{Id: "0", URL: repoURL, Branches: pattern.List{"main"}, PullRequests: true}
+	)
+
+	repository, err := git.PlainOpen(repoURL)
+	require.NoError(t, err)
+
+	for _, ref := range []string{"refs/pull/2/head", "refs/merge-requests/1/head", "refs/pull/3/merge"} {
+		err = repository.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(ref),
+			plumbing.NewHash(hashes["feature"])))
+		require.NoError(t, err)
+	}
+
+	commits, err := cloner.GetLatestCommits(repo)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Commit{
+		{Hash: hashes["main"], Branch: "main"},
+		{Hash: hashes["feature"], PullRequest: &domain.PullRequest{Number: 1, Ref: "refs/merge-requests/1/head"}},
+		{Hash: hashes["feature"], PullRequest: &domain.PullRequest{Number: 2, Ref: "refs/pull/2/head"}},
+	}, commits)
+
+	srcCodePath, _, err := cloner.CloneRepository(repo, commits[2])
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(srcCodePath, "branch"))
+	require.NoError(t, err)
+	assert.Equal(t, "feature", string(data))
+
+	repo.PullRequests = false
+
+	commits, err = cloner.GetLatestCommits(repo)
+	require.NoError(t, err)
+	assert.Len(t, commits, 1)
+}
+
 func TestCloner_CloneRepository(t *testing.T) {
 	tests := map[string]struct {
 		repo          domain.Repository
-		targetHash    string
+		commit        domain.Commit
 		expectedError error
 	}{
 		"success": {
-			repo:          domain.Repository{Id: "0", URL: url, Branch: branch},
-			targetHash:    latestCommitHash,
+			repo:          domain.Repository{Id: "0", URL: url},
+			commit:        domain.Commit{Hash: latestCommitHash, Branch: branch},
 			expectedError: nil,
 		},
 		"revision not found": {
-			repo:          domain.Repository{Id: "0", URL: url, Branch: branch},
-			targetHash:    "-",
+			repo:          domain.Repository{Id: "0", URL: url},
+			commit:        domain.Commit{Hash: "-", Branch: branch},
 			expectedError: ErrRevisionNotFound,
 		},
 		"branch not found": {
-			repo:          domain.Repository{Id: "0", URL: url, Branch: "-"},
-			targetHash:    latestCommitHash,
+			repo:          domain.Repository{Id: "0", URL: url},
+			commit:        domain.Commit{Hash: latestCommitHash, Branch: "-"},
 			expectedError: ErrBranchNotFound,
 		},
 		"repository not found": {
-			repo:          domain.Repository{Id: "0", URL: "example.com", Branch: "main"},
-			targetHash:    latestCommitHash,
+			repo:          domain.Repository{Id: "0", URL: "example.com"},
+			commit:        domain.Commit{Hash: latestCommitHash, Branch: "main"},
 			expectedError: ErrRepositoryNotFound,
 		},
 	}
@@ -79,7 +192,7 @@ func TestCloner_CloneRepository(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			var cloner = NewCloner(t.TempDir())
 
-			srcCodePath, err := cloner.CloneRepository(tc.repo, tc.targetHash)
+			srcCodePath, _, err := cloner.CloneRepository(tc.repo, tc.commit)
 			assert.ErrorIs(t, err, tc.expectedError)
 
 			if tc.expectedError == nil {
@@ -90,3 +203,44 @@ func TestCloner_CloneRepository(t *testing.T) {
 		})
 	}
 }
+
+// newLocalRepository creates a local repository with a commit on each of the given branches.
+// Every commit contains a file named "branch" with the branch name.
+func newLocalRepository(t *testing.T, branches ...string) (path string, hashes map[string]string) {
+	t.Helper()
+
+	path = t.TempDir()
+	hashes = make(map[string]string)
+
+	repository, err := git.PlainInit(path, false)
+	require.NoError(t, err)
+
+	err = repository.Storer.SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(branches[0])))
+	require.NoError(t, err)
+
+	wt, err := repository.Worktree()
+	require.NoError(t, err)
+
+	for i, name := range branches {
+		if i > 0 {
+			err = wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(name), Create: true})
+			require.NoError(t, err)
+		}
+
+		err = os.WriteFile(filepath.Join(path, "branch"), []byte(name), 0644)
+		require.NoError(t, err)
+
+		_, err = wt.Add("branch")
+		require.NoError(t, err)
+
+		hash, err := wt.Commit(name, &git.CommitOptions{
+			Author: &object.Signature{Name: "ci", Email: "ci@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+
+		hashes[name] = hash.String()
+	}
+
+	return path, hashes
+}
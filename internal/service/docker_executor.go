@@ -1,43 +1,83 @@
 package service
 
 import (
+	"archive/tar"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/logger"
+	"github.com/KirillMironov/ci/pkg/pattern"
 	"github.com/docker/docker/api/types"
 	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"io"
 	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
 )
 
+// containerLabel marks the containers running steps.
+const containerLabel = "ci.step"
+
 // DockerExecutor used to execute a step in a container.
 type DockerExecutor struct {
 	cli *client.Client
 	// Container working directory.
 	workingDir string
 	archiver   archiver
+	store      artifactStore
+	cache      stepCache
+	observer   imagePullObserver
+	logger     logger.Logger
 }
 
-type archiver interface {
-	Compress(dir string) (archivePath string, removeArchive func(), err error)
-}
+type (
+	archiver interface {
+		Compress(dir string) (archivePath string, removeArchive func(), err error)
+		Append(tw *tar.Writer, dir string, archive io.Reader) error
+	}
+	artifactStore interface {
+		Put(io.Reader) (checksum string, size int64, err error)
+	}
+	stepCache interface {
+		Key(template, srcCodePath string) (string, error)
+		Restore(scope domain.CacheScope, key string, restoreKeys []string) (archive io.ReadCloser,
+			restoredKey string, err error)
+		Save(scope domain.CacheScope, key string, write func(io.Writer) error) error
+	}
+	imagePullObserver interface {
+		ObserveImagePull(image string, duration time.Duration)
+	}
+)
 
 // NewDockerExecutor creates a new DockerExecutor with a provided docker client.
-func NewDockerExecutor(cli *client.Client, workingDir string, archiver archiver) *DockerExecutor {
+func NewDockerExecutor(cli *client.Client, workingDir string, archiver archiver, store artifactStore,
+	cache stepCache, observer imagePullObserver, logger logger.Logger) *DockerExecutor {
 	return &DockerExecutor{
 		cli:        cli,
 		workingDir: workingDir,
 		archiver:   archiver,
+		store:      store,
+		cache:      cache,
+		observer:   observer,
+		logger:     logger,
 	}
 }
 
 // ExecuteStep copies the source code to the container, executes the step and returns container logs.
+// Once the step exits, the step artifacts are collected, even if it failed.
+// The step cache is restored before the step and saved after it succeeds, unless it was restored under the same key
+// or its scope is read-only.
+// A cache failure is logged and does not fail the step.
 func (de DockerExecutor) ExecuteStep(ctx context.Context, step domain.Step, srcCodePath string) (logs io.ReadCloser,
-	err error) {
+	artifacts []domain.Artifact, err error) {
 	archive, removeArchive, err := de.srcCodeToArchive(srcCodePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer removeArchive()
 	defer archive.Close()
@@ -49,28 +89,38 @@ func (de DockerExecutor) ExecuteStep(ctx context.Context, step domain.Step, srcC
 		Cmd:        step.Args,
 		Tty:        true,
 		WorkingDir: de.workingDir,
+		Labels:     map[string]string{containerLabel: step.Name},
 	}
 
+	var pullStart = time.Now()
+
 	pullLogs, err := de.cli.ImagePull(ctx, config.Image, types.ImagePullOptions{})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer pullLogs.Close()
 	_, _ = io.Copy(io.Discard, pullLogs)
 
+	de.observer.ObserveImagePull(config.Image, time.Since(pullStart))
+
 	container, err := de.cli.ContainerCreate(ctx, config, nil, nil, nil, "")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = de.cli.CopyToContainer(ctx, container.ID, de.workingDir, archive, types.CopyToContainerOptions{})
 	if err != nil {
-		return logs, err
+		return logs, nil, err
+	}
+
+	cacheKey, restoredKey, err := de.restoreCache(ctx, container.ID, step.Cache, srcCodePath)
+	if err != nil {
+		return logs, nil, err
 	}
 
 	err = de.cli.ContainerStart(ctx, container.ID, types.ContainerStartOptions{})
 	if err != nil {
-		return logs, err
+		return logs, nil, err
 	}
 
 	logs, err = de.cli.ContainerLogs(ctx, container.ID, types.ContainerLogsOptions{
@@ -78,23 +128,252 @@ func (de DockerExecutor) ExecuteStep(ctx context.Context, step domain.Step, srcC
 		ShowStderr: true,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	resultCh, errCh := de.cli.ContainerWait(ctx, container.ID, containertypes.WaitConditionNotRunning)
 	select {
 	case err = <-errCh:
-		return logs, err
+		return logs, nil, err
 	case result := <-resultCh:
-		switch {
-		case result.Error != nil:
-			return logs, errors.New(result.Error.Message)
-		case result.StatusCode != 0:
-			return logs, domain.ExitError{Code: result.StatusCode}
-		default:
-			return logs, nil
+		if result.Error != nil {
+			return logs, nil, errors.New(result.Error.Message)
+		}
+
+		// The reports are collected as artifacts, so they are parsed from the store.
+		var patterns = append(append(append(pattern.List{}, step.Artifacts...), step.Reports.JUnit...),
+			step.Reports.Coverage...)
+
+		artifacts, err = de.collectArtifacts(ctx, container.ID, patterns)
+
+		// The exit code takes precedence, so a failed step is not retried as an infrastructure error.
+		if result.StatusCode != 0 {
+			if err != nil {
+				de.logger.Errorf("failed to collect artifacts of step %q: %v", step.Name, err)
+			}
+			return logs, artifacts, domain.ExitError{Code: result.StatusCode}
+		}
+
+		if err != nil {
+			return logs, artifacts, fmt.Errorf("failed to collect artifacts: %w", err)
+		}
+
+		if cacheKey != "" && cacheKey != restoredKey && !step.Cache.Scope.ReadOnly {
+			err = de.saveCache(ctx, container.ID, cacheKey, step.Cache)
+			if err != nil {
+				de.logger.Errorf("failed to save cache %s of step %q: %v", cacheKey, step.Name, err)
+			}
+		}
+		return logs, artifacts, nil
+	}
+}
+
+// collectArtifacts copies the files of the container working directory matching the patterns to the store.
+// Only the directories the patterns are rooted in are copied from the container.
+func (de DockerExecutor) collectArtifacts(ctx context.Context, containerId string,
+	patterns pattern.List) (artifacts []domain.Artifact, err error) {
+	var workingDir = path.Clean(de.workingDir)
+
+	for _, root := range artifactRoots(patterns) {
+		var src = path.Join(workingDir, root)
+		if src != workingDir && !strings.HasPrefix(src, workingDir+"/") {
+			continue
+		}
+
+		var collected []domain.Artifact
+
+		collected, err = de.collectArtifactsFrom(ctx, containerId, src, patterns)
+		artifacts = append(artifacts, collected...)
+		if client.IsErrNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return artifacts, err
+		}
+	}
+
+	return artifacts, nil
+}
+
+// collectArtifactsFrom copies the files of the container path matching the patterns to the store.
+func (de DockerExecutor) collectArtifactsFrom(ctx context.Context, containerId, src string,
+	patterns pattern.List) (artifacts []domain.Artifact, err error) {
+	content, _, err := de.cli.CopyFromContainer(ctx, containerId, src)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	var (
+		reader = tar.NewReader(content)
+		prefix = path.Clean(de.workingDir) + "/"
+	)
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return artifacts, nil
+		}
+		if err != nil {
+			return artifacts, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// The entries are named relative to the parent of the copied path.
+		var name = strings.TrimPrefix(path.Join(path.Dir(src), header.Name), prefix)
+		if !matchArtifact(patterns, name) {
+			continue
+		}
+
+		checksum, size, err := de.store.Put(reader)
+		if err != nil {
+			return artifacts, err
+		}
+
+		artifacts = append(artifacts, domain.Artifact{Path: name, Size: size, Checksum: checksum})
+	}
+}
+
+// artifactRoots returns the paths the patterns are rooted in, relative to the working directory: the leading
+// elements of every pattern without wildcards. The paths nested in others are omitted, an empty path stands
+// for the whole working directory.
+func artifactRoots(patterns pattern.List) (roots []string) {
+	var candidates []string
+
+	for _, p := range patterns {
+		var elems []string
+		for _, elem := range strings.Split(path.Clean(p), "/") {
+			if strings.ContainsAny(elem, `*?[\`) {
+				break
+			}
+			elems = append(elems, elem)
+		}
+		var root = path.Join(elems...)
+		if root == "." {
+			root = ""
+		}
+		candidates = append(candidates, root)
+	}
+
+	sort.Strings(candidates)
+
+	for _, candidate := range candidates {
+		var nested bool
+		for _, root := range roots {
+			if root == "" || candidate == root || strings.HasPrefix(candidate, root+"/") {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			roots = append(roots, candidate)
+		}
+	}
+
+	return roots
+}
+
+// restoreCache evaluates the cache key and copies the cache saved under it or under a restore key to the container.
+// It returns the evaluated key and the key of the restored cache, if any.
+func (de DockerExecutor) restoreCache(ctx context.Context, containerId string, cache domain.Cache,
+	srcCodePath string) (key, restoredKey string, err error) {
+	if !cache.Enabled() {
+		return "", "", nil
+	}
+
+	key, err = de.cache.Key(cache.Key, srcCodePath)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid cache key: %w", err)
+	}
+
+	archive, restoredKey, err := de.cache.Restore(cache.Scope, key, cache.RestoreKeys)
+	if errors.Is(err, ErrCacheMiss) {
+		return key, "", nil
+	}
+	if err != nil {
+		de.logger.Errorf("failed to restore cache %s: %v", key, err)
+		return key, "", nil
+	}
+	defer archive.Close()
+
+	// The archive entries are named after the absolute paths of the cached files.
+	err = de.cli.CopyToContainer(ctx, containerId, "/", archive, types.CopyToContainerOptions{})
+	if err != nil {
+		de.logger.Errorf("failed to restore cache %s: %v", key, err)
+		return key, "", nil
+	}
+
+	return key, restoredKey, nil
+}
+
+// saveCache saves the container directories of the cache under the key. The missing directories are skipped.
+func (de DockerExecutor) saveCache(ctx context.Context, containerId, key string, cache domain.Cache) error {
+	return de.cache.Save(cache.Scope, key, func(w io.Writer) error {
+		var tw = tar.NewWriter(w)
+
+		for _, p := range cache.Paths {
+			if !path.IsAbs(p) {
+				p = path.Join(de.workingDir, p)
+			}
+
+			err := de.appendContainerDir(ctx, tw, containerId, path.Clean(p))
+			if client.IsErrNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
 		}
+
+		return tw.Close()
+	})
+}
+
+// appendContainerDir writes the container directory to tw, naming the entries after their absolute paths.
+func (de DockerExecutor) appendContainerDir(ctx context.Context, tw *tar.Writer, containerId, dir string) error {
+	content, _, err := de.cli.CopyFromContainer(ctx, containerId, dir)
+	if err != nil {
+		return err
 	}
+	defer content.Close()
+
+	// The entries are prefixed with the name of the directory.
+	return de.archiver.Append(tw, strings.TrimPrefix(path.Dir(dir), "/"), content)
+}
+
+// matchArtifact reports whether the file or any of its parent directories matches the patterns.
+func matchArtifact(patterns pattern.List, name string) bool {
+	for ; name != "." && name != "/"; name = path.Dir(name) {
+		if patterns.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prune removes the stopped step containers, then the images not used by any container.
+// It returns the ids of the removed containers, the references of the removed images and the reclaimed disk space.
+func (de DockerExecutor) Prune(ctx context.Context) (containers, images []string, spaceReclaimed uint64, err error) {
+	containersReport, err := de.cli.ContainersPrune(ctx, filters.NewArgs(filters.Arg("label", containerLabel)))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	imagesReport, err := de.cli.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", "false")))
+	if err != nil {
+		return containersReport.ContainersDeleted, nil, containersReport.SpaceReclaimed, err
+	}
+
+	for _, image := range imagesReport.ImagesDeleted {
+		if image.Untagged != "" {
+			images = append(images, image.Untagged)
+		}
+	}
+
+	return containersReport.ContainersDeleted, images, containersReport.SpaceReclaimed + imagesReport.SpaceReclaimed,
+		nil
 }
 
 func (de DockerExecutor) srcCodeToArchive(srcCodePath string) (io.ReadCloser, func(), error) {
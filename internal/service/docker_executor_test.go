@@ -5,6 +5,9 @@ package service
 import (
 	"context"
 	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/cas"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/KirillMironov/ci/pkg/pattern"
 	"github.com/docker/docker/client"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,12 +19,18 @@ func TestDockerExecutor_ExecuteStep(t *testing.T) {
 	cli, err := client.NewClientWithOpts()
 	require.NoError(t, err)
 
-	var executor = NewDockerExecutor(cli, "/ci", &TarArchiver{})
+	var (
+		scope    = domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/main"}}
+		cache    = NewStepCache(t.TempDir(), 1<<30, 1<<30)
+		executor = NewDockerExecutor(cli, "/ci", &TarArchiver{}, cas.New(t.TempDir()), cache, NewMetrics(),
+			mock.Logger{})
+	)
 
 	tests := map[string]struct {
-		step          domain.Step
-		expectedLogs  string
-		expectedError error
+		step              domain.Step
+		expectedLogs      string
+		expectedArtifacts []string
+		expectedError     error
 	}{
 		"success": {
 			step: domain.Step{
@@ -44,15 +53,74 @@ func TestDockerExecutor_ExecuteStep(t *testing.T) {
 			expectedLogs:  "hello\r\n",
 			expectedError: domain.ExitError{Code: 1},
 		},
+		"cache saved": {
+			step: domain.Step{
+				Name:    "cache",
+				Image:   "busybox:1.35",
+				Command: []string{"/bin/sh", "-c"},
+				Args:    []string{"mkdir -p /deps && echo dep > /deps/dep"},
+				Cache:   domain.Cache{Key: "deps", Paths: []string{"/deps"}, Scope: scope},
+			},
+			expectedLogs:  "",
+			expectedError: nil,
+		},
+		"artifacts": {
+			step: domain.Step{
+				Name:      "artifacts",
+				Image:     "busybox:1.35",
+				Command:   []string{"/bin/sh", "-c"},
+				Args:      []string{"mkdir -p bin && echo app > bin/app && echo 1 > c.out && echo 2 > other; exit 1"},
+				Artifacts: pattern.List{"bin", "*.out"},
+			},
+			expectedLogs:      "",
+			expectedArtifacts: []string{"bin/app", "c.out"},
+			expectedError:     domain.ExitError{Code: 1},
+		},
+		"nested artifacts": {
+			step: domain.Step{
+				Name:    "reports",
+				Image:   "busybox:1.35",
+				Command: []string{"/bin/sh", "-c"},
+				Args: []string{"mkdir -p reports/unit && echo 1 > reports/unit/a.xml && echo 2 > reports/b.txt && " +
+					"echo 3 > c.xml"},
+				Reports: domain.Reports{JUnit: pattern.List{"reports/*/*.xml", "reports/unit/a.xml", "missing/*.xml"}},
+			},
+			expectedLogs:      "",
+			expectedArtifacts: []string{"reports/unit/a.xml"},
+			expectedError:     nil,
+		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			logs, err := executor.ExecuteStep(context.Background(), tc.step, t.TempDir())
+			logs, artifacts, err := executor.ExecuteStep(context.Background(), tc.step, t.TempDir())
 			assert.ErrorIs(t, err, tc.expectedError)
 
+			var paths []string
+			for _, artifact := range artifacts {
+				paths = append(paths, artifact.Path)
+			}
+			assert.ElementsMatch(t, tc.expectedArtifacts, paths)
+
 			data, _ := io.ReadAll(logs)
 			assert.Equal(t, tc.expectedLogs, string(data))
 		})
 	}
+
+	t.Run("cache restored", func(t *testing.T) {
+		var step = domain.Step{
+			Name:    "restore",
+			Image:   "busybox:1.35",
+			Command: []string{"/bin/sh", "-c"},
+			Args:    []string{"cat /deps/dep"},
+			Cache: domain.Cache{Key: "deps-v2", RestoreKeys: []string{"deps"}, Paths: []string{"/deps"},
+				Scope: scope},
+		}
+
+		logs, _, err := executor.ExecuteStep(context.Background(), step, t.TempDir())
+		require.NoError(t, err)
+
+		data, _ := io.ReadAll(logs)
+		assert.Equal(t, "dep\r\n", string(data))
+	})
 }
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"embed"
+	"fmt"
+	"github.com/KirillMironov/ci/internal/domain"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// logTailLines is the number of the failed step log lines included in emails.
+const logTailLines = 20
+
+var (
+	//go:embed templates/email.txt templates/email.html
+	emailTemplates embed.FS
+
+	emailTextTemplate = template.Must(template.ParseFS(emailTemplates, "templates/email.txt"))
+	emailHTMLTemplate = htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "templates/email.html"))
+)
+
+// SMTPServer is the server used to send emails.
+type SMTPServer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// EmailNotifier used to email the commit author and repository watchers when a build breaks or gets fixed.
+type EmailNotifier struct {
+	server          SMTPServer
+	externalURL     string
+	watchersStorage domain.WatchersStorage
+	timeout         time.Duration
+}
+
+// emailData is the data passed to the email templates.
+type emailData struct {
+	Fixed      bool
+	Repository domain.Repository
+	Build      domain.Build
+	Ref        string
+	BuildURL   string
+	FailedStep *domain.StepAttempt
+	LogTail    string
+}
+
+func NewEmailNotifier(server SMTPServer, externalURL string, ws domain.WatchersStorage) *EmailNotifier {
+	return &EmailNotifier{
+		server:          server,
+		externalURL:     strings.TrimSuffix(externalURL, "/"),
+		watchersStorage: ws,
+		timeout:         time.Second * 30,
+	}
+}
+
+// Notify emails the commit author and repository watchers on broken and fixed events, other events are ignored.
+// It does nothing if the SMTP server is not configured.
+func (en EmailNotifier) Notify(repo domain.Repository, build domain.Build, events ...domain.NotificationEvent) error {
+	if en.server.Host == "" {
+		return nil
+	}
+
+	var fixed, broken bool
+	for _, event := range events {
+		fixed = fixed || event == domain.EventFixed
+		broken = broken || event == domain.EventBroken
+	}
+	if !fixed && !broken {
+		return nil
+	}
+
+	recipients, err := en.recipients(repo, build)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var data = emailData{
+		Fixed:      fixed,
+		Repository: repo,
+		Build:      build,
+		Ref:        ref(build.Commit),
+		BuildURL:   fmt.Sprintf("%s/api/v1/repositories/%s/builds/%s", en.externalURL, repo.Id, build.Id),
+		FailedStep: failedStep(build),
+	}
+	if data.FailedStep != nil {
+		data.LogTail = tail(data.FailedStep.Log.Data, logTailLines)
+	}
+
+	var text, html bytes.Buffer
+
+	err = emailTextTemplate.Execute(&text, data)
+	if err != nil {
+		return err
+	}
+
+	err = emailHTMLTemplate.Execute(&html, data)
+	if err != nil {
+		return err
+	}
+
+	var subject = "[ci] Broken: "
+	if fixed {
+		subject = "[ci] Fixed: "
+	}
+	subject += repo.URL
+	if data.Ref != "" {
+		subject += " (" + data.Ref + ")"
+	}
+
+	msg, err := en.message(recipients, subject, text.Bytes(), html.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return en.send(recipients, msg)
+}
+
+// recipients returns the commit author and repository watchers emails without duplicates.
+func (en EmailNotifier) recipients(repo domain.Repository, build domain.Build) (recipients []string, _ error) {
+	watchers, err := en.watchersStorage.GetAllByRepoId(repo.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		emails []string
+		seen   = make(map[string]bool)
+	)
+	if author := build.Commit.Author; author != nil && author.Email != "" {
+		emails = append(emails, author.Email)
+	}
+	for _, watcher := range watchers {
+		emails = append(emails, watcher.Email)
+	}
+
+	for _, email := range emails {
+		if seen[strings.ToLower(email)] {
+			continue
+		}
+		seen[strings.ToLower(email)] = true
+		recipients = append(recipients, email)
+	}
+
+	return recipients, nil
+}
+
+// message returns a multipart message with plain-text and HTML alternatives.
+func (en EmailNotifier) message(to []string, subject string, text, html []byte) ([]byte, error) {
+	var (
+		body bytes.Buffer
+		mw   = multipart.NewWriter(&body)
+	)
+
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(w)
+		_, err = qw.Write(part.data)
+		if err != nil {
+			return nil, err
+		}
+		err = qw.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+
+	fmt.Fprintf(&msg, "From: %s\r\n", en.server.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// send sends the message, using STARTTLS if the server supports it.
+func (en EmailNotifier) send(to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(en.server.Host, en.server.Port), en.timeout)
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetDeadline(time.Now().Add(en.timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, en.server.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: en.server.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if en.server.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", en.server.Username, en.server.Password, en.server.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(en.server.From)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		err = client.Rcpt(addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// ref returns a human-readable name of the commit branch, tag or pull request.
+func ref(commit domain.Commit) string {
+	switch {
+	case commit.PullRequest != nil:
+		return fmt.Sprintf("pull request #%d", commit.PullRequest.Number)
+	case commit.Tag != "":
+		return "tag " + commit.Tag
+	default:
+		return commit.Branch
+	}
+}
+
+// failedStep returns the last attempt of the step the build failed on.
+func failedStep(build domain.Build) *domain.StepAttempt {
+	for i := len(build.Steps) - 1; i >= 0; i-- {
+		if build.Steps[i].Status == domain.Failure {
+			return &build.Steps[i]
+		}
+	}
+	return nil
+}
+
+// tail returns the last n lines of s.
+func tail(s string, n int) string {
+	var lines = strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
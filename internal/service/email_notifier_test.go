@@ -0,0 +1,193 @@
+package service
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailNotifier_Notify(t *testing.T) {
+	var (
+		repo  = domain.Repository{Id: "0", URL: "https://github.com/owner/name"}
+		build = domain.Build{
+			Id:     "1",
+			Number: 7,
+			Commit: domain.Commit{
+				Hash:   "abc",
+				Branch: "main",
+				Author: &domain.Author{Name: "Author", Email: "author@example.com"},
+			},
+			Status: domain.Failure,
+			Steps: []domain.StepAttempt{
+				{Step: "build", Attempt: 1, Status: domain.Success},
+				{Step: "test", Attempt: 1, Status: domain.Failure, Error: "exit code 1",
+					Log: domain.Log{Data: strings.Repeat("passed\n", 30) + "FAIL: <TestNotify>\n"}},
+			},
+		}
+		server, mails = newFakeSMTPServer(t)
+		watchers      = mock.NewWatchers()
+		notifier      = NewEmailNotifier(server, "http://ci", watchers)
+	)
+
+	require.NoError(t, watchers.Create(domain.Watcher{RepoId: repo.Id, Email: "watcher@example.com"}))
+	require.NoError(t, watchers.Create(domain.Watcher{RepoId: repo.Id, Email: "Author@example.com"}))
+
+	t.Run("ignored events", func(t *testing.T) {
+		err := notifier.Notify(repo, build, domain.EventStarted, domain.EventFailed)
+		require.NoError(t, err)
+		assert.Empty(t, mails)
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		err := notifier.Notify(repo, build, domain.EventFailed, domain.EventBroken)
+		require.NoError(t, err)
+
+		m := <-mails
+		assert.Equal(t, "ci@example.com", m.from)
+		assert.Equal(t, []string{"author@example.com", "watcher@example.com"}, m.to)
+
+		msg, err := mail.ReadMessage(strings.NewReader(m.data))
+		require.NoError(t, err)
+		assert.Equal(t, "[ci] Broken: https://github.com/owner/name (main)", msg.Header.Get("Subject"))
+
+		text, html := readAlternatives(t, msg)
+		assert.Contains(t, text, "#7 http://ci/api/v1/repositories/0/builds/1")
+		assert.Contains(t, text, "Author <author@example.com>")
+		assert.Contains(t, text, `Step "test" failed: exit code 1`)
+		assert.Contains(t, text, "FAIL: <TestNotify>")
+		assert.Equal(t, logTailLines-1, strings.Count(text, "passed"))
+		assert.Contains(t, html, `<a href="http://ci/api/v1/repositories/0/builds/1">#7</a>`)
+		assert.Contains(t, html, "FAIL: &lt;TestNotify&gt;")
+	})
+
+	t.Run("fixed", func(t *testing.T) {
+		var fixedBuild = build
+		fixedBuild.Status = domain.Success
+		fixedBuild.Steps = nil
+
+		err := notifier.Notify(repo, fixedBuild, domain.EventSucceeded, domain.EventFixed)
+		require.NoError(t, err)
+
+		m := <-mails
+		msg, err := mail.ReadMessage(strings.NewReader(m.data))
+		require.NoError(t, err)
+		assert.Equal(t, "[ci] Fixed: https://github.com/owner/name (main)", msg.Header.Get("Subject"))
+
+		text, _ := readAlternatives(t, msg)
+		assert.NotContains(t, text, "failed")
+	})
+}
+
+func readAlternatives(t *testing.T, msg *mail.Message) (text, html string) {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	var mr = multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return text, html
+		}
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(data)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(data)
+		}
+	}
+}
+
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// newFakeSMTPServer starts an SMTP server accepting any mail and sending it to the returned channel.
+func newFakeSMTPServer(t *testing.T) (SMTPServer, chan fakeMail) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	var mails = make(chan fakeMail, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	return SMTPServer{Host: host, Port: port, From: "ci@example.com"}, mails
+}
+
+func serveSMTP(conn net.Conn, mails chan<- fakeMail) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second * 5))
+
+	var (
+		tp = textproto.NewConn(conn)
+		m  fakeMail
+	)
+
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		var command = strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250 localhost")
+		case "MAIL":
+			m.from = strings.Trim(strings.TrimPrefix(line[len("MAIL "):], "FROM:"), "<>")
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = append(m.to, strings.Trim(strings.TrimPrefix(line[len("RCPT "):], "TO:"), "<>"))
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			mails <- m
+			m = fakeMail{}
+			_ = tp.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 OK")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout is the maximum duration of a single health check.
+const checkTimeout = time.Second * 2
+
+var errNotRunning = errors.New("not running")
+
+// Health used to run readiness checks.
+type Health struct {
+	checks []Check
+}
+
+// Check is a named readiness check.
+type Check struct {
+	Name  string
+	Check func(context.Context) error
+}
+
+func NewHealth(checks ...Check) *Health {
+	return &Health{checks: checks}
+}
+
+// Check runs all checks concurrently and returns their errors by name, nil for the passed ones.
+// ok reports whether all checks passed.
+func (h Health) Check(ctx context.Context) (results map[string]error, ok bool) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	results = make(map[string]error, len(h.checks))
+	ok = true
+
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			err := check.Check(checkCtx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[check.Name] = err
+			ok = ok && err == nil
+		}(check)
+	}
+
+	wg.Wait()
+
+	return results, ok
+}
+
+// AliveCheck returns a check that fails if the service loop is not running.
+func AliveCheck(service interface{ Alive() bool }) func(context.Context) error {
+	return func(context.Context) error {
+		if !service.Alive() {
+			return errNotRunning
+		}
+		return nil
+	}
+}
+
+// WritableDirCheck returns a check that fails if a file cannot be created in the directory.
+func WritableDirCheck(dir string) func(context.Context) error {
+	return func(context.Context) error {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		file.Close()
+
+		return os.Remove(file.Name())
+	}
+}
+
+// liveness tracks whether a service loop is running.
+type liveness struct {
+	running int32
+}
+
+// Alive reports whether the service loop is running.
+func (l *liveness) Alive() bool {
+	return atomic.LoadInt32(&l.running) == 1
+}
+
+// start marks the service loop as running and returns a function marking it as stopped.
+func (l *liveness) start() (stop func()) {
+	atomic.StoreInt32(&l.running, 1)
+	return func() {
+		atomic.StoreInt32(&l.running, 0)
+	}
+}
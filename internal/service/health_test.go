@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealth_Check(t *testing.T) {
+	var errFailed = errors.New("failed")
+
+	tests := map[string]struct {
+		checks          []Check
+		expectedResults map[string]error
+		expectedOk      bool
+	}{
+		"ok": {
+			checks: []Check{
+				{Name: "a", Check: func(context.Context) error { return nil }},
+				{Name: "b", Check: func(context.Context) error { return nil }},
+			},
+			expectedResults: map[string]error{"a": nil, "b": nil},
+			expectedOk:      true,
+		},
+		"failed": {
+			checks: []Check{
+				{Name: "a", Check: func(context.Context) error { return nil }},
+				{Name: "b", Check: func(context.Context) error { return errFailed }},
+			},
+			expectedResults: map[string]error{"a": nil, "b": errFailed},
+			expectedOk:      false,
+		},
+		"no checks": {
+			expectedResults: map[string]error{},
+			expectedOk:      true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			results, ok := NewHealth(tc.checks...).Check(context.Background())
+
+			assert.Equal(t, tc.expectedResults, results)
+			assert.Equal(t, tc.expectedOk, ok)
+		})
+	}
+}
+
+func TestAliveCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var (
+		runner = NewRunner(mock.Executor{}, &mock.Publisher{}, mock.NewBuilds(), mock.NewArtifacts(),
+			mock.NewTests(), mock.NewCoverage(), nil, mock.Logger{})
+		check = AliveCheck(runner)
+		done  = make(chan struct{})
+	)
+
+	assert.ErrorIs(t, check(ctx), errNotRunning)
+
+	go func() {
+		runner.Start(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return check(ctx) == nil }, time.Second, time.Millisecond*10)
+
+	cancel()
+	<-done
+
+	assert.ErrorIs(t, check(context.Background()), errNotRunning)
+}
+
+func TestWritableDirCheck(t *testing.T) {
+	var dir = filepath.Join(t.TempDir(), "repositories")
+
+	require.NoError(t, WritableDirCheck(dir)(context.Background()))
+	assert.DirExists(t, dir)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	var file = filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+
+	assert.Error(t, WritableDirCheck(file)(context.Background()))
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/cas"
+	"github.com/KirillMironov/ci/pkg/logger"
+	"sync"
+	"time"
+)
+
+// artifactGracePeriod is how long a stored artifact file is kept without being referenced,
+// since the artifact is recorded after its file is stored.
+const artifactGracePeriod = time.Hour
+
+// Janitor used to delete the builds outside the retention rules and to remove unused clones, artifact files
+// and Docker images.
+type Janitor struct {
+	*liveness
+	config              JanitorConfig
+	repositoriesStorage domain.RepositoriesStorage
+	buildsStorage       domain.BuildsStorage
+	artifactsStorage    domain.ArtifactsStorage
+	cloner              cacheCleaner
+	artifactFiles       fileStore
+	pruner              pruner
+	logger              logger.Logger
+	// Serializes the runs.
+	mu sync.Mutex
+}
+
+// JanitorConfig configures a Janitor.
+type JanitorConfig struct {
+	// How often the janitor runs.
+	Interval time.Duration
+	// Retention applied to the repositories without their own rules.
+	Retention domain.Retention
+	// PruneDocker enables removing the stopped step containers and the unused Docker images.
+	PruneDocker bool
+	// Vacuum reclaims the space of the deleted rows, if set.
+	Vacuum func(context.Context) error
+}
+
+type (
+	cacheCleaner interface {
+		Caches() (repoIds []string, err error)
+		RemoveCache(repoId string) error
+	}
+	fileStore interface {
+		List() ([]cas.Blob, error)
+		Remove(checksum string) error
+	}
+	pruner interface {
+		Prune(context.Context) (containers, images []string, spaceReclaimed uint64, err error)
+	}
+)
+
+func NewJanitor(config JanitorConfig, rs domain.RepositoriesStorage, bs domain.BuildsStorage,
+	as domain.ArtifactsStorage, cloner cacheCleaner, artifactFiles fileStore, pruner pruner,
+	logger logger.Logger) *Janitor {
+	return &Janitor{
+		liveness:            &liveness{},
+		config:              config,
+		repositoriesStorage: rs,
+		buildsStorage:       bs,
+		artifactsStorage:    as,
+		cloner:              cloner,
+		artifactFiles:       artifactFiles,
+		pruner:              pruner,
+		logger:              logger,
+	}
+}
+
+// Start runs the janitor periodically and logs what it removed.
+func (j *Janitor) Start(ctx context.Context) {
+	stop := j.start()
+	defer stop()
+
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Infof("janitor stopped: %v", ctx.Err())
+			return
+		case <-ticker.C:
+			j.log(j.Run(ctx))
+		}
+	}
+}
+
+// Run deletes the expired builds of every repository along with their logs and artifacts, removes the clones
+// of the deleted repositories, the unreferenced artifact files and the unused Docker images, vacuums the database
+// and reports what was removed.
+// A failed step is recorded in the report and does not stop the following ones.
+func (j *Janitor) Run(ctx context.Context) domain.CleanupReport {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var report = domain.CleanupReport{StartedAt: time.Now(), Builds: make(map[string]int)}
+
+	var fail = func(err error) {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	// The clones are listed before the repositories, so a clone of a repository added meanwhile is not removed.
+	clones, err := j.cloner.Caches()
+	if err != nil {
+		fail(err)
+	}
+
+	repos, err := j.repositoriesStorage.GetAll()
+	if err != nil {
+		fail(err)
+		report.FinishedAt = time.Now()
+		return report
+	}
+
+	var exists = make(map[string]bool, len(repos))
+
+	for _, repo := range repos {
+		exists[repo.Id] = true
+
+		var retention = repo.Retention.Or(j.config.Retention)
+		if !retention.Enabled() {
+			continue
+		}
+
+		deleted, err := j.buildsStorage.DeleteExpired(repo.Id, retention.KeepLast, retention.Cutoff(report.StartedAt))
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if deleted > 0 {
+			report.Builds[repo.Id] = deleted
+		}
+	}
+
+	for _, repoId := range clones {
+		if exists[repoId] {
+			continue
+		}
+
+		err = j.cloner.RemoveCache(repoId)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		report.Clones = append(report.Clones, repoId)
+	}
+
+	j.removeArtifactFiles(&report, fail)
+
+	if j.config.PruneDocker {
+		report.Containers, report.Images, report.SpaceReclaimed, err = j.pruner.Prune(ctx)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	if j.config.Vacuum != nil {
+		err = j.config.Vacuum(ctx)
+		if err != nil {
+			fail(err)
+		}
+		report.Vacuumed = err == nil
+	}
+
+	report.FinishedAt = time.Now()
+	return report
+}
+
+// removeArtifactFiles removes the stored files no longer referenced by any artifact.
+func (j *Janitor) removeArtifactFiles(report *domain.CleanupReport, fail func(error)) {
+	files, err := j.artifactFiles.List()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	for _, file := range files {
+		if report.StartedAt.Sub(file.ModTime) < artifactGracePeriod {
+			continue
+		}
+
+		referenced, err := j.artifactsStorage.Referenced(file.Checksum)
+		if err != nil {
+			fail(err)
+			return
+		}
+		if referenced {
+			continue
+		}
+
+		err = j.artifactFiles.Remove(file.Checksum)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		report.Artifacts = append(report.Artifacts, file.Checksum)
+	}
+}
+
+func (j *Janitor) log(report domain.CleanupReport) {
+	var builds int
+	for _, deleted := range report.Builds {
+		builds += deleted
+	}
+
+	j.logger.Infof("janitor removed %d builds, %d clones, %d artifact files, %d containers and %d images, "+
+		"reclaiming %d bytes", builds, len(report.Clones), len(report.Artifacts), len(report.Containers),
+		len(report.Images), report.SpaceReclaimed)
+
+	for _, err := range report.Errors {
+		j.logger.Errorf("janitor: %s", err)
+	}
+}
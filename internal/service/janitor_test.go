@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/cas"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestJanitor_Run(t *testing.T) {
+	var (
+		now                 = time.Now()
+		repositoriesStorage = mock.NewRepositories()
+		buildsStorage       = mock.NewBuilds()
+		artifactsStorage    = mock.NewArtifacts()
+		caches              = &mock.Caches{RepoIds: []string{"default", "removed"}}
+		files               = &mock.Files{Blobs: []cas.Blob{
+			{Checksum: "referenced", ModTime: now.Add(-time.Hour * 2)},
+			{Checksum: "unreferenced", ModTime: now.Add(-time.Hour * 2)},
+			{Checksum: "recent", ModTime: now},
+		}}
+		vacuumed bool
+		janitor  = NewJanitor(JanitorConfig{
+			PruneDocker: true,
+			Vacuum: func(context.Context) error {
+				vacuumed = true
+				return nil
+			},
+		}, repositoriesStorage, buildsStorage, artifactsStorage, caches, files,
+			mock.Pruner{Images: []string{"busybox:1.35"}}, mock.Logger{})
+	)
+
+	for _, repo := range []domain.Repository{
+		{Id: "default"},
+		{Id: "days", Retention: domain.Retention{KeepDays: 3}},
+		{Id: "unlimited"},
+	} {
+		require.NoError(t, repositoriesStorage.Create(repo))
+	}
+
+	// Every repository has a build a day for the last 5 days, the oldest one is the only successful one.
+	for _, repoId := range []string{"default", "days", "unlimited"} {
+		for i := 0; i < 5; i++ {
+			var status = domain.Failure
+			if i == 4 {
+				status = domain.Success
+			}
+			_, err := buildsStorage.Create(domain.Build{
+				Id:        repoId + strconv.Itoa(i),
+				RepoId:    repoId,
+				Status:    status,
+				CreatedAt: now.AddDate(0, 0, -i).Add(-time.Minute),
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	require.NoError(t, artifactsStorage.Save(domain.Artifact{BuildId: "default0", Path: "app", Checksum: "referenced"}))
+
+	report := janitor.Run(context.Background())
+
+	assert.Equal(t, map[string]int{"days": 1}, report.Builds)
+	assert.Equal(t, []string{"removed"}, report.Clones)
+	assert.Equal(t, []string{"removed"}, caches.Removed)
+	assert.Equal(t, []string{"unreferenced"}, report.Artifacts)
+	assert.Equal(t, []string{"unreferenced"}, files.Removed)
+	assert.Equal(t, []string{"busybox:1.35"}, report.Images)
+	assert.True(t, vacuumed)
+	assert.True(t, report.Vacuumed)
+	assert.Empty(t, report.Errors)
+
+	assert.Equal(t, []string{"days0", "days1", "days2", "days4"}, buildIds(t, buildsStorage, "days"))
+	assert.Len(t, buildIds(t, buildsStorage, "unlimited"), 5)
+
+	janitor.config.Retention = domain.Retention{KeepLast: 2}
+
+	report = janitor.Run(context.Background())
+
+	assert.Equal(t, map[string]int{"default": 2, "unlimited": 2}, report.Builds)
+	assert.Equal(t, []string{"default0", "default1", "default4"}, buildIds(t, buildsStorage, "default"))
+	assert.Equal(t, []string{"days0", "days1", "days2", "days4"}, buildIds(t, buildsStorage, "days"),
+		"the repository rules are combined with the global ones")
+}
+
+func buildIds(t *testing.T, bs domain.BuildsStorage, repoId string) (ids []string) {
+	t.Helper()
+
+	builds, err := bs.GetAllByRepoId(repoId)
+	require.NoError(t, err)
+
+	for _, build := range builds {
+		ids = append(ids, build.Id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics used to collect Prometheus metrics from the bus events, image pulls and database queries.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	builds            *prometheus.CounterVec
+	buildDuration     *prometheus.HistogramVec
+	stepDuration      *prometheus.HistogramVec
+	queueDepth        prometheus.Gauge
+	runnerBusy        prometheus.Gauge
+	runnerBusySeconds prometheus.Counter
+	pollDuration      *prometheus.HistogramVec
+	pollErrors        *prometheus.CounterVec
+	lastPollSuccess   *prometheus.GaugeVec
+	imagePullDuration *prometheus.HistogramVec
+	queryDuration     *prometheus.HistogramVec
+
+	mu sync.Mutex
+	// Start times of the running steps by build id.
+	stepStarts map[string]time.Time
+}
+
+func NewMetrics() *Metrics {
+	var m = &Metrics{
+		registry: prometheus.NewRegistry(),
+		builds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ci_builds_total",
+			Help: "Number of finished builds.",
+		}, []string{"repository", "status"}),
+		buildDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_build_duration_seconds",
+			Help:    "Duration of finished builds.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		}, []string{"repository", "status"}),
+		stepDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_step_duration_seconds",
+			Help:    "Duration of step attempts.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 14),
+		}, []string{"repository", "step", "status"}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ci_build_queue_depth",
+			Help: "Number of builds waiting for the runner.",
+		}),
+		runnerBusy: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ci_runner_busy",
+			Help: "Whether the runner is running a build.",
+		}),
+		runnerBusySeconds: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ci_runner_busy_seconds_total",
+			Help: "Time the runner spent running builds, its rate is the runner utilisation.",
+		}),
+		pollDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_poll_duration_seconds",
+			Help:    "Duration of listing the latest commits of a repository.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"repository"}),
+		pollErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ci_poll_errors_total",
+			Help: "Number of failed polls.",
+		}, []string{"repository"}),
+		lastPollSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ci_poll_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful poll.",
+		}, []string{"repository"}),
+		imagePullDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_image_pull_duration_seconds",
+			Help:    "Duration of Docker image pulls.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+		}, []string{"image"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_database_query_duration_seconds",
+			Help:    "Duration of database queries.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"operation"}),
+		stepStarts: make(map[string]time.Time),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.builds,
+		m.buildDuration,
+		m.stepDuration,
+		m.queueDepth,
+		m.runnerBusy,
+		m.runnerBusySeconds,
+		m.pollDuration,
+		m.pollErrors,
+		m.lastPollSuccess,
+		m.imagePullDuration,
+		m.queryDuration,
+	)
+
+	return m
+}
+
+// Handler returns the handler exposing the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// HandleEvent updates the metrics from a bus event.
+func (m *Metrics) HandleEvent(_ context.Context, event domain.Event) error {
+	var repo = event.Repository.URL
+
+	switch event.Kind {
+	case domain.EventRepositoryPolled:
+		m.pollDuration.WithLabelValues(repo).Observe(event.Duration.Seconds())
+		if event.Error != "" {
+			m.pollErrors.WithLabelValues(repo).Inc()
+		} else {
+			m.lastPollSuccess.WithLabelValues(repo).Set(float64(event.Time.Unix()))
+		}
+	case domain.EventRepositoryRemoved:
+		m.pollDuration.DeleteLabelValues(repo)
+		m.pollErrors.DeleteLabelValues(repo)
+		m.lastPollSuccess.DeleteLabelValues(repo)
+	case domain.EventBuildQueued:
+		m.queueDepth.Inc()
+	case domain.EventBuildStarted:
+		m.queueDepth.Dec()
+		m.runnerBusy.Set(1)
+	case domain.EventBuildAborted:
+		m.queueDepth.Dec()
+	case domain.EventStepStarted:
+		m.mu.Lock()
+		m.stepStarts[event.Build.Id] = event.Time
+		m.mu.Unlock()
+	case domain.EventStepFinished:
+		m.mu.Lock()
+		start, ok := m.stepStarts[event.Build.Id]
+		delete(m.stepStarts, event.Build.Id)
+		m.mu.Unlock()
+
+		if ok {
+			m.stepDuration.WithLabelValues(repo, event.Step.Step, event.Step.Status.String()).
+				Observe(event.Time.Sub(start).Seconds())
+		}
+	case domain.EventBuildFinished:
+		var (
+			status   = event.Build.Status.String()
+			duration = event.Build.Duration().Seconds()
+		)
+		m.builds.WithLabelValues(repo, status).Inc()
+		m.buildDuration.WithLabelValues(repo, status).Observe(duration)
+		m.runnerBusy.Set(0)
+		m.runnerBusySeconds.Add(duration)
+	}
+
+	return nil
+}
+
+// ObserveImagePull records the duration of a Docker image pull.
+func (m *Metrics) ObserveImagePull(image string, duration time.Duration) {
+	m.imagePullDuration.WithLabelValues(image).Observe(duration.Seconds())
+}
+
+// ObserveQuery records the duration of a database query, labeled by its SQL operation.
+func (m *Metrics) ObserveQuery(query string, duration time.Duration) {
+	m.queryDuration.WithLabelValues(queryOperation(query)).Observe(duration.Seconds())
+}
+
+// queryOperation returns the lowercased first keyword of the query, e.g. select or insert.
+func queryOperation(query string) string {
+	var fields = strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
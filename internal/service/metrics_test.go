@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics_HandleEvent(t *testing.T) {
+	var (
+		metrics = NewMetrics()
+		repo    = domain.Repository{Id: "0", URL: "https://github.com/owner/name"}
+		now     = time.Now()
+		build   = &domain.Build{Id: "1", Status: domain.InProgress, CreatedAt: now}
+	)
+
+	var events = []domain.Event{
+		{Kind: domain.EventRepositoryPolled, Time: now, Repository: repo, Duration: time.Second},
+		{Kind: domain.EventRepositoryPolled, Time: now, Repository: repo, Error: "failed"},
+		{Kind: domain.EventBuildQueued, Time: now, Repository: repo, Build: build},
+		{Kind: domain.EventBuildQueued, Time: now, Repository: repo, Build: &domain.Build{Id: "2"}},
+		{Kind: domain.EventBuildStarted, Time: now, Repository: repo, Build: build},
+		{Kind: domain.EventBuildAborted, Time: now, Repository: repo, Build: &domain.Build{Id: "2"}},
+		{Kind: domain.EventStepStarted, Time: now, Repository: repo, Build: build,
+			Step: &domain.StepAttempt{Step: "test", Attempt: 1, Status: domain.InProgress}},
+		{Kind: domain.EventStepFinished, Time: now.Add(time.Second * 2), Repository: repo, Build: build,
+			Step: &domain.StepAttempt{Step: "test", Attempt: 1, Status: domain.Failure}},
+	}
+	for _, event := range events {
+		require.NoError(t, metrics.HandleEvent(context.Background(), event))
+	}
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.queueDepth))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.runnerBusy))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.pollErrors.WithLabelValues(repo.URL)))
+	assert.Equal(t, float64(now.Unix()), testutil.ToFloat64(metrics.lastPollSuccess.WithLabelValues(repo.URL)))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.stepDuration))
+
+	var finished = *build
+	finished.Status = domain.Failure
+	finished.FinishedAt = now.Add(time.Second * 3)
+
+	err := metrics.HandleEvent(context.Background(), domain.Event{Kind: domain.EventBuildFinished, Time: now,
+		Repository: repo, Build: &finished})
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.runnerBusy))
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.runnerBusySeconds))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.builds.WithLabelValues(repo.URL, "failure")))
+
+	metrics.ObserveImagePull("alpine", time.Second)
+	metrics.ObserveQuery("  SELECT id FROM builds", time.Millisecond)
+	metrics.ObserveQuery("INSERT INTO builds", time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		`ci_builds_total{repository="https://github.com/owner/name",status="failure"} 1`,
+		`ci_build_duration_seconds_count{repository="https://github.com/owner/name",status="failure"} 1`,
+		`ci_step_duration_seconds_sum{repository="https://github.com/owner/name",status="failure",step="test"} 2`,
+		`ci_poll_duration_seconds_count{repository="https://github.com/owner/name"} 2`,
+		`ci_image_pull_duration_seconds_count{image="alpine"} 1`,
+		`ci_database_query_duration_seconds_count{operation="select"} 1`,
+		`ci_database_query_duration_seconds_count{operation="insert"} 1`,
+		`ci_build_queue_depth 0`,
+	} {
+		assert.Contains(t, string(body), line)
+	}
+
+	err = metrics.HandleEvent(context.Background(), domain.Event{Kind: domain.EventRepositoryRemoved,
+		Repository: repo})
+	require.NoError(t, err)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.lastPollSuccess))
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/logger"
+	"github.com/rs/xid"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notifier used to deliver build lifecycle events to repository notification targets.
+// Deliveries are persisted and retried with backoff until they succeed or run out of attempts.
+type Notifier struct {
+	client               *http.Client
+	externalURL          string
+	notificationsStorage domain.NotificationsStorage
+	logger               logger.Logger
+	// How often due deliveries are sent.
+	interval time.Duration
+	// Maximum number of attempts to deliver a payload.
+	attempts int
+	// Delay before the second attempt, doubled for each following one.
+	backoff time.Duration
+}
+
+// notificationPayload is the JSON body sent to notification targets.
+type notificationPayload struct {
+	Event      domain.NotificationEvent `json:"event"`
+	Build      domain.Build             `json:"build"`
+	Repository struct {
+		Id  string `json:"id"`
+		URL string `json:"url"`
+	} `json:"repository"`
+	Commit   domain.Commit `json:"commit"`
+	Status   string        `json:"status"`
+	Duration float64       `json:"duration"`
+	LogURL   string        `json:"log_url"`
+}
+
+func NewNotifier(client *http.Client, externalURL string, ns domain.NotificationsStorage,
+	logger logger.Logger) *Notifier {
+	return &Notifier{
+		client:               client,
+		externalURL:          strings.TrimSuffix(externalURL, "/"),
+		notificationsStorage: ns,
+		logger:               logger,
+		interval:             time.Second,
+		attempts:             5,
+		backoff:              10 * time.Second,
+	}
+}
+
+// Start periodically sends due deliveries.
+func (n Notifier) Start(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.logger.Infof("notifier stopped: %v", ctx.Err())
+			return
+		case now := <-ticker.C:
+			n.deliverDue(ctx, now)
+		}
+	}
+}
+
+// Notify enqueues a delivery of each event to every repository target subscribed to it.
+func (n Notifier) Notify(repo domain.Repository, build domain.Build, events ...domain.NotificationEvent) error {
+	targets, err := n.notificationsStorage.GetTargetsByRepoId(repo.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		var payload []byte
+
+		for _, target := range targets {
+			if !target.Subscribed(event) {
+				continue
+			}
+
+			if payload == nil {
+				payload, err = n.payload(event, repo, build)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = n.notificationsStorage.CreateDelivery(domain.Delivery{
+				Id:            xid.New().String(),
+				TargetId:      target.Id,
+				Event:         event,
+				Payload:       payload,
+				Status:        domain.DeliveryPending,
+				NextAttemptAt: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n Notifier) payload(event domain.NotificationEvent, repo domain.Repository, build domain.Build) ([]byte,
+	error) {
+	var payload = notificationPayload{
+		Event:    event,
+		Commit:   build.Commit,
+		Status:   build.Status.String(),
+		Duration: build.Duration().Seconds(),
+		LogURL:   fmt.Sprintf("%s/api/v1/logs/%s", n.externalURL, build.Id),
+	}
+	payload.Build = build
+	payload.Build.Steps = nil
+	payload.Repository.Id = repo.Id
+	payload.Repository.URL = repo.URL
+
+	return json.Marshal(payload)
+}
+
+// deliverDue sends the deliveries due at the given time.
+func (n Notifier) deliverDue(ctx context.Context, now time.Time) {
+	deliveries, err := n.notificationsStorage.GetDueDeliveries(now)
+	if err != nil {
+		n.logger.Error(err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		delivery = n.deliver(ctx, delivery, now)
+
+		err = n.notificationsStorage.UpdateDelivery(delivery)
+		if err != nil {
+			n.logger.Error(err)
+		}
+	}
+}
+
+// deliver makes a single attempt to send the delivery and returns it with the outcome recorded.
+func (n Notifier) deliver(ctx context.Context, delivery domain.Delivery, now time.Time) domain.Delivery {
+	delivery.Attempts++
+
+	code, err := n.post(ctx, delivery)
+	delivery.ResponseCode = code
+
+	switch {
+	case err == nil:
+		delivery.Status = domain.DeliveryDelivered
+		delivery.Error = ""
+	case delivery.Attempts >= n.attempts:
+		delivery.Status = domain.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = now.Add(n.backoff << (delivery.Attempts - 1))
+		n.logger.Infof("delivery %s failed on attempt %d, retrying: %v", delivery.Id, delivery.Attempts, err)
+	}
+
+	return delivery
+}
+
+// post sends the delivery payload signed with the target secret and returns the response status code.
+func (n Notifier) post(ctx context.Context, delivery domain.Delivery) (int, error) {
+	target, err := n.notificationsStorage.GetTargetById(delivery.TargetId)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CI-Event", string(delivery.Event))
+	req.Header.Set("X-CI-Delivery", delivery.Id)
+	req.Header.Set("X-CI-Signature-256", "sha256="+sign(delivery.Payload, target.Secret))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the payload.
+func sign(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifiers used to notify each of the notifiers of the build lifecycle events.
+type Notifiers []notifier
+
+type notifier interface {
+	Notify(domain.Repository, domain.Build, ...domain.NotificationEvent) error
+}
+
+// HandleEvent notifies every notifier of the notification events of started and finished builds
+// and returns the first error.
+func (ns Notifiers) HandleEvent(_ context.Context, event domain.Event) error {
+	var events []domain.NotificationEvent
+
+	switch event.Kind {
+	case domain.EventBuildStarted:
+		events = []domain.NotificationEvent{domain.EventStarted}
+	case domain.EventBuildFinished:
+		events = finishedEvents(event.Previous, event.Build.Status)
+	default:
+		return nil
+	}
+
+	var firstErr error
+	for _, n := range ns {
+		err := n.Notify(event.Repository, *event.Build, events...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// finishedEvents returns the notification events of a finished build given the previous build
+// of the same branch, tag or pull request, if any.
+func finishedEvents(previous *domain.Build, current domain.Status) []domain.NotificationEvent {
+	switch {
+	case current == domain.Success && previous != nil && previous.Status == domain.Failure:
+		return []domain.NotificationEvent{domain.EventSucceeded, domain.EventFixed}
+	case current == domain.Success:
+		return []domain.NotificationEvent{domain.EventSucceeded}
+	case previous != nil && previous.Status == domain.Success:
+		return []domain.NotificationEvent{domain.EventFailed, domain.EventBroken}
+	default:
+		return []domain.NotificationEvent{domain.EventFailed}
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	var (
+		now   = time.Now()
+		repo  = domain.Repository{Id: "0", URL: "https://github.com/owner/name"}
+		build = domain.Build{
+			Id:         "1",
+			RepoId:     repo.Id,
+			Commit:     domain.Commit{Hash: "abc", Branch: "main"},
+			Status:     domain.Failure,
+			CreatedAt:  now.Add(-time.Minute),
+			FinishedAt: now,
+		}
+		received = make(chan *http.Request, 1)
+		body     []byte
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	var (
+		storage  = mock.NewNotifications()
+		notifier = NewNotifier(server.Client(), "http://ci/", storage, mock.Logger{})
+		target   = domain.NotificationTarget{
+			Id:     "2",
+			RepoId: repo.Id,
+			URL:    server.URL,
+			Secret: "secret",
+			Events: []domain.NotificationEvent{domain.EventFailed, domain.EventBroken},
+		}
+	)
+
+	require.NoError(t, storage.CreateTarget(target))
+	require.NoError(t, notifier.Notify(repo, build, domain.EventStarted, domain.EventFailed))
+
+	deliveries, err := storage.GetDeliveriesByTargetId(target.Id)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, domain.EventFailed, deliveries[0].Event)
+
+	notifier.deliverDue(context.Background(), time.Now())
+
+	req := <-received
+	assert.Equal(t, string(domain.EventFailed), req.Header.Get("X-CI-Event"))
+	assert.Equal(t, deliveries[0].Id, req.Header.Get("X-CI-Delivery"))
+	assert.Equal(t, "sha256="+sign(body, target.Secret), req.Header.Get("X-CI-Signature-256"))
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "failed", payload["event"])
+	assert.Equal(t, "failure", payload["status"])
+	assert.Equal(t, float64(60), payload["duration"])
+	assert.Equal(t, "http://ci/api/v1/logs/1", payload["log_url"])
+	assert.Equal(t, map[string]any{"id": "0", "url": repo.URL}, payload["repository"])
+	assert.Equal(t, map[string]any{"hash": "abc", "branch": "main"}, payload["commit"])
+
+	deliveries, err = storage.GetDeliveriesByTargetId(target.Id)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseCode)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var (
+		storage  = mock.NewNotifications()
+		notifier = NewNotifier(server.Client(), "http://ci", storage, mock.Logger{})
+		now      = time.Now()
+		delivery = domain.Delivery{Id: "1", TargetId: "2", Status: domain.DeliveryPending, NextAttemptAt: now}
+	)
+	notifier.attempts = 3
+
+	require.NoError(t, storage.CreateTarget(domain.NotificationTarget{Id: "2", URL: server.URL}))
+	require.NoError(t, storage.CreateDelivery(delivery))
+
+	for attempt := 1; attempt <= notifier.attempts; attempt++ {
+		notifier.deliverDue(context.Background(), now)
+		// Not due until the backoff has passed.
+		notifier.deliverDue(context.Background(), now)
+		assert.Equal(t, attempt, requests)
+
+		deliveries, err := storage.GetDeliveriesByTargetId("2")
+		require.NoError(t, err)
+		delivery = deliveries[0]
+		assert.Equal(t, attempt, delivery.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, delivery.ResponseCode)
+
+		if attempt < notifier.attempts {
+			assert.Equal(t, domain.DeliveryPending, delivery.Status)
+			assert.Equal(t, now.Add(notifier.backoff<<(attempt-1)), delivery.NextAttemptAt)
+			now = delivery.NextAttemptAt
+		}
+	}
+
+	assert.Equal(t, domain.DeliveryFailed, delivery.Status)
+	assert.NotEmpty(t, delivery.Error)
+}
+
+func TestNotifiers_HandleEvent(t *testing.T) {
+	var (
+		success = &domain.Build{Status: domain.Success}
+		failure = &domain.Build{Status: domain.Failure}
+	)
+
+	tests := map[string]struct {
+		event          domain.Event
+		expectedEvents []domain.NotificationEvent
+	}{
+		"started": {
+			event:          domain.Event{Kind: domain.EventBuildStarted, Build: success},
+			expectedEvents: []domain.NotificationEvent{domain.EventStarted},
+		},
+		"first success": {
+			event:          domain.Event{Kind: domain.EventBuildFinished, Build: success},
+			expectedEvents: []domain.NotificationEvent{domain.EventSucceeded},
+		},
+		"first failure": {
+			event:          domain.Event{Kind: domain.EventBuildFinished, Build: failure},
+			expectedEvents: []domain.NotificationEvent{domain.EventFailed},
+		},
+		"still succeeding": {
+			event:          domain.Event{Kind: domain.EventBuildFinished, Build: success, Previous: success},
+			expectedEvents: []domain.NotificationEvent{domain.EventSucceeded},
+		},
+		"still failing": {
+			event:          domain.Event{Kind: domain.EventBuildFinished, Build: failure, Previous: failure},
+			expectedEvents: []domain.NotificationEvent{domain.EventFailed},
+		},
+		"broken": {
+			event:          domain.Event{Kind: domain.EventBuildFinished, Build: failure, Previous: success},
+			expectedEvents: []domain.NotificationEvent{domain.EventFailed, domain.EventBroken},
+		},
+		"fixed": {
+			event:          domain.Event{Kind: domain.EventBuildFinished, Build: success, Previous: failure},
+			expectedEvents: []domain.NotificationEvent{domain.EventSucceeded, domain.EventFixed},
+		},
+		"step events are ignored": {
+			event:          domain.Event{Kind: domain.EventStepFinished, Build: success},
+			expectedEvents: nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				first, second = mock.NewNotifier(), mock.NewNotifier()
+				notifiers     = Notifiers{first, second}
+			)
+
+			err := notifiers.HandleEvent(context.Background(), tc.event)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedEvents, first.Events)
+			assert.Equal(t, tc.expectedEvents, second.Events)
+		})
+	}
+}
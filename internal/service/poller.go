@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/KirillMironov/ci/internal/domain"
 	"github.com/KirillMironov/ci/pkg/logger"
+	"github.com/KirillMironov/ci/pkg/pattern"
 	"os"
 	"path/filepath"
 	"time"
@@ -12,19 +13,32 @@ import (
 
 // Poller used to poll repositories and run builds.
 type Poller struct {
-	poll          chan domain.Repository
-	ciFilename    string
-	cloner        cloner
-	parser        parser
-	runner        runner
-	buildsStorage domain.BuildsStorage
-	logger        logger.Logger
+	*liveness
+	poll                chan pollRequest
+	ciFilename          string
+	cloner              cloner
+	parser              parser
+	runner              runner
+	publisher           publisher
+	repositoriesStorage domain.RepositoriesStorage
+	buildsStorage       domain.BuildsStorage
+	tagsStorage         domain.TagsStorage
+	logger              logger.Logger
 }
 
 type (
+	pollRequest struct {
+		// ctx of the builds. If nil, the builds run until the poller stops.
+		ctx     context.Context
+		repo    domain.Repository
+		trigger domain.Trigger
+		// Commits to build. If empty, the latest commits are listed from the repository.
+		commits []domain.Commit
+	}
 	cloner interface {
-		GetLatestCommitHash(domain.Repository) (string, error)
-		CloneRepository(repo domain.Repository, targetHash string) (srcCodePath string, err error)
+		GetLatestCommits(domain.Repository) ([]domain.Commit, error)
+		CloneRepository(repo domain.Repository, commit domain.Commit) (srcCodePath string, author domain.Author,
+			err error)
 	}
 	parser interface {
 		ParsePipeline(b []byte) (domain.Pipeline, error)
@@ -34,71 +48,223 @@ type (
 	}
 )
 
-func NewPoller(ciFilename string, cloner cloner, parser parser, runner runner, bs domain.BuildsStorage,
-	logger logger.Logger) *Poller {
+func NewPoller(ciFilename string, cloner cloner, parser parser, runner runner, publisher publisher,
+	rs domain.RepositoriesStorage, bs domain.BuildsStorage, ts domain.TagsStorage, logger logger.Logger) *Poller {
 	return &Poller{
-		poll:          make(chan domain.Repository),
-		ciFilename:    ciFilename,
-		cloner:        cloner,
-		parser:        parser,
-		runner:        runner,
-		buildsStorage: bs,
-		logger:        logger,
+		liveness:            &liveness{},
+		poll:                make(chan pollRequest),
+		ciFilename:          ciFilename,
+		cloner:              cloner,
+		parser:              parser,
+		runner:              runner,
+		publisher:           publisher,
+		repositoriesStorage: rs,
+		buildsStorage:       bs,
+		tagsStorage:         ts,
+		logger:              logger,
 	}
 }
 
-// Start listens on the poll channel and runs a build if the repository contains a new commit.
+// Start listens on the poll channel and runs a build for every repository branch and pull request
+// that contains a new commit and for every new tag. The tags present at the first poll of the repository,
+// or at the first poll after its tag patterns change, are not built. Builds triggered by a cron schedule run
+// for branches only, regardless of whether the commit has already been built.
 func (p Poller) Start(ctx context.Context) {
+	stop := p.start()
+	defer stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			p.logger.Infof("poller stopped: %v", ctx.Err())
 			return
-		case repo := <-p.poll:
-			latestHash, err := p.cloner.GetLatestCommitHash(repo)
-			if err != nil {
-				p.logger.Errorf("failed to get latest commit hash: %v", err)
-				continue
-			}
+		case req := <-p.poll:
+			var commits = req.commits
 
-			builds, err := p.buildsStorage.GetAllByRepoId(repo.Id)
-			if err != nil && !errors.Is(err, domain.ErrNotFound) {
-				p.logger.Error(err)
-				continue
-			}
-			if len(builds) > 0 && latestHash == builds[len(builds)-1].Commit.Hash {
-				continue
+			var buildCtx = ctx
+			if req.ctx != nil {
+				buildCtx = req.ctx
 			}
 
-			srcCodePath, err := p.cloner.CloneRepository(repo, latestHash)
-			if err != nil {
-				p.logger.Errorf("failed to clone repository: %v", err)
-				continue
-			}
+			if len(commits) == 0 {
+				var err error
+
+				var start = time.Now()
+
+				commits, err = p.cloner.GetLatestCommits(req.repo)
+
+				var event = domain.NewEvent(domain.EventRepositoryPolled, req.repo)
+				event.Commits = commits
+				event.Duration = time.Since(start)
+				if err != nil {
+					event.Error = err.Error()
+				}
+				p.publisher.Publish(event)
+
+				p.updatePollStatus(req.repo.Id, start, commits, event.Error)
 
-			data, err := os.ReadFile(filepath.Join(srcCodePath, p.ciFilename))
-			if err != nil {
-				p.logger.Errorf("failed to read ci file: %v", err)
-				continue
+				if err != nil {
+					p.logger.Errorf("failed to get latest commits: %v", err)
+					continue
+				}
+
+				commits = p.skipBaselineTags(req.repo, commits)
 			}
 
-			pipeline, err := p.parser.ParsePipeline(data)
-			if err != nil {
-				p.logger.Errorf("failed to parse pipeline: %v", err)
-				continue
+			for _, commit := range commits {
+				var trigger = req.trigger
+
+				switch {
+				case commit.PullRequest != nil:
+					if trigger != domain.TriggerPush {
+						continue
+					}
+					trigger = domain.TriggerPullRequest
+				case commit.Tag != "":
+					if trigger != domain.TriggerPush {
+						continue
+					}
+					trigger = domain.TriggerTag
+				}
+
+				if trigger != domain.TriggerCron {
+					built, err := p.isBuilt(req.repo.Id, commit)
+					if err != nil {
+						p.logger.Error(err)
+						continue
+					}
+					if built {
+						continue
+					}
+				}
+
+				p.build(buildCtx, req.repo, commit, trigger)
 			}
+		}
+	}
+}
+
+// updatePollStatus records the outcome of a poll of the repository.
+func (p Poller) updatePollStatus(repoId string, polledAt time.Time, commits []domain.Commit, pollErr string) {
+	var hash string
+	if len(commits) > 0 {
+		hash = commits[0].Hash
+	}
+
+	err := p.repositoriesStorage.UpdatePollStatus(repoId, polledAt, hash, pollErr)
+	if err != nil {
+		p.logger.Errorf("failed to update poll status: %v", err)
+	}
+}
+
+// skipBaselineTags removes the tags of the repository tag baseline from the commits. If the baseline is missing
+// or was taken with other tag patterns, it is replaced by the listed tags, which are all removed.
+func (p Poller) skipBaselineTags(repo domain.Repository, commits []domain.Commit) []domain.Commit {
+	var tags []string
+	for _, commit := range commits {
+		if commit.Tag != "" {
+			tags = append(tags, commit.Tag)
+		}
+	}
+
+	current, err := p.tagsStorage.GetBaseline(repo.Id)
+	switch {
+	case err == nil && equalPatterns(current.Patterns, repo.Tags):
+		tags = current.Tags
+	case err == nil || errors.Is(err, domain.ErrNotFound):
+		err = p.tagsStorage.SetBaseline(repo.Id, domain.TagBaseline{Patterns: repo.Tags, Tags: tags})
+		if err != nil {
+			p.logger.Errorf("failed to set tag baseline: %v", err)
+		}
+	default:
+		// The listed tags are skipped, as they may all be in the baseline.
+		p.logger.Errorf("failed to get tag baseline: %v", err)
+	}
+
+	var baseline = make(map[string]bool)
+	for _, tag := range tags {
+		baseline[tag] = true
+	}
+
+	var filtered = make([]domain.Commit, 0, len(commits))
+	for _, commit := range commits {
+		if commit.Tag == "" || !baseline[commit.Tag] {
+			filtered = append(filtered, commit)
+		}
+	}
+	return filtered
+}
 
-			p.runner.Run(runRequest{
-				ctx:         ctx,
-				repoId:      repo.Id,
-				commit:      domain.Commit{Hash: latestHash},
-				pipeline:    pipeline,
-				srcCodePath: srcCodePath,
-			})
+// equalPatterns reports whether the pattern lists are equal.
+func equalPatterns(a, b pattern.List) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isBuilt reports whether the commit is the latest built commit of its branch, tag or pull request.
+func (p Poller) isBuilt(repoId string, commit domain.Commit) (bool, error) {
+	latest, err := latestBuild(p.buildsStorage, repoId, commit)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return false, nil
 		}
+		return false, err
+	}
+
+	return latest.Commit.Hash == commit.Hash, nil
+}
+
+// latestBuild returns the latest build of the commit branch, tag or pull request.
+func latestBuild(bs domain.BuildsStorage, repoId string, commit domain.Commit) (domain.Build, error) {
+	switch {
+	case commit.PullRequest != nil:
+		return bs.GetLatestByPullRequest(repoId, commit.PullRequest.Number)
+	case commit.Tag != "":
+		return bs.GetLatestByTag(repoId, commit.Tag)
+	default:
+		return bs.GetLatestByBranch(repoId, commit.Branch)
 	}
 }
 
+// build checks out the commit, parses its pipeline and runs it.
+func (p Poller) build(ctx context.Context, repo domain.Repository, commit domain.Commit, trigger domain.Trigger) {
+	srcCodePath, author, err := p.cloner.CloneRepository(repo, commit)
+	if err != nil {
+		p.logger.Errorf("failed to clone repository: %v", err)
+		return
+	}
+
+	commit.Author = &author
+
+	data, err := os.ReadFile(filepath.Join(srcCodePath, p.ciFilename))
+	if err != nil {
+		p.logger.Errorf("failed to read ci file: %v", err)
+		return
+	}
+
+	pipeline, err := p.parser.ParsePipeline(data)
+	if err != nil {
+		p.logger.Errorf("failed to parse pipeline: %v", err)
+		return
+	}
+
+	p.runner.Run(runRequest{
+		ctx:         ctx,
+		repo:        repo,
+		commit:      commit,
+		trigger:     trigger,
+		pipeline:    pipeline,
+		srcCodePath: srcCodePath,
+	})
+}
+
 // AddRepository sends the repository to the poll channel at regular intervals.
 func (p Poller) AddRepository(ctx context.Context, repo domain.Repository) {
 	go func() {
@@ -109,9 +275,37 @@ func (p Poller) AddRepository(ctx context.Context, repo domain.Repository) {
 			case <-ctx.Done():
 				return
 			case <-timer.C:
-				p.poll <- repo
+				select {
+				case <-ctx.Done():
+					return
+				case p.poll <- pollRequest{repo: repo, trigger: domain.TriggerPush}:
+				}
 				timer.Reset(repo.PollingInterval.Duration())
 			}
 		}
 	}()
 }
+
+// Trigger sends the repository to the poll channel once, building its latest commit with the given trigger.
+// The builds are cancelled when ctx is done.
+func (p Poller) Trigger(ctx context.Context, repo domain.Repository, trigger domain.Trigger) {
+	go func() {
+		select {
+		case <-ctx.Done():
+		case p.poll <- pollRequest{ctx: ctx, repo: repo, trigger: trigger}:
+		}
+	}()
+}
+
+// TriggerCommit sends the commit of the repository to the poll channel, building it unless it is already built.
+// The build is cancelled when ctx is done.
+func (p Poller) TriggerCommit(ctx context.Context, repo domain.Repository, commit domain.Commit) {
+	go func() {
+		var req = pollRequest{ctx: ctx, repo: repo, trigger: domain.TriggerPush, commits: []domain.Commit{commit}}
+
+		select {
+		case <-ctx.Done():
+		case p.poll <- req:
+		}
+	}()
+}
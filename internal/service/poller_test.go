@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPoller_PollStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		repo                = domain.Repository{Id: "0"}
+		repositoriesStorage = mock.NewRepositories()
+		cloner              = &mock.Cloner{
+			Commits:  []domain.Commit{{Hash: "123", Branch: "main"}},
+			Failures: 2,
+			Err:      ErrBranchNotFound,
+		}
+		poller = NewPoller("", cloner, &YAMLParser{}, nil, &mock.Publisher{}, repositoriesStorage, mock.NewBuilds(),
+			mock.NewTags(), mock.Logger{})
+		status domain.PollStatus
+	)
+
+	require.NoError(t, repositoriesStorage.Create(repo))
+
+	go poller.Start(ctx)
+
+	// poll triggers a poll of the repository and waits until its status is updated.
+	poll := func() {
+		var previous = status.LastPolledAt
+
+		poller.Trigger(ctx, repo, domain.TriggerPush)
+
+		require.Eventually(t, func() bool {
+			repo, err := repositoriesStorage.GetById(repo.Id)
+			require.NoError(t, err)
+			status = repo.PollStatus
+			return status.LastPolledAt != nil && (previous == nil || status.LastPolledAt.After(*previous))
+		}, time.Second, time.Millisecond*10)
+	}
+
+	for i := 1; i <= cloner.Failures; i++ {
+		poll()
+		assert.Equal(t, ErrBranchNotFound.Error(), status.LastError)
+		assert.Equal(t, i, status.ConsecutiveFailures)
+		assert.Empty(t, status.LastSeenHash)
+
+		unhealthy, err := repositoriesStorage.GetUnhealthy()
+		require.NoError(t, err)
+		assert.Len(t, unhealthy, 1)
+	}
+
+	poll()
+	assert.Empty(t, status.LastError)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Equal(t, "123", status.LastSeenHash)
+
+	unhealthy, err := repositoriesStorage.GetUnhealthy()
+	require.NoError(t, err)
+	assert.Empty(t, unhealthy)
+}
+
+func TestPoller_TagBaseline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		repo                = domain.Repository{Id: "0", Tags: pattern.List{"v*"}}
+		repositoriesStorage = mock.NewRepositories()
+		cloner              = &mock.Cloner{}
+		poller              = NewPoller("", cloner, &YAMLParser{}, nil, &mock.Publisher{}, repositoriesStorage,
+			mock.NewBuilds(), mock.NewTags(), mock.Logger{})
+	)
+
+	require.NoError(t, repositoriesStorage.Create(repo))
+
+	go poller.Start(ctx)
+
+	// poll lists the commits once and waits until the poll status is updated.
+	var polledAt *time.Time
+	poll := func(commits ...domain.Commit) {
+		var previous = polledAt
+
+		cloner.Commits = commits
+		poller.Trigger(ctx, repo, domain.TriggerPush)
+
+		require.Eventually(t, func() bool {
+			stored, err := repositoriesStorage.GetById(repo.Id)
+			require.NoError(t, err)
+			polledAt = stored.PollStatus.LastPolledAt
+			return polledAt != nil && (previous == nil || polledAt.After(*previous))
+		}, time.Second, time.Millisecond*10)
+	}
+
+	// builtTags returns the tags whose commits were checked out to be built.
+	builtTags := func() (tags []string) {
+		for _, commit := range cloner.Cloned() {
+			if commit.Tag != "" {
+				tags = append(tags, commit.Tag)
+			}
+		}
+		return tags
+	}
+
+	// The tags present at the first poll are not built.
+	poll(domain.Commit{Hash: "1", Tag: "v1.0.0"})
+	// A tag pushed later is built.
+	poll(domain.Commit{Hash: "1", Tag: "v1.0.0"}, domain.Commit{Hash: "2", Tag: "v1.1.0"})
+
+	// The tags present when the patterns change are not built.
+	repo.Tags = pattern.List{"v*", "release-*"}
+	poll(domain.Commit{Hash: "1", Tag: "v1.0.0"}, domain.Commit{Hash: "3", Tag: "release-1"})
+	poll(domain.Commit{Hash: "1", Tag: "v1.0.0"}, domain.Commit{Hash: "3", Tag: "release-1"},
+		domain.Commit{Hash: "4", Tag: "release-2"})
+
+	require.Eventually(t, func() bool {
+		return len(builtTags()) == 2
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, []string{"v1.1.0", "release-2"}, builtTags())
+}
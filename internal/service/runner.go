@@ -3,91 +3,440 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/coverage"
+	"github.com/KirillMironov/ci/pkg/junit"
 	"github.com/KirillMironov/ci/pkg/logger"
 	"github.com/rs/xid"
 	"io"
+	"os"
+	"strconv"
+	"time"
 )
 
+// errCoverageDropped is returned if the build coverage dropped by more than a step allows.
+var errCoverageDropped = errors.New("coverage dropped")
+
+// junitStatuses maps the results of the JUnit test cases to the test statuses.
+var junitStatuses = [...]domain.Status{
+	junit.Passed:  domain.Success,
+	junit.Failed:  domain.Failure,
+	junit.Skipped: domain.Skipped,
+}
+
 // Runner used to execute pipeline.
 type Runner struct {
-	run           chan runRequest
-	executor      executor
-	buildsStorage domain.BuildsStorage
-	logger        logger.Logger
+	*liveness
+	run              chan runRequest
+	executor         executor
+	publisher        publisher
+	buildsStorage    domain.BuildsStorage
+	artifactsStorage domain.ArtifactsStorage
+	testsStorage     domain.TestsStorage
+	coverageStorage  domain.CoverageStorage
+	artifactFiles    fileOpener
+	logger           logger.Logger
 }
 
 type (
 	runRequest struct {
 		ctx         context.Context
-		repoId      string
+		repo        domain.Repository
 		commit      domain.Commit
+		trigger     domain.Trigger
 		pipeline    domain.Pipeline
 		srcCodePath string
+		buildId     string
+		done        chan struct{}
 	}
 	executor interface {
-		ExecuteStep(ctx context.Context, step domain.Step, srcCodePath string) (logs io.ReadCloser, err error)
+		ExecuteStep(ctx context.Context, step domain.Step, srcCodePath string) (logs io.ReadCloser,
+			artifacts []domain.Artifact, err error)
+	}
+	publisher interface {
+		Publish(domain.Event)
+	}
+	fileOpener interface {
+		Open(checksum string) (*os.File, error)
 	}
 )
 
-func NewRunner(executor executor, bs domain.BuildsStorage, logger logger.Logger) *Runner {
+func NewRunner(executor executor, publisher publisher, bs domain.BuildsStorage, as domain.ArtifactsStorage,
+	ts domain.TestsStorage, cs domain.CoverageStorage, artifactFiles fileOpener, logger logger.Logger) *Runner {
 	return &Runner{
-		run:           make(chan runRequest),
-		executor:      executor,
-		buildsStorage: bs,
-		logger:        logger,
+		liveness:         &liveness{},
+		run:              make(chan runRequest),
+		executor:         executor,
+		publisher:        publisher,
+		buildsStorage:    bs,
+		artifactsStorage: as,
+		testsStorage:     ts,
+		coverageStorage:  cs,
+		artifactFiles:    artifactFiles,
+		logger:           logger,
 	}
 }
 
 // Start listens on run channel and executes pipeline steps.
 func (r Runner) Start(ctx context.Context) {
+	stop := r.start()
+	defer stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			r.logger.Infof("runner stopped: %v", ctx.Err())
 			return
 		case req := <-r.run:
-			var (
-				build = domain.Build{
-					Id:     xid.New().String(),
-					RepoId: req.repoId,
-					Commit: req.commit,
-					Status: domain.InProgress,
-				}
-				logsBuf bytes.Buffer
-			)
-
-			err := r.buildsStorage.Create(build)
-			if err != nil {
-				r.logger.Error(err)
-				continue
-			}
+			r.runBuild(req)
+			close(req.done)
+		}
+	}
+}
+
+// runBuild executes the pipeline steps, stores the build and publishes its lifecycle events.
+func (r Runner) runBuild(req runRequest) {
+	var (
+		build = domain.Build{
+			Id:        req.buildId,
+			RepoId:    req.repo.Id,
+			Commit:    req.commit,
+			Trigger:   req.trigger,
+			Status:    domain.InProgress,
+			CreatedAt: time.Now(),
+		}
+		logsBuf bytes.Buffer
+	)
+
+	var previous *domain.Build
+
+	latest, err := latestBuild(r.buildsStorage, req.repo.Id, req.commit)
+	switch {
+	case err == nil:
+		previous = &latest
+	case !errors.Is(err, domain.ErrNotFound):
+		r.logger.Error(err)
+	}
+
+	build.Number, err = r.buildsStorage.Create(build)
+	if err != nil {
+		r.logger.Error(err)
+		r.publisher.Publish(buildEvent(domain.EventBuildAborted, req.repo, build))
+		return
+	}
+
+	r.publisher.Publish(buildEvent(domain.EventBuildStarted, req.repo, build))
+
+	build.Status = domain.Success
+
+	for _, step := range req.pipeline.Steps {
+		if !step.When.Match(req.commit, req.trigger) {
+			build.Steps = append(build.Steps, domain.StepAttempt{Step: step.Name, Attempt: 1, Status: domain.Skipped})
+			continue
+		}
+
+		step.Environment = append(buildEnvironment(build), step.Environment...)
+		step.Cache.Scope = cacheScope(req.repo, req.commit)
+
+		attempts := r.runStep(req, build, step, &logsBuf)
+		build.Steps = append(build.Steps, attempts...)
+		if attempts[len(attempts)-1].Status != domain.Success {
+			build.Status = domain.Failure
+			break
+		}
+	}
+
+	build.Log = domain.Log{Data: logsBuf.String()}
+	build.FinishedAt = time.Now()
+
+	err = r.buildsStorage.Update(build)
+	if err != nil {
+		r.logger.Error(err)
+	}
 
-			build.Status = domain.Success
-
-			for _, step := range req.pipeline.Steps {
-				err = func() error {
-					stepLogs, err := r.executor.ExecuteStep(req.ctx, step, req.srcCodePath)
-					_, _ = io.Copy(&logsBuf, stepLogs)
-					stepLogs.Close()
-					return err
-				}()
-				if err != nil {
-					build.Status = domain.Failure
-					break
-				}
+	var event = buildEvent(domain.EventBuildFinished, req.repo, build)
+	event.Previous = previous
+	r.publisher.Publish(event)
+}
+
+// buildEvent returns a build event of the given kind.
+func buildEvent(kind domain.EventKind, repo domain.Repository, build domain.Build) domain.Event {
+	var event = domain.NewEvent(kind, repo)
+	event.Build = &build
+	return event
+}
+
+// runStep executes the step, retrying it according to its retry policy, and returns all attempts made.
+func (r Runner) runStep(req runRequest, build domain.Build, step domain.Step,
+	logsBuf *bytes.Buffer) (attempts []domain.StepAttempt) {
+	for attempt := 1; attempt <= step.Retry.MaxAttempts(); attempt++ {
+		if attempt > 1 {
+			select {
+			case <-req.ctx.Done():
+				return attempts
+			case <-time.After(step.Retry.Delay(attempt)):
 			}
+		}
+
+		var event = buildEvent(domain.EventStepStarted, req.repo, build)
+		event.Step = &domain.StepAttempt{Step: step.Name, Attempt: attempt, Status: domain.InProgress}
+		r.publisher.Publish(event)
+
+		var stepLogsBuf bytes.Buffer
+
+		stepLogs, artifacts, err := r.executor.ExecuteStep(req.ctx, step, req.srcCodePath)
+		if stepLogs != nil {
+			_, _ = io.Copy(&stepLogsBuf, stepLogs)
+			stepLogs.Close()
+		}
+		logsBuf.Write(stepLogsBuf.Bytes())
+
+		r.saveArtifacts(build, step, artifacts)
+		r.saveTests(build, step, attempt, artifacts)
+		r.saveCoverage(build, step, artifacts)
+
+		if err == nil {
+			err = r.checkCoverage(build, step)
+		}
+
+		stepAttempt := domain.StepAttempt{
+			Step:    step.Name,
+			Attempt: attempt,
+			Status:  domain.Success,
+			Log:     domain.Log{Data: stepLogsBuf.String()},
+		}
+		if err != nil {
+			stepAttempt.Status = domain.Failure
+			stepAttempt.Error = err.Error()
+		}
+		attempts = append(attempts, stepAttempt)
+
+		event = buildEvent(domain.EventStepFinished, req.repo, build)
+		event.Step = &stepAttempt
+		r.publisher.Publish(event)
+
+		if err == nil || attempt == step.Retry.MaxAttempts() || !shouldRetry(step.Retry, err) {
+			return attempts
+		}
+		r.logger.Infof("step %q failed on attempt %d, retrying: %v", step.Name, attempt, err)
+	}
+
+	return attempts
+}
+
+// saveArtifacts records the artifacts collected after the step of the build.
+func (r Runner) saveArtifacts(build domain.Build, step domain.Step, artifacts []domain.Artifact) {
+	for _, artifact := range artifacts {
+		artifact.BuildId = build.Id
+		artifact.Step = step.Name
+		artifact.CreatedAt = time.Now()
+
+		err := r.artifactsStorage.Save(artifact)
+		if err != nil {
+			r.logger.Errorf("failed to save artifact %s: %v", artifact.Path, err)
+		}
+	}
+}
+
+// saveTests records the test cases of the JUnit reports among the artifacts collected after the attempt of the step
+// of the build. The test cases of every attempt are kept, so that a test failing and then passing on retry is flaky.
+func (r Runner) saveTests(build domain.Build, step domain.Step, attempt int, artifacts []domain.Artifact) {
+	if len(step.Reports.JUnit) == 0 {
+		return
+	}
 
-			build.Log = domain.Log{Data: logsBuf.String()}
+	var tests []domain.TestCase
 
-			err = r.buildsStorage.Update(build)
-			if err != nil {
-				r.logger.Error(err)
+	for _, artifact := range artifacts {
+		if !matchArtifact(step.Reports.JUnit, artifact.Path) {
+			continue
+		}
+
+		var cases []junit.Case
+
+		err := r.parseArtifact(artifact.Checksum, func(report io.Reader) (err error) {
+			cases, err = junit.Parse(report)
+			return err
+		})
+		if err != nil {
+			r.logger.Errorf("failed to parse JUnit report %s: %v", artifact.Path, err)
+			continue
+		}
+
+		for _, c := range cases {
+			tests = append(tests, domain.TestCase{
+				ClassName: c.ClassName,
+				Name:      c.Name,
+				Duration:  c.Time,
+				Status:    junitStatuses[c.Result],
+				Message:   c.Message,
+			})
+		}
+	}
+
+	err := r.testsStorage.Save(build.Id, step.Name, attempt, tests)
+	if err != nil {
+		r.logger.Errorf("failed to save tests of step %q: %v", step.Name, err)
+	}
+}
+
+// saveCoverage records the package coverage of the coverage reports among the artifacts collected after the step
+// of the build. The coverage of the previous attempts is replaced.
+func (r Runner) saveCoverage(build domain.Build, step domain.Step, artifacts []domain.Artifact) {
+	if len(step.Reports.Coverage) == 0 {
+		return
+	}
+
+	var packages []domain.PackageCoverage
+
+	for _, artifact := range artifacts {
+		if !matchArtifact(step.Reports.Coverage, artifact.Path) {
+			continue
+		}
+
+		err := r.parseArtifact(artifact.Checksum, func(report io.Reader) error {
+			pkgs, err := coverage.Parse(report)
+			for _, pkg := range pkgs {
+				packages = append(packages, domain.PackageCoverage{Name: pkg.Name, Covered: pkg.Covered, Total: pkg.Total})
 			}
+			return err
+		})
+		if err != nil {
+			r.logger.Errorf("failed to parse coverage report %s: %v", artifact.Path, err)
 		}
 	}
+
+	err := r.coverageStorage.Save(build.Id, step.Name, packages)
+	if err != nil {
+		r.logger.Errorf("failed to save coverage of step %q: %v", step.Name, err)
+	}
 }
 
+// checkCoverage fails the step if its coverage dropped by more than it allows, compared to the coverage of the same
+// step in the previous successful build of the branch. The coverage is not checked if it cannot be compared.
+func (r Runner) checkCoverage(build domain.Build, step domain.Step) error {
+	var maxDrop = step.Reports.MaxCoverageDrop
+	if maxDrop == nil || build.Commit.Branch == "" {
+		return nil
+	}
+
+	current, err := r.coverageStorage.GetByStep(build.Id, step.Name)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			r.logger.Error(err)
+		}
+		return nil
+	}
+
+	previous, err := r.coverageStorage.GetPrevious(build.RepoId, build.Commit.Branch, step.Name,
+		build.CreatedAt)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			r.logger.Error(err)
+		}
+		return nil
+	}
+
+	if previous.Percent()-current.Percent() > *maxDrop {
+		return fmt.Errorf("%w from %.2f%% to %.2f%%, by more than %.2f percentage points", errCoverageDropped,
+			previous.Percent(), current.Percent(), *maxDrop)
+	}
+	return nil
+}
+
+// parseArtifact parses the stored artifact file.
+func (r Runner) parseArtifact(checksum string, parse func(io.Reader) error) error {
+	file, err := r.artifactFiles.Open(checksum)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return parse(file)
+}
+
+// buildEnvironment returns the environment variables describing the build, which are passed to every step.
+func buildEnvironment(build domain.Build) []string {
+	var env = []string{
+		"CI=true",
+		"CI_BUILD_ID=" + build.Id,
+		"CI_BUILD_NUMBER=" + strconv.Itoa(build.Number),
+		"CI_BUILD_TRIGGER=" + string(build.Trigger),
+		"CI_COMMIT_SHA=" + build.Commit.Hash,
+	}
+	if build.Commit.Branch != "" {
+		env = append(env, "CI_BRANCH="+build.Commit.Branch)
+	}
+	if build.Commit.Tag != "" {
+		env = append(env, "CI_TAG="+build.Commit.Tag)
+	}
+	if pr := build.Commit.PullRequest; pr != nil {
+		env = append(env,
+			"CI_PULL_REQUEST="+strconv.Itoa(pr.Number),
+			"CI_PULL_REQUEST_SOURCE_BRANCH="+pr.SourceBranch,
+			"CI_PULL_REQUEST_TARGET_BRANCH="+pr.TargetBranch,
+		)
+	}
+	return env
+}
+
+// cacheScope returns the caches a build of the commit may use: those of its branch or tag, then those of the
+// repository default branch. Pull request builds restore the caches of the target branch and never save any,
+// so an untrusted change cannot poison the caches of the other builds.
+func cacheScope(repo domain.Repository, commit domain.Commit) domain.CacheScope {
+	var scope = domain.CacheScope{RepoId: repo.Id}
+
+	switch {
+	case commit.PullRequest != nil:
+		scope.ReadOnly = true
+		if commit.PullRequest.TargetBranch != "" {
+			scope.Refs = append(scope.Refs, "refs/heads/"+commit.PullRequest.TargetBranch)
+		}
+	case commit.Tag != "":
+		scope.Refs = append(scope.Refs, "refs/tags/"+commit.Tag)
+	case commit.Branch != "":
+		scope.Refs = append(scope.Refs, "refs/heads/"+commit.Branch)
+	}
+
+	if branch := repo.DefaultBranch(); branch != "" {
+		var ref = "refs/heads/" + branch
+		if len(scope.Refs) == 0 || scope.Refs[0] != ref {
+			scope.Refs = append(scope.Refs, ref)
+		}
+	}
+
+	return scope
+}
+
+// shouldRetry reports whether a step failed with the given error should be retried.
+// A dropped coverage is not retried.
+func shouldRetry(retry domain.Retry, err error) bool {
+	if errors.Is(err, errCoverageDropped) {
+		return false
+	}
+
+	var exitErr domain.ExitError
+	if errors.As(err, &exitErr) {
+		return retry.OnExitError
+	}
+	return true
+}
+
+// Run queues the build and waits for it to finish, so the source code is not changed while the build is running.
 func (r Runner) Run(req runRequest) {
+	req.buildId = xid.New().String()
+	req.done = make(chan struct{})
+
+	r.publisher.Publish(buildEvent(domain.EventBuildQueued, req.repo, domain.Build{
+		Id:      req.buildId,
+		RepoId:  req.repo.Id,
+		Commit:  req.commit,
+		Trigger: req.trigger,
+		Status:  domain.InProgress,
+	}))
+
 	r.run <- req
+	<-req.done
 }
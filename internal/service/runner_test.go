@@ -2,10 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/cas"
 	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/KirillMironov/ci/pkg/pattern"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 	"time"
 )
@@ -40,10 +44,11 @@ func TestRunner(t *testing.T) {
 
 			var (
 				buildsStorage = mock.NewBuilds()
-				runner        = NewRunner(tc.executor, buildsStorage, mock.Logger{})
-				req           = runRequest{
+				runner        = NewRunner(tc.executor, &mock.Publisher{}, buildsStorage, mock.NewArtifacts(),
+					mock.NewTests(), mock.NewCoverage(), nil, mock.Logger{})
+				req = runRequest{
 					ctx:    ctx,
-					repoId: "0",
+					repo:   domain.Repository{Id: "0"},
 					commit: domain.Commit{Hash: "123"},
 					pipeline: domain.Pipeline{
 						Name: "test",
@@ -59,13 +64,13 @@ func TestRunner(t *testing.T) {
 
 			runner.Run(req)
 
-			builds, err := buildsStorage.GetAllByRepoId(req.repoId)
+			builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
 			require.NoError(t, err)
 			require.Len(t, builds, 1)
 
 			build := builds[0]
 			assert.NotEmpty(t, build.Id)
-			assert.Equal(t, req.repoId, build.RepoId)
+			assert.Equal(t, req.repo.Id, build.RepoId)
 			assert.Equal(t, req.commit, build.Commit)
 			assert.Equal(t, expectedLog, build.Log.Data)
 			assert.Equal(t, tc.expectedStatus, build.Status)
@@ -73,3 +78,615 @@ func TestRunner(t *testing.T) {
 		})
 	}
 }
+
+func TestRunner_Retry(t *testing.T) {
+	var (
+		infraErr = errors.New("registry unavailable")
+		exitErr  = domain.ExitError{Code: 1}
+	)
+
+	tests := map[string]struct {
+		executor         *mock.FlakyExecutor
+		retry            domain.Retry
+		expectedStatus   domain.Status
+		expectedAttempts int
+	}{
+		"retried infrastructure error": {
+			executor:         &mock.FlakyExecutor{Failures: 2, Err: infraErr, Log: "ok"},
+			retry:            domain.Retry{Attempts: 3},
+			expectedStatus:   domain.Success,
+			expectedAttempts: 3,
+		},
+		"attempts exhausted": {
+			executor:         &mock.FlakyExecutor{Failures: 3, Err: infraErr},
+			retry:            domain.Retry{Attempts: 2},
+			expectedStatus:   domain.Failure,
+			expectedAttempts: 2,
+		},
+		"exit error not retried": {
+			executor:         &mock.FlakyExecutor{Failures: 1, Err: exitErr},
+			retry:            domain.Retry{Attempts: 3},
+			expectedStatus:   domain.Failure,
+			expectedAttempts: 1,
+		},
+		"exit error retried": {
+			executor:         &mock.FlakyExecutor{Failures: 1, Err: exitErr, Log: "ok"},
+			retry:            domain.Retry{Attempts: 3, OnExitError: true},
+			expectedStatus:   domain.Success,
+			expectedAttempts: 2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var (
+				buildsStorage = mock.NewBuilds()
+				runner        = NewRunner(tc.executor, &mock.Publisher{}, buildsStorage, mock.NewArtifacts(),
+					mock.NewTests(), mock.NewCoverage(), nil, mock.Logger{})
+				req = runRequest{
+					ctx:    ctx,
+					repo:   domain.Repository{Id: "0"},
+					commit: domain.Commit{Hash: "123"},
+					pipeline: domain.Pipeline{
+						Name: "test",
+						Steps: []domain.Step{
+							{Name: "flaky", Retry: tc.retry},
+						},
+					},
+					srcCodePath: ".",
+				}
+			)
+
+			go runner.Start(ctx)
+
+			runner.Run(req)
+
+			var build domain.Build
+			require.Eventually(t, func() bool {
+				builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
+				if err != nil || len(builds) != 1 || builds[0].Status == domain.InProgress {
+					return false
+				}
+				build = builds[0]
+				return true
+			}, time.Second, time.Millisecond*10)
+
+			assert.Equal(t, tc.expectedStatus, build.Status)
+			require.Len(t, build.Steps, tc.expectedAttempts)
+			for i, attempt := range build.Steps {
+				assert.Equal(t, "flaky", attempt.Step)
+				assert.Equal(t, i+1, attempt.Attempt)
+			}
+			assert.Equal(t, tc.expectedStatus, build.Steps[len(build.Steps)-1].Status)
+		})
+	}
+}
+
+func TestRunner_When(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		executor      = &mock.RecordingExecutor{}
+		buildsStorage = mock.NewBuilds()
+		runner        = NewRunner(executor, &mock.Publisher{}, buildsStorage, mock.NewArtifacts(), mock.NewTests(),
+			mock.NewCoverage(), nil, mock.Logger{})
+		req = runRequest{
+			ctx:     ctx,
+			repo:    domain.Repository{Id: "0"},
+			commit:  domain.Commit{Hash: "123", Tag: "v1.0.0"},
+			trigger: domain.TriggerTag,
+			pipeline: domain.Pipeline{
+				Name: "test",
+				Steps: []domain.Step{
+					{Name: "test"},
+					{Name: "push", When: domain.When{Branch: pattern.List{"main"}}},
+					{Name: "release", When: domain.When{Trigger: []domain.Trigger{domain.TriggerTag}}},
+				},
+			},
+			srcCodePath: ".",
+		}
+	)
+
+	go runner.Start(ctx)
+
+	runner.Run(req)
+
+	builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
+	require.NoError(t, err)
+	require.Len(t, builds, 1)
+
+	build := builds[0]
+	assert.Equal(t, domain.Success, build.Status)
+	assert.Equal(t, domain.TriggerTag, build.Trigger)
+	assert.Equal(t, 1, build.Number)
+	require.Len(t, build.Steps, 3)
+	assert.Equal(t, domain.Success, build.Steps[0].Status)
+	assert.Equal(t, domain.Skipped, build.Steps[1].Status)
+	assert.Equal(t, domain.Success, build.Steps[2].Status)
+
+	require.Len(t, executor.Steps, 2)
+	assert.Equal(t, "release", executor.Steps[1].Name)
+	assert.Contains(t, executor.Steps[1].Environment, "CI_TAG=v1.0.0")
+	assert.Contains(t, executor.Steps[1].Environment, "CI_BUILD_TRIGGER=tag")
+	assert.Contains(t, executor.Steps[1].Environment, "CI_BUILD_NUMBER=1")
+	assert.NotContains(t, executor.Steps[1].Environment, "CI_BRANCH=")
+}
+
+func TestRunner_Events(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		executor      = &mock.FlakyExecutor{}
+		publisher     = &mock.Publisher{}
+		buildsStorage = mock.NewBuilds()
+		runner        = NewRunner(executor, publisher, buildsStorage, mock.NewArtifacts(), mock.NewTests(),
+			mock.NewCoverage(), nil, mock.Logger{})
+		req = runRequest{
+			ctx:    ctx,
+			repo:   domain.Repository{Id: "0"},
+			commit: domain.Commit{Hash: "123", Branch: "main"},
+			pipeline: domain.Pipeline{
+				Name:  "test",
+				Steps: []domain.Step{{Name: "flaky", Retry: domain.Retry{Attempts: 2}}},
+			},
+			srcCodePath: ".",
+		}
+	)
+
+	go runner.Start(ctx)
+
+	*executor = mock.FlakyExecutor{Failures: 1, Err: errors.New("failed")}
+	runner.Run(req)
+
+	var (
+		events = publisher.Events()
+		kinds  []domain.EventKind
+	)
+	for _, event := range events {
+		kinds = append(kinds, event.Kind)
+		assert.Equal(t, req.repo, event.Repository)
+		require.NotNil(t, event.Build)
+		assert.Equal(t, events[0].Build.Id, event.Build.Id)
+	}
+	assert.Equal(t, []domain.EventKind{
+		domain.EventBuildQueued,
+		domain.EventBuildStarted,
+		domain.EventStepStarted,
+		domain.EventStepFinished,
+		domain.EventStepStarted,
+		domain.EventStepFinished,
+		domain.EventBuildFinished,
+	}, kinds)
+	assert.Equal(t, domain.StepAttempt{Step: "flaky", Attempt: 2, Status: domain.InProgress}, *events[4].Step)
+	assert.Equal(t, domain.Failure, events[3].Step.Status)
+	assert.Equal(t, domain.Success, events[5].Step.Status)
+
+	finished := events[len(events)-1]
+	assert.Equal(t, domain.Success, finished.Build.Status)
+	assert.Nil(t, finished.Previous)
+
+	*executor = mock.FlakyExecutor{Failures: 2, Err: errors.New("failed")}
+	runner.Run(req)
+
+	events = publisher.Events()
+	finished = events[len(events)-1]
+	assert.Equal(t, domain.Failure, finished.Build.Status)
+	require.NotNil(t, finished.Previous)
+	assert.Equal(t, events[0].Build.Id, finished.Build.Id)
+	assert.NotEqual(t, finished.Build.Id, finished.Previous.Id)
+	assert.Equal(t, domain.Success, finished.Previous.Status)
+}
+
+func TestRunner_Artifacts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		executor = mock.Executor{
+			HasError:  true,
+			Artifacts: []domain.Artifact{{Path: "coverage.out", Size: 1, Checksum: "abc"}},
+		}
+		buildsStorage    = mock.NewBuilds()
+		artifactsStorage = mock.NewArtifacts()
+		runner           = NewRunner(executor, &mock.Publisher{}, buildsStorage, artifactsStorage,
+			mock.NewTests(), mock.NewCoverage(), nil, mock.Logger{})
+		req = runRequest{
+			ctx:         ctx,
+			repo:        domain.Repository{Id: "0"},
+			commit:      domain.Commit{Hash: "123", Branch: "main"},
+			pipeline:    domain.Pipeline{Steps: []domain.Step{{Name: "test", Artifacts: pattern.List{"*.out"}}}},
+			srcCodePath: ".",
+		}
+	)
+
+	go runner.Start(ctx)
+
+	runner.Run(req)
+
+	builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
+	require.NoError(t, err)
+	require.Len(t, builds, 1)
+	assert.Equal(t, domain.Failure, builds[0].Status)
+
+	artifacts, err := artifactsStorage.GetAllByBuildId(builds[0].Id)
+	require.NoError(t, err)
+	require.Len(t, artifacts, 1, "artifacts of failed steps are kept")
+	assert.Equal(t, "test", artifacts[0].Step)
+	assert.Equal(t, "coverage.out", artifacts[0].Path)
+	assert.False(t, artifacts[0].CreatedAt.IsZero())
+}
+
+func TestRunner_Reports(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var files = cas.New(t.TempDir())
+
+	checksum, size, err := files.Put(strings.NewReader(`<testsuite>
+		<testcase classname="pkg" name="TestOk" time="0.25"/>
+		<testcase classname="pkg" name="TestFail"><failure message="expected 1"/></testcase>
+	</testsuite>`))
+	require.NoError(t, err)
+
+	var (
+		executor = mock.Executor{
+			HasError: true,
+			Artifacts: []domain.Artifact{
+				{Path: "reports/junit.xml", Size: size, Checksum: checksum},
+				{Path: "coverage.out", Size: size, Checksum: checksum},
+			},
+		}
+		buildsStorage = mock.NewBuilds()
+		testsStorage  = mock.NewTests()
+		runner        = NewRunner(executor, &mock.Publisher{}, buildsStorage, mock.NewArtifacts(), testsStorage,
+			mock.NewCoverage(), files, mock.Logger{})
+		req = runRequest{
+			ctx:    ctx,
+			repo:   domain.Repository{Id: "0"},
+			commit: domain.Commit{Hash: "123", Branch: "main"},
+			pipeline: domain.Pipeline{Steps: []domain.Step{{
+				Name:    "test",
+				Reports: domain.Reports{JUnit: pattern.List{"reports"}},
+			}}},
+			srcCodePath: ".",
+		}
+	)
+
+	go runner.Start(ctx)
+
+	runner.Run(req)
+
+	builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
+	require.NoError(t, err)
+	require.Len(t, builds, 1)
+
+	tests, err := testsStorage.GetAllByBuildId(builds[0].Id)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.TestCase{
+		{
+			BuildId:   builds[0].Id,
+			Step:      "test",
+			Attempt:   1,
+			ClassName: "pkg",
+			Name:      "TestOk",
+			Duration:  time.Millisecond * 250,
+			Status:    domain.Success,
+		},
+		{
+			BuildId:   builds[0].Id,
+			Step:      "test",
+			Attempt:   1,
+			ClassName: "pkg",
+			Name:      "TestFail",
+			Status:    domain.Failure,
+			Message:   "expected 1",
+		},
+	}, tests)
+}
+
+func TestRunner_ReportsRetried(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var files = cas.New(t.TempDir())
+
+	failed, failedSize, err := files.Put(strings.NewReader(`<testsuite>
+		<testcase classname="pkg" name="TestFlaky"><failure message="timeout"/></testcase>
+	</testsuite>`))
+	require.NoError(t, err)
+
+	passed, passedSize, err := files.Put(strings.NewReader(`<testsuite>
+		<testcase classname="pkg" name="TestFlaky"/>
+	</testsuite>`))
+	require.NoError(t, err)
+
+	var (
+		executor = &mock.FlakyExecutor{
+			Failures:         1,
+			Err:              domain.ExitError{Code: 1},
+			FailureArtifacts: []domain.Artifact{{Path: "junit.xml", Size: failedSize, Checksum: failed}},
+			Artifacts:        []domain.Artifact{{Path: "junit.xml", Size: passedSize, Checksum: passed}},
+		}
+		buildsStorage = mock.NewBuilds()
+		testsStorage  = mock.NewTests()
+		runner        = NewRunner(executor, &mock.Publisher{}, buildsStorage, mock.NewArtifacts(), testsStorage,
+			mock.NewCoverage(), files, mock.Logger{})
+		req = runRequest{
+			ctx:    ctx,
+			repo:   domain.Repository{Id: "0"},
+			commit: domain.Commit{Hash: "123", Branch: "main"},
+			pipeline: domain.Pipeline{Steps: []domain.Step{{
+				Name:    "test",
+				Retry:   domain.Retry{Attempts: 2, OnExitError: true},
+				Reports: domain.Reports{JUnit: pattern.List{"junit.xml"}},
+			}}},
+			srcCodePath: ".",
+		}
+	)
+
+	go runner.Start(ctx)
+
+	runner.Run(req)
+
+	builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
+	require.NoError(t, err)
+	require.Len(t, builds, 1)
+	assert.Equal(t, domain.Success, builds[0].Status)
+
+	tests, err := testsStorage.GetAllByBuildId(builds[0].Id)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.TestCase{
+		{
+			BuildId:   builds[0].Id,
+			Step:      "test",
+			Attempt:   1,
+			ClassName: "pkg",
+			Name:      "TestFlaky",
+			Status:    domain.Failure,
+			Message:   "timeout",
+		},
+		{
+			BuildId:   builds[0].Id,
+			Step:      "test",
+			Attempt:   2,
+			ClassName: "pkg",
+			Name:      "TestFlaky",
+			Status:    domain.Success,
+		},
+	}, tests)
+}
+
+func TestRunner_Coverage(t *testing.T) {
+	var files = cas.New(t.TempDir())
+
+	checksum, size, err := files.Put(strings.NewReader("mode: set\nexample.com/app/main.go:3.14,5.2 3 1\n" +
+		"example.com/app/main.go:7.14,9.2 1 0\n"))
+	require.NoError(t, err)
+
+	var maxDrop = 1.0
+
+	tests := map[string]struct {
+		previous       *domain.Coverage
+		expectedStatus domain.Status
+	}{
+		"no previous build": {
+			previous:       nil,
+			expectedStatus: domain.Success,
+		},
+		"within threshold": {
+			previous:       &domain.Coverage{Covered: 76, Total: 100},
+			expectedStatus: domain.Success,
+		},
+		"dropped": {
+			previous:       &domain.Coverage{Covered: 77, Total: 100},
+			expectedStatus: domain.Failure,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var (
+				executor = mock.Executor{
+					Artifacts: []domain.Artifact{{Path: "coverage.out", Size: size, Checksum: checksum}},
+				}
+				buildsStorage   = mock.NewBuilds()
+				coverageStorage = mock.NewCoverage()
+				runner          = NewRunner(executor, &mock.Publisher{}, buildsStorage, mock.NewArtifacts(),
+					mock.NewTests(), coverageStorage, files, mock.Logger{})
+				req = runRequest{
+					ctx:    ctx,
+					repo:   domain.Repository{Id: "0"},
+					commit: domain.Commit{Hash: "123", Branch: "main"},
+					pipeline: domain.Pipeline{Steps: []domain.Step{{
+						Name: "test",
+						Reports: domain.Reports{
+							Coverage:        pattern.List{"*.out"},
+							MaxCoverageDrop: &maxDrop,
+						},
+						Retry: domain.Retry{Attempts: 2},
+					}}},
+					srcCodePath: ".",
+				}
+			)
+			if tc.previous != nil {
+				coverageStorage.PreviousSteps = map[string]domain.Coverage{"test": *tc.previous}
+			}
+
+			go runner.Start(ctx)
+
+			runner.Run(req)
+
+			builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
+			require.NoError(t, err)
+			require.Len(t, builds, 1)
+			assert.Equal(t, tc.expectedStatus, builds[0].Status)
+			require.Len(t, builds[0].Steps, 1, "a dropped coverage is not retried")
+			if tc.expectedStatus == domain.Failure {
+				assert.Equal(t, "coverage dropped from 77.00% to 75.00%, by more than 1.00 percentage points",
+					builds[0].Steps[0].Error)
+			}
+
+			coverage, err := coverageStorage.GetByBuildId(builds[0].Id)
+			require.NoError(t, err)
+			assert.Equal(t, []domain.PackageCoverage{{Name: "example.com/app", Covered: 3, Total: 4}},
+				coverage.Packages)
+		})
+	}
+}
+
+func TestRunner_CoverageSteps(t *testing.T) {
+	var files = cas.New(t.TempDir())
+
+	checksum, size, err := files.Put(strings.NewReader("mode: set\nexample.com/app/main.go:3.14,5.2 3 1\n" +
+		"example.com/app/main.go:7.14,9.2 1 0\n"))
+	require.NoError(t, err)
+
+	var maxDrop = 1.0
+
+	// The build coverage was higher, but each step is compared to the same step of the previous build.
+	tests := map[string]struct {
+		previousSteps  map[string]domain.Coverage
+		expectedStatus domain.Status
+		expectedError  string
+	}{
+		"steps kept their coverage": {
+			previousSteps: map[string]domain.Coverage{
+				"unit":        {Covered: 75, Total: 100},
+				"integration": {Covered: 74, Total: 100},
+			},
+			expectedStatus: domain.Success,
+		},
+		"second step dropped": {
+			previousSteps: map[string]domain.Coverage{
+				"unit":        {Covered: 75, Total: 100},
+				"integration": {Covered: 80, Total: 100},
+			},
+			expectedStatus: domain.Failure,
+			expectedError:  "coverage dropped from 80.00% to 75.00%, by more than 1.00 percentage points",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var (
+				executor = mock.Executor{
+					Artifacts: []domain.Artifact{{Path: "coverage.out", Size: size, Checksum: checksum}},
+				}
+				buildsStorage   = mock.NewBuilds()
+				coverageStorage = mock.NewCoverage()
+				runner          = NewRunner(executor, &mock.Publisher{}, buildsStorage, mock.NewArtifacts(),
+					mock.NewTests(), coverageStorage, files, mock.Logger{})
+				reports = domain.Reports{Coverage: pattern.List{"*.out"}, MaxCoverageDrop: &maxDrop}
+				req     = runRequest{
+					ctx:    ctx,
+					repo:   domain.Repository{Id: "0"},
+					commit: domain.Commit{Hash: "123", Branch: "main"},
+					pipeline: domain.Pipeline{Steps: []domain.Step{
+						{Name: "unit", Reports: reports},
+						{Name: "integration", Reports: reports},
+					}},
+					srcCodePath: ".",
+				}
+			)
+			coverageStorage.Previous = &domain.Coverage{Covered: 90, Total: 100}
+			coverageStorage.PreviousSteps = tc.previousSteps
+
+			go runner.Start(ctx)
+
+			runner.Run(req)
+
+			builds, err := buildsStorage.GetAllByRepoId(req.repo.Id)
+			require.NoError(t, err)
+			require.Len(t, builds, 1)
+			assert.Equal(t, tc.expectedStatus, builds[0].Status)
+			require.Len(t, builds[0].Steps, 2)
+			assert.Equal(t, domain.Success, builds[0].Steps[0].Status)
+			assert.Equal(t, tc.expectedError, builds[0].Steps[1].Error)
+
+			coverage, err := coverageStorage.GetByBuildId(builds[0].Id)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), coverage.Covered, "the package of both steps is counted once")
+			assert.Equal(t, int64(4), coverage.Total)
+		})
+	}
+}
+
+// failingBuilds fails to create builds.
+type failingBuilds struct {
+	domain.BuildsStorage
+}
+
+func (failingBuilds) Create(domain.Build) (int, error) {
+	return 0, errors.New("failed")
+}
+
+func TestRunner_Aborted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		publisher = &mock.Publisher{}
+		runner    = NewRunner(&mock.FlakyExecutor{}, publisher, failingBuilds{mock.NewBuilds()}, mock.NewArtifacts(),
+			mock.NewTests(), mock.NewCoverage(), nil, mock.Logger{})
+	)
+
+	go runner.Start(ctx)
+
+	runner.Run(runRequest{
+		ctx:      ctx,
+		repo:     domain.Repository{Id: "0"},
+		commit:   domain.Commit{Hash: "123", Branch: "main"},
+		pipeline: domain.Pipeline{Name: "test", Steps: []domain.Step{{Name: "test"}}},
+	})
+
+	var kinds []domain.EventKind
+	for _, event := range publisher.Events() {
+		kinds = append(kinds, event.Kind)
+	}
+	assert.Equal(t, []domain.EventKind{domain.EventBuildQueued, domain.EventBuildAborted}, kinds)
+}
+
+func TestRunner_CacheScope(t *testing.T) {
+	var repo = domain.Repository{Id: "repo", Branches: pattern.List{"release/*", "main"}}
+
+	tests := map[string]struct {
+		commit   domain.Commit
+		expected domain.CacheScope
+	}{
+		"branch": {
+			commit:   domain.Commit{Branch: "feature"},
+			expected: domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/feature", "refs/heads/main"}},
+		},
+		"default branch": {
+			commit:   domain.Commit{Branch: "main"},
+			expected: domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/main"}},
+		},
+		"tag": {
+			commit:   domain.Commit{Tag: "v1.0.0"},
+			expected: domain.CacheScope{RepoId: "repo", Refs: []string{"refs/tags/v1.0.0", "refs/heads/main"}},
+		},
+		"pull request": {
+			commit: domain.Commit{Branch: "feature", PullRequest: &domain.PullRequest{Number: 1,
+				SourceBranch: "feature", TargetBranch: "release/1"}},
+			expected: domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/release/1", "refs/heads/main"},
+				ReadOnly: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, cacheScope(repo, tc.commit))
+		})
+	}
+}
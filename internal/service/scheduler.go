@@ -3,97 +3,332 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/KirillMironov/ci/internal/domain"
 	"github.com/KirillMironov/ci/pkg/logger"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/xid"
 	"sync"
+	"time"
 )
 
-// Scheduler used to schedule repositories polling.
+// cronResolution is how often cron schedules are evaluated.
+const cronResolution = time.Minute
+
+// Scheduler used to schedule repositories polling and cron builds.
 type Scheduler struct {
-	add                 chan domain.Repository
-	remove              chan string
-	activePolling       map[string]context.CancelFunc
+	*liveness
+	add                 chan addRequest
+	remove              chan removeRequest
+	update              chan updateRequest
+	trigger             chan triggerRequest
+	activePolling       map[string]polling
 	once                sync.Once
 	poller              poller
+	publisher           publisher
 	repositoriesStorage domain.RepositoriesStorage
+	schedulesStorage    domain.SchedulesStorage
 	logger              logger.Logger
 }
 
-type poller interface {
-	AddRepository(context.Context, domain.Repository)
-}
+type (
+	addRequest struct {
+		repo domain.Repository
+		err  chan error
+	}
+	removeRequest struct {
+		id  string
+		err chan error
+	}
+	updateRequest struct {
+		id     string
+		update func(*domain.Repository)
+		// repo is set to the updated repository before err is sent.
+		repo *domain.Repository
+		err  chan error
+	}
+	// polling is a polled repository. Its context, used by the cron and triggered builds, is cancelled when
+	// the polling stops. The poll loop is restarted when the repository is updated.
+	polling struct {
+		ctx      context.Context
+		cancel   context.CancelFunc
+		stopLoop context.CancelFunc
+	}
+	triggerRequest struct {
+		repo    domain.Repository
+		commits []domain.Commit
+	}
+	poller interface {
+		AddRepository(context.Context, domain.Repository)
+		Trigger(context.Context, domain.Repository, domain.Trigger)
+		TriggerCommit(context.Context, domain.Repository, domain.Commit)
+	}
+)
 
-func NewScheduler(poller poller, rs domain.RepositoriesStorage, logger logger.Logger) *Scheduler {
+func NewScheduler(poller poller, publisher publisher, rs domain.RepositoriesStorage, ss domain.SchedulesStorage,
+	logger logger.Logger) *Scheduler {
 	return &Scheduler{
-		add:                 make(chan domain.Repository),
-		remove:              make(chan string),
-		activePolling:       make(map[string]context.CancelFunc),
+		liveness:            &liveness{},
+		add:                 make(chan addRequest),
+		remove:              make(chan removeRequest),
+		update:              make(chan updateRequest),
+		trigger:             make(chan triggerRequest),
+		activePolling:       make(map[string]polling),
 		poller:              poller,
+		publisher:           publisher,
 		repositoriesStorage: rs,
+		schedulesStorage:    ss,
 		logger:              logger,
 	}
 }
 
-// Start listens for repositories additions and deletions and starts polling.
+// Start listens for repositories additions, updates and deletions and polls the enabled repositories.
+// It also evaluates cron schedules and triggers builds of the repositories that are due.
 func (s *Scheduler) Start(ctx context.Context) {
+	stop := s.start()
+	defer stop()
+
 	s.once.Do(func() {
-		go func() {
-			repos, err := s.repositoriesStorage.GetAll()
-			if err != nil {
-				s.logger.Error(err)
-				return
-			}
+		repos, err := s.repositoriesStorage.GetAll()
+		if err != nil {
+			s.logger.Error(err)
+			return
+		}
 
-			for _, repo := range repos {
-				pollCtx, cancel := context.WithCancel(ctx)
-				s.activePolling[repo.Id] = cancel
-				s.poller.AddRepository(pollCtx, repo)
+		for _, repo := range repos {
+			if repo.Enabled {
+				s.startPolling(ctx, repo)
 			}
-		}()
+		}
 	})
 
+	var ticker = time.NewTicker(cronResolution)
+	defer ticker.Stop()
+
+	var lastTick = time.Now()
+
 	for {
 		select {
 		case <-ctx.Done():
 			s.logger.Infof("scheduler stopped: %v", ctx.Err())
 			return
-		case repo := <-s.add:
-			_, err := s.repositoriesStorage.GetByURL(repo.URL)
-			if !errors.Is(err, domain.ErrNotFound) {
-				s.logger.Errorf("repository with url %q already exists", repo.URL)
+		case now := <-ticker.C:
+			s.runSchedules(lastTick, now)
+			lastTick = now
+		case req := <-s.add:
+			req.err <- s.applyAdd(ctx, req.repo)
+		case req := <-s.remove:
+			req.err <- s.applyRemove(req.id)
+		case req := <-s.update:
+			req.err <- s.applyUpdate(ctx, req.id, req.update, req.repo)
+		case req := <-s.trigger:
+			polling, ok := s.activePolling[req.repo.Id]
+			if !ok {
 				continue
 			}
 
-			repo.Id = xid.New().String()
-
-			err = s.repositoriesStorage.Create(repo)
-			if err != nil {
-				s.logger.Errorf("failed to create repository: %v", err)
-				continue
+			if len(req.commits) == 0 {
+				s.poller.Trigger(polling.ctx, req.repo, domain.TriggerPush)
 			}
-
-			pollCtx, cancel := context.WithCancel(ctx)
-			s.activePolling[repo.Id] = cancel
-			s.poller.AddRepository(pollCtx, repo)
-		case id := <-s.remove:
-			if cancel, ok := s.activePolling[id]; ok {
-				cancel()
-				delete(s.activePolling, id)
+			for _, commit := range req.commits {
+				s.poller.TriggerCommit(polling.ctx, req.repo, commit)
 			}
+		}
+	}
+}
 
-			err := s.repositoriesStorage.Delete(id)
-			if err != nil {
-				s.logger.Errorf("failed to delete repository: %v", err)
-			}
+// applyAdd stores the repository unless its URL is already added and starts polling it if it is enabled.
+func (s *Scheduler) applyAdd(ctx context.Context, repo domain.Repository) error {
+	_, err := s.repositoriesStorage.GetByURL(repo.URL)
+	if err == nil {
+		return fmt.Errorf("repository with url %q: %w", repo.URL, domain.ErrAlreadyExists)
+	}
+	if !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+
+	err = s.repositoriesStorage.Create(repo)
+	if err != nil {
+		return err
+	}
+
+	if repo.Enabled {
+		s.startPolling(ctx, repo)
+	}
+
+	s.publisher.Publish(domain.NewEvent(domain.EventRepositoryAdded, repo))
+	return nil
+}
+
+// applyRemove stops polling the repository and deletes it.
+func (s *Scheduler) applyRemove(id string) error {
+	repo, err := s.repositoriesStorage.GetById(id)
+	if err != nil {
+		return err
+	}
+
+	s.stopPolling(id)
+
+	err = s.repositoriesStorage.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	s.publisher.Publish(domain.NewEvent(domain.EventRepositoryRemoved, repo))
+	return nil
+}
+
+// applyUpdate applies the update to the stored repository, stores it into updated and restarts its polling
+// if it is enabled or stops it otherwise.
+func (s *Scheduler) applyUpdate(ctx context.Context, id string, update func(*domain.Repository),
+	updated *domain.Repository) error {
+	repo, err := s.repositoriesStorage.GetById(id)
+	if err != nil {
+		return err
+	}
+
+	update(&repo)
+	repo.Id = id
+
+	err = s.repositoriesStorage.Update(repo)
+	if err != nil {
+		return err
+	}
+	*updated = repo
+
+	if repo.Enabled {
+		s.startPolling(ctx, repo)
+	} else {
+		s.stopPolling(repo.Id)
+	}
+
+	s.publisher.Publish(domain.NewEvent(domain.EventRepositoryUpdated, repo))
+	return nil
+}
+
+// startPolling starts polling the repository until stopPolling is called or ctx is done. If the repository
+// is already polled, its poll loop is restarted with the new settings and its builds keep running.
+func (s *Scheduler) startPolling(ctx context.Context, repo domain.Repository) {
+	polling, ok := s.activePolling[repo.Id]
+	if ok {
+		polling.stopLoop()
+	} else {
+		polling.ctx, polling.cancel = context.WithCancel(ctx)
+	}
+
+	var loopCtx context.Context
+	loopCtx, polling.stopLoop = context.WithCancel(polling.ctx)
+
+	s.activePolling[repo.Id] = polling
+	s.poller.AddRepository(loopCtx, repo)
+}
+
+// stopPolling stops polling the repository, if it is polled, cancelling its builds.
+func (s *Scheduler) stopPolling(id string) {
+	if polling, ok := s.activePolling[id]; ok {
+		polling.cancel()
+		delete(s.activePolling, id)
+	}
+}
+
+// runSchedules triggers cron builds of the polled repositories whose schedules were due in (from, to].
+// The builds are cancelled when the polling of their repository stops.
+func (s *Scheduler) runSchedules(from, to time.Time) {
+	schedules, err := s.schedulesStorage.GetAll()
+	if err != nil {
+		s.logger.Errorf("failed to get schedules: %v", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		polling, ok := s.activePolling[schedule.RepoId]
+		if !ok {
+			continue
+		}
+
+		due, err := isDue(schedule.Expression, from, to)
+		if err != nil {
+			s.logger.Errorf("invalid schedule %s: %v", schedule.Id, err)
+			continue
 		}
+		if !due {
+			continue
+		}
+
+		repo, err := s.repositoriesStorage.GetById(schedule.RepoId)
+		if err != nil {
+			s.logger.Errorf("failed to get repository: %v", err)
+			continue
+		}
+		if schedule.Branch != "" {
+			repo.Branches = pattern.List{schedule.Branch}
+		}
+
+		s.poller.Trigger(polling.ctx, repo, domain.TriggerCron)
 	}
 }
 
-func (s *Scheduler) Add(repo domain.Repository) {
-	s.add <- repo
+// isDue reports whether the cron expression has an activation time in (from, to].
+func isDue(expression string, from, to time.Time) (bool, error) {
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return false, err
+	}
+	return !schedule.Next(from).After(to), nil
+}
+
+// Add assigns an id to the repository, stores it and starts polling it if it is enabled.
+// It returns domain.ErrAlreadyExists if a repository with the same URL is already added.
+func (s *Scheduler) Add(repo domain.Repository) (domain.Repository, error) {
+	repo.Id = xid.New().String()
+	repo.CreatedAt = time.Now()
+
+	var req = addRequest{repo: repo, err: make(chan error, 1)}
+	s.add <- req
+	return repo, <-req.err
+}
+
+// Remove stops polling the repository and deletes it along with its builds.
+// It returns domain.ErrNotFound if there is no such repository.
+func (s *Scheduler) Remove(id string) error {
+	var req = removeRequest{id: id, err: make(chan error, 1)}
+	s.remove <- req
+	return <-req.err
+}
+
+// Update applies the update to the settings of the repository, stores them and restarts its polling with them.
+// Polling is stopped if the repository is disabled. The update is applied by the scheduler, so that concurrent
+// updates are not lost. It returns the updated repository or domain.ErrNotFound if there is no such repository.
+func (s *Scheduler) Update(id string, update func(*domain.Repository)) (domain.Repository, error) {
+	var (
+		repo domain.Repository
+		req  = updateRequest{id: id, update: update, repo: &repo, err: make(chan error, 1)}
+	)
+	s.update <- req
+	err := <-req.err
+	return repo, err
+}
+
+// Pause disables the repository and stops its polling, cron builds and webhook builds.
+func (s *Scheduler) Pause(id string) error {
+	return s.setEnabled(id, false)
+}
+
+// Resume enables the repository and restarts its polling.
+func (s *Scheduler) Resume(id string) error {
+	return s.setEnabled(id, true)
+}
+
+func (s *Scheduler) setEnabled(id string, enabled bool) error {
+	_, err := s.Update(id, func(repo *domain.Repository) {
+		repo.Enabled = enabled
+	})
+	return err
 }
 
-func (s *Scheduler) Remove(id string) {
-	s.remove <- id
+// Trigger builds the given commits of a polled repository.
+// If no commits are given, the repository is polled immediately.
+func (s *Scheduler) Trigger(repo domain.Repository, commits ...domain.Commit) {
+	s.trigger <- triggerRequest{repo: repo, commits: commits}
 }
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/duration"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIsDue(t *testing.T) {
+	var midnight = time.Date(2022, 9, 1, 0, 0, 0, 0, time.Local)
+
+	tests := map[string]struct {
+		expression    string
+		from, to      time.Time
+		expectedDue   bool
+		expectedError bool
+	}{
+		"due": {
+			expression:  "0 0 * * *",
+			from:        midnight.Add(-time.Minute),
+			to:          midnight,
+			expectedDue: true,
+		},
+		"not due yet": {
+			expression:  "0 0 * * *",
+			from:        midnight.Add(-time.Minute * 2),
+			to:          midnight.Add(-time.Minute),
+			expectedDue: false,
+		},
+		"already passed": {
+			expression:  "0 0 * * *",
+			from:        midnight,
+			to:          midnight.Add(time.Minute),
+			expectedDue: false,
+		},
+		"invalid expression": {
+			expression:    "-",
+			from:          midnight,
+			to:            midnight.Add(time.Minute),
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			due, err := isDue(tc.expression, tc.from, tc.to)
+			assert.Equal(t, tc.expectedError, err != nil)
+			assert.Equal(t, tc.expectedDue, due)
+		})
+	}
+}
+
+func TestScheduler_Update(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		repo = domain.Repository{Id: "0", URL: "example.com", Branches: pattern.List{"main"},
+			PollingInterval: duration.Duration(time.Minute), Enabled: true}
+		disabled            = domain.Repository{Id: "1", URL: "example.org", Enabled: false}
+		poller              = &mock.RecordingPoller{}
+		publisher           = &mock.Publisher{}
+		repositoriesStorage = mock.NewRepositories()
+		scheduler           = NewScheduler(poller, publisher, repositoriesStorage, nil, mock.Logger{})
+	)
+
+	require.NoError(t, repositoriesStorage.Create(repo))
+	require.NoError(t, repositoriesStorage.Create(disabled))
+
+	go scheduler.Start(ctx)
+
+	repo.Branches = pattern.List{"release/*"}
+	repo.PollingInterval = duration.Duration(time.Hour)
+	updated, err := scheduler.Update(repo.Id, func(stored *domain.Repository) {
+		stored.Branches = repo.Branches
+		stored.PollingInterval = repo.PollingInterval
+	})
+	require.NoError(t, err)
+	assert.Equal(t, repo, updated)
+
+	polled := poller.Polled()
+	require.Len(t, polled, 2)
+	assert.Equal(t, "0", polled[0].Repo.Id)
+	assert.Error(t, polled[0].Ctx.Err())
+	assert.Equal(t, repo.Branches, polled[1].Repo.Branches)
+	assert.Equal(t, repo.PollingInterval, polled[1].Repo.PollingInterval)
+	assert.NoError(t, polled[1].Ctx.Err())
+
+	stored, err := repositoriesStorage.GetById(repo.Id)
+	require.NoError(t, err)
+	assert.Equal(t, repo.Branches, stored.Branches)
+
+	_, err = scheduler.Update(repo.Id, func(stored *domain.Repository) { stored.Enabled = false })
+	require.NoError(t, err)
+	assert.Error(t, polled[1].Ctx.Err())
+	assert.Len(t, poller.Polled(), 2)
+
+	events := publisher.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, domain.EventRepositoryUpdated, events[1].Kind)
+	assert.False(t, events[1].Repository.Enabled)
+
+	// Concurrent updates of different settings are applied one after another.
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(keepLast int) {
+			defer wg.Done()
+			_, err := scheduler.Update(disabled.Id, func(stored *domain.Repository) {
+				stored.Name += "a"
+				stored.Retention.KeepLast += keepLast
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	stored, err = repositoriesStorage.GetById(disabled.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaaaaaa", stored.Name)
+	assert.Equal(t, 55, stored.Retention.KeepLast)
+
+	_, err = scheduler.Update("-", func(*domain.Repository) {})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestScheduler_PauseResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		repo                = domain.Repository{Id: "0", URL: "example.com", Enabled: true}
+		poller              = &mock.RecordingPoller{}
+		repositoriesStorage = mock.NewRepositories()
+		scheduler           = NewScheduler(poller, &mock.Publisher{}, repositoriesStorage, nil, mock.Logger{})
+	)
+
+	require.NoError(t, repositoriesStorage.Create(repo))
+
+	go scheduler.Start(ctx)
+
+	require.NoError(t, scheduler.Pause(repo.Id))
+
+	polled := poller.Polled()
+	require.Len(t, polled, 1)
+	assert.Error(t, polled[0].Ctx.Err())
+
+	stored, err := repositoriesStorage.GetById(repo.Id)
+	require.NoError(t, err)
+	assert.False(t, stored.Enabled)
+
+	require.NoError(t, scheduler.Resume(repo.Id))
+
+	polled = poller.Polled()
+	require.Len(t, polled, 2)
+	assert.NoError(t, polled[1].Ctx.Err())
+	assert.True(t, polled[1].Repo.Enabled)
+
+	assert.ErrorIs(t, scheduler.Pause("-"), domain.ErrNotFound)
+}
+
+func TestScheduler_AddRemove(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		poller              = &mock.RecordingPoller{}
+		repositoriesStorage = mock.NewRepositories()
+		scheduler           = NewScheduler(poller, &mock.Publisher{}, repositoriesStorage, nil, mock.Logger{})
+	)
+
+	go scheduler.Start(ctx)
+
+	repo, err := scheduler.Add(domain.Repository{URL: "example.com", Enabled: true})
+	require.NoError(t, err)
+	assert.NotEmpty(t, repo.Id)
+	assert.False(t, repo.CreatedAt.IsZero())
+
+	stored, err := repositoriesStorage.GetById(repo.Id)
+	require.NoError(t, err)
+	assert.Equal(t, repo.URL, stored.URL)
+
+	_, err = scheduler.Add(domain.Repository{URL: "example.com", Enabled: true})
+	assert.ErrorIs(t, err, domain.ErrAlreadyExists)
+
+	polled := poller.Polled()
+	require.Len(t, polled, 1)
+	assert.Equal(t, repo.Id, polled[0].Repo.Id)
+
+	require.NoError(t, scheduler.Remove(repo.Id))
+	assert.Error(t, polled[0].Ctx.Err())
+
+	_, err = repositoriesStorage.GetById(repo.Id)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	assert.ErrorIs(t, scheduler.Remove(repo.Id), domain.ErrNotFound)
+}
+
+func TestScheduler_RunSchedules(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		repo                = domain.Repository{Id: "0", URL: "example.com", Enabled: true}
+		midnight            = time.Date(2022, 9, 1, 0, 0, 0, 0, time.Local)
+		poller              = &mock.RecordingPoller{}
+		repositoriesStorage = mock.NewRepositories()
+		schedulesStorage    = mock.NewSchedules()
+		scheduler           = NewScheduler(poller, &mock.Publisher{}, repositoriesStorage, schedulesStorage,
+			mock.Logger{})
+	)
+
+	require.NoError(t, repositoriesStorage.Create(repo))
+	require.NoError(t, schedulesStorage.Create(domain.Schedule{Id: "0", RepoId: repo.Id, Expression: "0 0 * * *",
+		Branch: "nightly"}))
+
+	scheduler.startPolling(ctx, repo)
+	scheduler.runSchedules(midnight.Add(-time.Minute), midnight)
+
+	triggered := poller.Triggered()
+	require.Len(t, triggered, 1)
+	assert.Equal(t, domain.TriggerCron, triggered[0].Trigger)
+	assert.Equal(t, pattern.List{"nightly"}, triggered[0].Repo.Branches)
+
+	go scheduler.Start(ctx)
+
+	_, err := scheduler.Update(repo.Id, func(stored *domain.Repository) { stored.Name = "renamed" })
+	require.NoError(t, err)
+	assert.NoError(t, triggered[0].Ctx.Err(), "the cron builds keep running when the repository is updated")
+
+	require.NoError(t, scheduler.Pause(repo.Id))
+	assert.Error(t, triggered[0].Ctx.Err(), "the cron builds are cancelled when the repository is paused")
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/logger"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statusContext is the name under which commit statuses are reported.
+const statusContext = "ci"
+
+var ErrUnknownStatusProvider = errors.New("unknown status provider")
+
+// StatusReporter used to report build statuses as commit statuses to GitHub, GitLab and Gitea.
+type StatusReporter struct {
+	client      *http.Client
+	externalURL string
+	// Maximum number of attempts to post a status.
+	attempts int
+	// Delay before the second attempt, doubled for each following one.
+	backoff time.Duration
+	logger  logger.Logger
+	// reports are the latest statuses being reported by commit, closed once reported.
+	reports map[string]chan struct{}
+	mu      sync.Mutex
+}
+
+func NewStatusReporter(client *http.Client, externalURL string, logger logger.Logger) *StatusReporter {
+	return &StatusReporter{
+		client:      client,
+		externalURL: strings.TrimSuffix(externalURL, "/"),
+		attempts:    3,
+		backoff:     time.Second,
+		logger:      logger,
+		reports:     make(map[string]chan struct{}),
+	}
+}
+
+// Report posts the build status as a commit status to the repository status provider.
+// It does nothing if the repository has no status provider configured.
+// Network errors, rate limits and server errors are retried.
+func (sr *StatusReporter) Report(ctx context.Context, repo domain.Repository, build domain.Build) error {
+	if repo.StatusProvider == "" {
+		return nil
+	}
+
+	var err error
+
+	for attempt := 1; attempt <= sr.attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(sr.backoff << (attempt - 2)):
+			}
+		}
+
+		var retryable bool
+
+		retryable, err = sr.post(ctx, repo, build)
+		if err == nil || !retryable {
+			return err
+		}
+	}
+
+	return fmt.Errorf("failed to report status after %d attempts: %w", sr.attempts, err)
+}
+
+// HandleEvent reports the status of started and finished builds in the background, so a slow status provider
+// does not hold up the following events. The statuses of a commit are reported in the order of the events.
+// Errors are logged.
+func (sr *StatusReporter) HandleEvent(ctx context.Context, event domain.Event) error {
+	switch event.Kind {
+	case domain.EventBuildStarted, domain.EventBuildFinished:
+	default:
+		return nil
+	}
+
+	if event.Repository.StatusProvider == "" {
+		return nil
+	}
+
+	var (
+		repo  = event.Repository
+		build = *event.Build
+		key   = repo.Id + "/" + build.Commit.Hash
+		done  = make(chan struct{})
+	)
+
+	sr.mu.Lock()
+	previous := sr.reports[key]
+	sr.reports[key] = done
+	sr.mu.Unlock()
+
+	go func() {
+		defer func() {
+			sr.mu.Lock()
+			if sr.reports[key] == done {
+				delete(sr.reports, key)
+			}
+			sr.mu.Unlock()
+			close(done)
+		}()
+
+		if previous != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-previous:
+			}
+		}
+
+		err := sr.Report(ctx, repo, build)
+		if err != nil {
+			sr.logger.Errorf("failed to report status of build %s: %v", build.Id, err)
+		}
+	}()
+
+	return nil
+}
+
+// post sends a single status request and reports whether a failed request can be retried.
+func (sr *StatusReporter) post(ctx context.Context, repo domain.Repository, build domain.Build) (retryable bool,
+	_ error) {
+	req, err := sr.newRequest(ctx, repo, build)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := sr.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+func (sr *StatusReporter) newRequest(ctx context.Context, repo domain.Repository, build domain.Build) (*http.Request,
+	error) {
+	project, err := projectPath(repo.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		baseURL     = strings.TrimSuffix(repo.StatusURL, "/")
+		targetURL   = fmt.Sprintf("%s/api/v1/repositories/%s/builds/%s", sr.externalURL, repo.Id, build.Id)
+		description = "Build " + build.Status.String()
+		endpoint    string
+		body        any
+	)
+
+	switch repo.StatusProvider {
+	case domain.GitHub, domain.Gitea:
+		endpoint = fmt.Sprintf("%s/repos/%s/statuses/%s", baseURL, project, build.Commit.Hash)
+		body = map[string]string{
+			"state":       githubState(build.Status),
+			"target_url":  targetURL,
+			"description": description,
+			"context":     statusContext,
+		}
+	case domain.GitLab:
+		endpoint = fmt.Sprintf("%s/projects/%s/statuses/%s", baseURL, neturl.PathEscape(project), build.Commit.Hash)
+		body = map[string]string{
+			"state":       gitlabState(build.Status),
+			"target_url":  targetURL,
+			"description": description,
+			"name":        statusContext,
+		}
+	default:
+		return nil, ErrUnknownStatusProvider
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	switch repo.StatusProvider {
+	case domain.GitHub:
+		req.Header.Set("Authorization", "Bearer "+repo.StatusToken)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	case domain.Gitea:
+		req.Header.Set("Authorization", "token "+repo.StatusToken)
+	case domain.GitLab:
+		req.Header.Set("PRIVATE-TOKEN", repo.StatusToken)
+	}
+
+	return req, nil
+}
+
+func githubState(status domain.Status) string {
+	switch status {
+	case domain.InProgress:
+		return "pending"
+	case domain.Success:
+		return "success"
+	case domain.Failure:
+		return "failure"
+	default:
+		return "error"
+	}
+}
+
+func gitlabState(status domain.Status) string {
+	switch status {
+	case domain.InProgress:
+		return "running"
+	case domain.Success:
+		return "success"
+	case domain.Failure:
+		return "failed"
+	default:
+		return "canceled"
+	}
+}
+
+// projectPath returns the owner/name path of a repository from its clone URL,
+// e.g. https://github.com/owner/name.git or git@github.com:owner/name.git.
+func projectPath(rawURL string) (string, error) {
+	var path string
+
+	if strings.Contains(rawURL, "://") {
+		u, err := neturl.Parse(rawURL)
+		if err != nil {
+			return "", err
+		}
+		path = u.Path
+	} else if i := strings.Index(rawURL, ":"); i >= 0 {
+		path = rawURL[i+1:]
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if !strings.Contains(path, "/") {
+		return "", fmt.Errorf("failed to get project path from %q", rawURL)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusReporter_Report(t *testing.T) {
+	var build = domain.Build{Id: "1", Commit: domain.Commit{Hash: "abc"}, Status: domain.Failure}
+
+	tests := map[string]struct {
+		provider       domain.StatusProvider
+		expectedPath   string
+		expectedHeader http.Header
+		expectedBody   map[string]string
+	}{
+		"github": {
+			provider:       domain.GitHub,
+			expectedPath:   "/repos/owner/name/statuses/abc",
+			expectedHeader: http.Header{"Authorization": {"Bearer token"}},
+			expectedBody: map[string]string{
+				"state":       "failure",
+				"target_url":  "http://ci/api/v1/repositories/0/builds/1",
+				"description": "Build failure",
+				"context":     "ci",
+			},
+		},
+		"gitea": {
+			provider:       domain.Gitea,
+			expectedPath:   "/repos/owner/name/statuses/abc",
+			expectedHeader: http.Header{"Authorization": {"token token"}},
+			expectedBody: map[string]string{
+				"state":       "failure",
+				"target_url":  "http://ci/api/v1/repositories/0/builds/1",
+				"description": "Build failure",
+				"context":     "ci",
+			},
+		},
+		"gitlab": {
+			provider:       domain.GitLab,
+			expectedPath:   "/projects/owner%2Fname/statuses/abc",
+			expectedHeader: http.Header{"Private-Token": {"token"}},
+			expectedBody: map[string]string{
+				"state":       "failed",
+				"target_url":  "http://ci/api/v1/repositories/0/builds/1",
+				"description": "Build failure",
+				"name":        "ci",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests int
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+
+				assert.Equal(t, tc.expectedPath, r.URL.EscapedPath())
+				for key := range tc.expectedHeader {
+					assert.Equal(t, tc.expectedHeader.Get(key), r.Header.Get(key))
+				}
+
+				var body map[string]string
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				assert.Equal(t, tc.expectedBody, body)
+
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+
+			var (
+				reporter = NewStatusReporter(server.Client(), "http://ci/", mock.Logger{})
+				repo     = domain.Repository{
+					Id:             "0",
+					URL:            "https://example.com/owner/name.git",
+					StatusProvider: tc.provider,
+					StatusURL:      server.URL,
+					StatusToken:    "token",
+				}
+			)
+			reporter.backoff = 0
+
+			err := reporter.Report(context.Background(), repo, build)
+			require.NoError(t, err)
+			assert.Equal(t, 2, requests)
+		})
+	}
+}
+
+func TestStatusReporter_Report_Errors(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/repos/owner/name/statuses/unauthorized" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var (
+		reporter = NewStatusReporter(server.Client(), "http://ci", mock.Logger{})
+		repo     = domain.Repository{URL: "git@example.com:owner/name.git", StatusProvider: domain.GitHub,
+			StatusURL: server.URL}
+	)
+	reporter.backoff = 0
+
+	err := reporter.Report(context.Background(), repo, domain.Build{Commit: domain.Commit{Hash: "unauthorized"}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+
+	err = reporter.Report(context.Background(), repo, domain.Build{Commit: domain.Commit{Hash: "abc"}})
+	assert.Error(t, err)
+	assert.Equal(t, 1+reporter.attempts, requests)
+
+	err = reporter.Report(context.Background(), domain.Repository{}, domain.Build{})
+	assert.NoError(t, err)
+}
+
+func TestStatusReporter_HandleEvent(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		states []string
+		posted = make(chan struct{}, 2)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		// The pending status is slow to post, but is still reported first.
+		if body["state"] == "pending" {
+			time.Sleep(time.Millisecond * 100)
+		}
+
+		mu.Lock()
+		states = append(states, body["state"])
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		posted <- struct{}{}
+	}))
+	defer server.Close()
+
+	var (
+		reporter = NewStatusReporter(server.Client(), "http://ci", mock.Logger{})
+		repo     = domain.Repository{Id: "0", URL: "https://example.com/owner/name.git",
+			StatusProvider: domain.GitHub, StatusURL: server.URL}
+		build = domain.Build{Id: "1", Commit: domain.Commit{Hash: "abc"}, Status: domain.InProgress}
+	)
+
+	var start = time.Now()
+
+	require.NoError(t, reporter.HandleEvent(context.Background(), domain.Event{Kind: domain.EventBuildStarted,
+		Repository: repo, Build: &build}))
+
+	build.Status = domain.Success
+	require.NoError(t, reporter.HandleEvent(context.Background(), domain.Event{Kind: domain.EventBuildFinished,
+		Repository: repo, Build: &build}))
+
+	assert.Less(t, time.Since(start), time.Millisecond*100, "the statuses are posted in the background")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-posted:
+		case <-time.After(time.Second):
+			t.Fatal("status was not posted")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"pending", "success"}, states)
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCacheMiss is returned if nothing is saved under the cache keys.
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrCacheEntryTooLarge is returned if a saved archive exceeds the entry size limit.
+	ErrCacheEntryTooLarge = errors.New("cache entry is too large")
+	// ErrCacheReadOnly is returned if a cache is saved in a read-only scope or in a scope without refs.
+	ErrCacheReadOnly = errors.New("cache scope is read-only")
+)
+
+const (
+	// maxCacheKeyLength keeps the entry file names within the file system limits.
+	maxCacheKeyLength = 128
+	cacheEntryExt     = ".tar"
+)
+
+// hashFilesExpr matches ${hashFiles("pattern", ...)} in a cache key.
+var hashFilesExpr = regexp.MustCompile(`\$\{\s*hashFiles\(([^)]*)\)\s*}`)
+
+// StepCache used to keep the step caches as tar archives in a directory.
+// The archives are saved and restored per repository and ref, so a build never restores the caches
+// of another repository. Once the archives exceed the size limit, the least recently used ones are evicted.
+type StepCache struct {
+	dir          string
+	maxSize      int64
+	maxEntrySize int64
+	mu           sync.Mutex
+}
+
+// cacheEntry is an archive saved under a key in the namespace of a repository and ref.
+type cacheEntry struct {
+	namespace string
+	key       string
+	path      string
+	size      int64
+	usedAt    time.Time
+}
+
+func NewStepCache(dir string, maxSize, maxEntrySize int64) *StepCache {
+	return &StepCache{
+		dir:          dir,
+		maxSize:      maxSize,
+		maxEntrySize: maxEntrySize,
+	}
+}
+
+// Key evaluates the key template against the source code. ${hashFiles("pattern", ...)} is replaced with the
+// SHA-256 of the source code files whose paths match any of the patterns, or with an empty string if none do.
+func (*StepCache) Key(template, srcCodePath string) (string, error) {
+	var evalErr error
+
+	key := hashFilesExpr.ReplaceAllStringFunc(template, func(expr string) string {
+		var patterns pattern.List
+
+		for _, arg := range strings.Split(hashFilesExpr.FindStringSubmatch(expr)[1], ",") {
+			p, err := strconv.Unquote(strings.TrimSpace(arg))
+			if err != nil {
+				evalErr = fmt.Errorf("invalid hashFiles argument %s", strings.TrimSpace(arg))
+				return ""
+			}
+			patterns = append(patterns, p)
+		}
+
+		hash, err := hashFiles(srcCodePath, patterns)
+		if err != nil {
+			evalErr = err
+		}
+		return hash
+	})
+	if evalErr != nil {
+		return "", evalErr
+	}
+
+	if strings.Contains(key, "${") {
+		return "", fmt.Errorf("unknown expression in cache key %q", template)
+	}
+	if key == "" || len(key) > maxCacheKeyLength {
+		return "", fmt.Errorf("cache key must be from 1 to %d characters long", maxCacheKeyLength)
+	}
+
+	return key, nil
+}
+
+// hashFiles returns the SHA-256 of the paths and the content of the files matching the patterns.
+func hashFiles(root string, patterns pattern.List) (string, error) {
+	var (
+		hash    = sha256.New()
+		matched bool
+	)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if !patterns.Match(name) {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		hash.Write([]byte(name + "\x00"))
+		_, err = io.Copy(hash, file)
+		matched = true
+		return err
+	})
+	if err != nil || !matched {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Restore opens the archive saved under the key or, failing that, the most recently used archive whose key
+// starts with one of the restore keys, tried in order. The refs of the scope are searched in order.
+// It returns the key the opened archive is saved under.
+func (c *StepCache) Restore(scope domain.CacheScope, key string, restoreKeys []string) (archive io.ReadCloser,
+	restoredKey string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.entries()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var found *cacheEntry
+
+	for _, ref := range scope.Refs {
+		found = findEntry(entries, cacheNamespace(scope.RepoId, ref), key, restoreKeys)
+		if found != nil {
+			break
+		}
+	}
+
+	if found == nil {
+		return nil, "", ErrCacheMiss
+	}
+
+	file, err := os.Open(found.path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var now = time.Now()
+	_ = os.Chtimes(found.path, now, now)
+
+	return file, found.key, nil
+}
+
+// findEntry returns the entry of the namespace saved under the key or, failing that, the most recently used one
+// whose key starts with one of the restore keys, tried in order. The entries are sorted from the most recently used
+// one.
+func findEntry(entries []cacheEntry, namespace, key string, restoreKeys []string) *cacheEntry {
+	for i := range entries {
+		if entries[i].namespace == namespace && entries[i].key == key {
+			return &entries[i]
+		}
+	}
+
+	for _, prefix := range restoreKeys {
+		for i := range entries {
+			if entries[i].namespace == namespace && strings.HasPrefix(entries[i].key, prefix) {
+				return &entries[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// Save stores the archive written by write under the key and the first ref of the scope, then evicts the least
+// recently used archives until the rest fit in the size limit. It fails with ErrCacheEntryTooLarge if the archive
+// exceeds the entry size limit and with ErrCacheReadOnly if the scope is read-only.
+func (c *StepCache) Save(scope domain.CacheScope, key string, write func(io.Writer) error) error {
+	if scope.ReadOnly || len(scope.Refs) == 0 {
+		return ErrCacheReadOnly
+	}
+
+	err := os.MkdirAll(c.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// The archive is written outside the lock, so the running steps are not blocked by a slow copy.
+	tmp, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = write(&limitedWriter{w: tmp, n: c.maxEntrySize})
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var path = c.path(cacheNamespace(scope.RepoId, scope.Refs[0]), key)
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	return c.evict(path)
+}
+
+// evict removes the least recently used archives, except for the kept one, until the rest fit in the size limit.
+func (c *StepCache) evict(keep string) error {
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		size += entry.size
+	}
+
+	for i := len(entries) - 1; i >= 0 && size > c.maxSize; i-- {
+		if entries[i].path == keep {
+			continue
+		}
+
+		err = os.Remove(entries[i].path)
+		if err != nil {
+			return err
+		}
+		size -= entries[i].size
+	}
+
+	return nil
+}
+
+// entries returns the saved archives sorted from the most recently used one.
+func (c *StepCache) entries() ([]cacheEntry, error) {
+	files, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []cacheEntry
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, cacheEntryExt) {
+			continue
+		}
+
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(name, cacheEntryExt))
+		if err != nil {
+			continue
+		}
+
+		// The archives saved without a namespace are never restored, only evicted.
+		var namespace, key = "", string(decoded)
+		if parts := strings.SplitN(key, "\x00", 3); len(parts) == 3 {
+			namespace, key = parts[0]+"\x00"+parts[1], parts[2]
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, cacheEntry{
+			namespace: namespace,
+			key:       key,
+			path:      filepath.Join(c.dir, name),
+			size:      info.Size(),
+			usedAt:    info.ModTime(),
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].usedAt.After(entries[j].usedAt)
+	})
+
+	return entries, nil
+}
+
+func (c *StepCache) path(namespace, key string) string {
+	var name = namespace + "\x00" + key
+	return filepath.Join(c.dir, base64.RawURLEncoding.EncodeToString([]byte(name))+cacheEntryExt)
+}
+
+// cacheNamespace returns the namespace of the caches of the repository ref. The ref is hashed to keep the entry
+// file names within the file system limits.
+func cacheNamespace(repoId, ref string) string {
+	var sum = sha256.Sum256([]byte(ref))
+	return repoId + "\x00" + hex.EncodeToString(sum[:8])
+}
+
+// limitedWriter fails with ErrCacheEntryTooLarge once more than n bytes are written.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > lw.n {
+		return 0, ErrCacheEntryTooLarge
+	}
+	lw.n -= int64(len(p))
+	return lw.w.Write(p)
+}
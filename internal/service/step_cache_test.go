@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStepCache_Key(t *testing.T) {
+	var (
+		cache = NewStepCache(t.TempDir(), 0, 0)
+		src   = t.TempDir()
+	)
+
+	require.NoError(t, os.WriteFile(filepath.Join(src, "go.sum"), []byte("v1"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "web"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "web", "package-lock.json"), []byte("{}"), 0o644))
+
+	goKey, err := cache.Key(`go-${hashFiles("go.sum")}`, src)
+	require.NoError(t, err)
+	assert.Regexp(t, "^go-[0-9a-f]{64}$", goKey)
+
+	tests := map[string]struct {
+		template    string
+		expectedKey string
+		expectError bool
+	}{
+		"static":            {template: "deps", expectedKey: "^deps$"},
+		"same files":        {template: `go-${ hashFiles( "go.sum" ) }`, expectedKey: "^" + goKey + "$"},
+		"nested file":       {template: `npm-${hashFiles("web/*.json")}`, expectedKey: "^npm-[0-9a-f]{64}$"},
+		"no matching files": {template: `go-${hashFiles("*.lock")}`, expectedKey: "^go-$"},
+		"unquoted argument": {template: `go-${hashFiles(go.sum)}`, expectError: true},
+		"unknown function":  {template: `go-${env("HOME")}`, expectError: true},
+		"empty":             {template: "", expectError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := cache.Key(tc.template, src)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Regexp(t, tc.expectedKey, key)
+		})
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(src, "go.sum"), []byte("v2"), 0o644))
+
+	key, err := cache.Key(`go-${hashFiles("go.sum")}`, src)
+	require.NoError(t, err)
+	assert.NotEqual(t, goKey, key, "the key changes along with the file")
+}
+
+func TestStepCache(t *testing.T) {
+	var (
+		cache = NewStepCache(t.TempDir(), 8, 4)
+		scope = domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/main"}}
+	)
+
+	var save = func(key, data string) error {
+		return saveCache(cache, scope, key, data)
+	}
+
+	var restore = func(key string, restoreKeys ...string) (data, restoredKey string, err error) {
+		return restoreCache(cache, scope, key, restoreKeys...)
+	}
+
+	_, _, err := restore("go-1")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	require.NoError(t, save("go-1", "aaa"))
+	assert.ErrorIs(t, save("go-2", "aaaaa"), ErrCacheEntryTooLarge)
+
+	data, key, err := restore("go-1")
+	require.NoError(t, err)
+	assert.Equal(t, "aaa", data)
+	assert.Equal(t, "go-1", key)
+
+	_, _, err = restore("go-2")
+	assert.ErrorIs(t, err, ErrCacheMiss, "too large entries are not saved")
+
+	// Different modification times keep the order of the entries deterministic.
+	time.Sleep(time.Millisecond * 10)
+	require.NoError(t, save("npm-1", "bbb"))
+
+	data, key, err = restore("go-2", "npm-", "go-")
+	require.NoError(t, err)
+	assert.Equal(t, "bbb", data, "the restore keys are tried in order")
+	assert.Equal(t, "npm-1", key)
+
+	// Restoring marks go-1 as the most recently used entry, so npm-1 is evicted.
+	time.Sleep(time.Millisecond * 10)
+	_, _, err = restore("go-1")
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 10)
+	require.NoError(t, save("go-3", "ccc"))
+
+	_, _, err = restore("npm-1")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	data, key, err = restore("go-4", "go-")
+	require.NoError(t, err)
+	assert.Equal(t, "ccc", data, "the most recently used entry is restored")
+	assert.Equal(t, "go-3", key)
+}
+
+func TestStepCache_Scope(t *testing.T) {
+	var (
+		cache   = NewStepCache(t.TempDir(), 1<<20, 1<<20)
+		main    = domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/main"}}
+		feature = domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/feature", "refs/heads/main"}}
+		other   = domain.CacheScope{RepoId: "other", Refs: []string{"refs/heads/main"}}
+		pr      = domain.CacheScope{RepoId: "repo", Refs: []string{"refs/heads/main"}, ReadOnly: true}
+	)
+
+	require.NoError(t, saveCache(cache, main, "go-1", "main"))
+
+	_, _, err := restoreCache(cache, other, "go-1", "go-")
+	assert.ErrorIs(t, err, ErrCacheMiss, "the caches of other repositories are not restored")
+
+	data, _, err := restoreCache(cache, feature, "go-2", "go-")
+	require.NoError(t, err)
+	assert.Equal(t, "main", data, "the caches of the following refs are restored")
+
+	require.NoError(t, saveCache(cache, feature, "go-2", "feature"))
+
+	data, _, err = restoreCache(cache, feature, "go-1", "go-")
+	require.NoError(t, err)
+	assert.Equal(t, "feature", data, "the caches of the first ref are preferred")
+
+	_, _, err = restoreCache(cache, main, "go-2")
+	assert.ErrorIs(t, err, ErrCacheMiss, "the caches are saved under the first ref")
+
+	assert.ErrorIs(t, saveCache(cache, pr, "go-3", "pr"), ErrCacheReadOnly)
+
+	data, _, err = restoreCache(cache, pr, "go-3", "go-")
+	require.NoError(t, err)
+	assert.Equal(t, "main", data)
+}
+
+func saveCache(cache *StepCache, scope domain.CacheScope, key, data string) error {
+	return cache.Save(scope, key, func(w io.Writer) error {
+		_, err := io.WriteString(w, data)
+		return err
+	})
+}
+
+func restoreCache(cache *StepCache, scope domain.CacheScope, key string, restoreKeys ...string) (data,
+	restoredKey string, err error) {
+	archive, restoredKey, err := cache.Restore(scope, key, restoreKeys)
+	if err != nil {
+		return "", "", err
+	}
+	defer archive.Close()
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, archive)
+	return buf.String(), restoredKey, err
+}
@@ -2,8 +2,10 @@ package service
 
 import (
 	"archive/tar"
+	"errors"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -57,3 +59,36 @@ func (TarArchiver) Compress(dir string) (archivePath string, removeArchive func(
 
 	return archive.Name(), func() { os.Remove(archive.Name()) }, tw.Close()
 }
+
+// Append writes the entries of the archive to tw, joining their names with dir.
+func (TarArchiver) Append(tw *tar.Writer, dir string, archive io.Reader) error {
+	var reader = tar.NewReader(archive)
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		header.Name = path.Join(dir, header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			header.Name += "/"
+		case tar.TypeLink:
+			header.Linkname = path.Join(dir, header.Linkname)
+		}
+
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, reader)
+		if err != nil {
+			return err
+		}
+	}
+}
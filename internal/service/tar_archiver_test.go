@@ -1,7 +1,10 @@
 package service
 
 import (
+	"archive/tar"
+	"bytes"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -15,3 +18,30 @@ func TestTarArchiver(t *testing.T) {
 	removeArchive()
 	assert.NoFileExists(t, archivePath)
 }
+
+func TestTarArchiver_Append(t *testing.T) {
+	var (
+		archiver TarArchiver
+		src, dst bytes.Buffer
+		tw       = tar.NewWriter(&src)
+	)
+
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "mod/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "mod/go.mod", Typeflag: tar.TypeReg, Mode: 0o644, Size: 2}))
+	_, err := tw.Write([]byte("v1"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	tw = tar.NewWriter(&dst)
+	require.NoError(t, archiver.Append(tw, "go/pkg", &src))
+	require.NoError(t, tw.Close())
+
+	var (
+		reader = tar.NewReader(&dst)
+		names  []string
+	)
+	for header, err := reader.Next(); err == nil; header, err = reader.Next() {
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{"go/pkg/mod/", "go/pkg/mod/go.mod"}, names)
+}
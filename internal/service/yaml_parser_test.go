@@ -2,12 +2,18 @@ package service
 
 import (
 	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/duration"
+	"github.com/KirillMironov/ci/pkg/pattern"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestYAMLParser_ParsePipeline(t *testing.T) {
-	var parser YAMLParser
+	var (
+		parser          YAMLParser
+		maxCoverageDrop = 0.5
+	)
 	var yaml = `
 name: example
 
@@ -17,6 +23,17 @@ steps:
     command: ["/bin/sh", "-c"]
     args:
       - go version
+    artifacts:
+      - bin
+      - "*.out"
+    cache:
+      key: go-${hashFiles("go.sum")}
+      restore_keys: [go-]
+      paths: [/go/pkg/mod]
+    reports:
+      junit: reports/*.xml
+      coverage: coverage.out
+      max_coverage_drop: 0.5
 
   - name: env
     image: busybox:1.35
@@ -26,6 +43,19 @@ steps:
     args:
       - echo $TEST
       - printenv
+    retry:
+      attempts: 3
+      backoff: 5s
+      on_exit_error: true
+
+  - name: release
+    image: busybox:1.35
+    command: ["/bin/sh", "-c"]
+    args:
+      - echo $CI_TAG
+    when:
+      trigger: [tag]
+      tag: v*
 `
 
 	pipeline, err := parser.ParsePipeline([]byte(yaml))
@@ -34,10 +64,21 @@ steps:
 		Name: "example",
 		Steps: []domain.Step{
 			{
-				Name:    "version",
-				Image:   "golang:1.18.3-alpine3.15",
-				Command: []string{"/bin/sh", "-c"},
-				Args:    []string{"go version"},
+				Name:      "version",
+				Image:     "golang:1.18.3-alpine3.15",
+				Command:   []string{"/bin/sh", "-c"},
+				Args:      []string{"go version"},
+				Artifacts: pattern.List{"bin", "*.out"},
+				Cache: domain.Cache{
+					Key:         `go-${hashFiles("go.sum")}`,
+					RestoreKeys: []string{"go-"},
+					Paths:       []string{"/go/pkg/mod"},
+				},
+				Reports: domain.Reports{
+					JUnit:           pattern.List{"reports/*.xml"},
+					Coverage:        pattern.List{"coverage.out"},
+					MaxCoverageDrop: &maxCoverageDrop,
+				},
 			},
 			{
 				Name:        "env",
@@ -45,6 +86,21 @@ steps:
 				Environment: []string{"TEST=true"},
 				Command:     []string{"/bin/sh", "-c"},
 				Args:        []string{"echo $TEST", "printenv"},
+				Retry: domain.Retry{
+					Attempts:    3,
+					Backoff:     duration.Duration(time.Second * 5),
+					OnExitError: true,
+				},
+			},
+			{
+				Name:    "release",
+				Image:   "busybox:1.35",
+				Command: []string{"/bin/sh", "-c"},
+				Args:    []string{"echo $CI_TAG"},
+				When: domain.When{
+					Trigger: []domain.Trigger{domain.TriggerTag},
+					Tag:     pattern.List{"v*"},
+				},
 			},
 		},
 	}, pipeline)
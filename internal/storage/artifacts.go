@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type Artifacts struct {
+	db *sqlx.DB
+}
+
+func NewArtifacts(db *sqlx.DB) *Artifacts {
+	return &Artifacts{db: db}
+}
+
+func (a Artifacts) Save(artifact domain.Artifact) error {
+	var query = `INSERT INTO artifacts (build_id, step, path, size, checksum, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (build_id, path)
+		DO UPDATE SET step = $2, size = $4, checksum = $5, created_at = $6`
+
+	_, err := a.db.Exec(query, artifact.BuildId, artifact.Step, artifact.Path, artifact.Size, artifact.Checksum,
+		artifact.CreatedAt)
+	return err
+}
+
+func (a Artifacts) GetAllByBuildId(buildId string) (artifacts []domain.Artifact, err error) {
+	var query = `SELECT build_id, step, path, size, checksum, created_at FROM artifacts WHERE build_id = $1
+		ORDER BY path`
+
+	rows, err := a.db.Queryx(query, buildId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var artifact domain.Artifact
+		err = rows.Scan(&artifact.BuildId, &artifact.Step, &artifact.Path, &artifact.Size, &artifact.Checksum,
+			&artifact.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts, rows.Err()
+}
+
+func (a Artifacts) GetByPath(buildId, path string) (artifact domain.Artifact, err error) {
+	var query = `SELECT build_id, step, path, size, checksum, created_at FROM artifacts
+		WHERE build_id = $1 AND path = $2`
+
+	err = a.db.QueryRowx(query, buildId, path).Scan(&artifact.BuildId, &artifact.Step, &artifact.Path,
+		&artifact.Size, &artifact.Checksum, &artifact.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Artifact{}, domain.ErrNotFound
+		}
+		return domain.Artifact{}, err
+	}
+
+	return artifact, nil
+}
+
+func (a Artifacts) Referenced(checksum string) (referenced bool, err error) {
+	var query = "SELECT EXISTS (SELECT 1 FROM artifacts WHERE checksum = $1)"
+
+	err = a.db.QueryRowx(query, checksum).Scan(&referenced)
+	return referenced, err
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestArtifacts(t *testing.T) {
+	forEachBackend(t, testArtifacts)
+}
+
+func testArtifacts(t *testing.T, db *sqlx.DB) {
+	var (
+		artifacts = NewArtifacts(db)
+		now       = time.Now().Truncate(time.Microsecond)
+	)
+
+	require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: "repo", URL: "example.com"}))
+
+	_, err := NewBuilds(db).Create(domain.Build{Id: "build", RepoId: "repo"})
+	require.NoError(t, err)
+
+	for _, artifact := range []domain.Artifact{
+		{BuildId: "build", Step: "build", Path: "bin/app", Size: 1, Checksum: "a", CreatedAt: now},
+		{BuildId: "build", Step: "test", Path: "coverage.out", Size: 2, Checksum: "b", CreatedAt: now},
+		{BuildId: "build", Step: "build", Path: "bin/app", Size: 3, Checksum: "c", CreatedAt: now},
+	} {
+		require.NoError(t, artifacts.Save(artifact))
+	}
+
+	all, err := artifacts.GetAllByBuildId("build")
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "bin/app", all[0].Path)
+	assert.Equal(t, int64(3), all[0].Size, "the artifact with the same path is replaced")
+	assert.True(t, now.Equal(all[0].CreatedAt))
+
+	artifact, err := artifacts.GetByPath("build", "coverage.out")
+	require.NoError(t, err)
+	assert.Equal(t, "test", artifact.Step)
+
+	_, err = artifacts.GetByPath("build", "missing")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	for checksum, expected := range map[string]bool{"a": false, "b": true, "c": true} {
+		referenced, err := artifacts.Referenced(checksum)
+		require.NoError(t, err)
+		assert.Equal(t, expected, referenced, checksum)
+	}
+
+	require.NoError(t, NewBuilds(db).Delete("build"))
+
+	referenced, err := artifacts.Referenced("b")
+	require.NoError(t, err)
+	assert.False(t, referenced, "artifacts are deleted along with the build")
+}
@@ -1,13 +1,21 @@
+// Package storage implements the domain storages with SQL queries portable between the sqlite3 and postgres drivers.
 package storage
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/KirillMironov/ci/internal/domain"
 	"github.com/jmoiron/sqlx"
+	"strings"
 	"time"
 )
 
+// buildColumns are the columns scanned by scanBuild.
+const buildColumns = `b.id, b.repo_id, b.number, b.status, b.trigger, b.created_at, b.finished_at, c.hash, c.branch,
+	c.tag, c.pull_request, c.pull_request_ref, c.source_branch, c.target_branch, c.author_name, c.author_email`
+
 type Builds struct {
 	db *sqlx.DB
 }
@@ -16,35 +24,58 @@ func NewBuilds(db *sqlx.DB) *Builds {
 	return &Builds{db: db}
 }
 
-func (b Builds) Create(build domain.Build) error {
+func (b Builds) Create(build domain.Build) (number int, err error) {
 	var (
-		buildQuery  = "INSERT INTO builds (id, repo_id, status, created_at) VALUES ($1, $2, $3, $4)"
-		commitQuery = "INSERT INTO commits (build_id, hash) VALUES ($1, $2)"
+		numberQuery = `UPDATE repositories SET last_build_number = last_build_number + 1 WHERE id = $1
+			RETURNING last_build_number`
+		buildQuery = `INSERT INTO builds (id, repo_id, number, status, trigger, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`
+		commitQuery = `INSERT INTO commits (build_id, hash, branch, tag, pull_request, pull_request_ref, source_branch,
+			target_branch, author_name, author_email) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 	)
 
 	tx, err := b.db.Beginx()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(buildQuery, build.Id, build.RepoId, build.Status, time.Now())
+	err = tx.QueryRowx(numberQuery, build.RepoId).Scan(&number)
 	if err != nil {
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domain.ErrNotFound
+		}
+		return 0, err
 	}
 
-	_, err = tx.Exec(commitQuery, build.Id, build.Commit.Hash)
+	_, err = tx.Exec(buildQuery, build.Id, build.RepoId, number, build.Status, build.Trigger, build.CreatedAt)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return tx.Commit()
+	var (
+		pr     = newNullPullRequest(build.Commit.PullRequest)
+		author domain.Author
+	)
+	if build.Commit.Author != nil {
+		author = *build.Commit.Author
+	}
+
+	_, err = tx.Exec(commitQuery, build.Id, build.Commit.Hash, build.Commit.Branch, build.Commit.Tag, pr.number,
+		pr.ref, pr.sourceBranch, pr.targetBranch, author.Name, author.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	return number, tx.Commit()
 }
 
 func (b Builds) Update(build domain.Build) error {
 	var (
-		buildQuery = "UPDATE builds SET status = $1 WHERE id = $2"
+		buildQuery = "UPDATE builds SET status = $1, finished_at = $2 WHERE id = $3"
 		logQuery   = "INSERT INTO logs (build_id, data) VALUES ($1, $2)"
+		stepQuery  = `INSERT INTO steps (build_id, position, name, attempt, status, error, log)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 	)
 
 	tx, err := b.db.Beginx()
@@ -53,7 +84,9 @@ func (b Builds) Update(build domain.Build) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(buildQuery, build.Status, build.Id)
+	var finishedAt = sql.NullTime{Time: build.FinishedAt, Valid: !build.FinishedAt.IsZero()}
+
+	_, err = tx.Exec(buildQuery, build.Status, finishedAt, build.Id)
 	if err != nil {
 		return err
 	}
@@ -63,6 +96,13 @@ func (b Builds) Update(build domain.Build) error {
 		return err
 	}
 
+	for i, step := range build.Steps {
+		_, err = tx.Exec(stepQuery, build.Id, i, step.Step, step.Attempt, step.Status, step.Error, step.Log.Data)
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -73,9 +113,24 @@ func (b Builds) Delete(id string) error {
 	return err
 }
 
+func (b Builds) DeleteExpired(repoId string, keepLast int, before time.Time) (deleted int, err error) {
+	var query = `DELETE FROM builds WHERE repo_id = $1 AND status != $2 AND created_at < $3
+		AND id NOT IN (SELECT id FROM builds WHERE repo_id = $1 ORDER BY created_at DESC, id DESC LIMIT $4)
+		AND id NOT IN (SELECT id FROM builds WHERE repo_id = $1 AND status = $5 ORDER BY created_at DESC, id DESC
+			LIMIT 1)`
+
+	result, err := b.db.Exec(query, repoId, domain.InProgress, before, keepLast, domain.Success)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
 func (b Builds) GetAllByRepoId(repoId string) (builds []domain.Build, err error) {
-	var query = `SELECT id, repo_id, status, created_at, c.hash FROM builds b 
-    	JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1`
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1 ORDER BY b.created_at, b.id`
 
 	rows, err := b.db.Queryx(query, repoId)
 	if err != nil {
@@ -87,8 +142,7 @@ func (b Builds) GetAllByRepoId(repoId string) (builds []domain.Build, err error)
 	defer rows.Close()
 
 	for rows.Next() {
-		var build domain.Build
-		err = rows.Scan(&build.Id, &build.RepoId, &build.Status, &build.CreatedAt, &build.Commit.Hash)
+		build, err := scanBuild(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -98,13 +152,177 @@ func (b Builds) GetAllByRepoId(repoId string) (builds []domain.Build, err error)
 	return builds, rows.Err()
 }
 
-func (b Builds) GetById(id string) (build domain.Build, err error) {
-	var query = `SELECT id, repo_id, status, created_at, c.hash FROM builds b 
-    	JOIN commits c ON b.id = c.build_id WHERE b.id = $1`
+// GetPage returns the builds matching the filter ordered by creation time, using the creation time and id
+// of the last build of the previous page as a cursor.
+func (b Builds) GetPage(filter domain.BuildsFilter) (page domain.BuildsPage, err error) {
+	var where whereClause
+
+	where.add("b.repo_id = $%d", filter.RepoId)
+	if filter.Status != nil {
+		where.add("b.status = $%d", *filter.Status)
+	}
+	if filter.Branch != "" {
+		where.add("c.branch = $%d", filter.Branch)
+	}
+	if filter.Commit != "" {
+		where.add("c.hash LIKE $%d", filter.Commit+"%")
+	}
+	if filter.Author != "" {
+		where.add("(c.author_name = $%[1]d OR c.author_email = $%[1]d)", filter.Author)
+	}
+	if !filter.Since.IsZero() {
+		where.add("b.created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where.add("b.created_at < $%d", filter.Until)
+	}
+
+	var countQuery = `SELECT COUNT(*) FROM builds b JOIN commits c ON b.id = c.build_id WHERE ` + where.String()
+
+	err = b.db.QueryRowx(countQuery, where.args...).Scan(&page.Total)
+	if err != nil {
+		return domain.BuildsPage{}, err
+	}
+
+	var order, compare = "DESC", "<"
+	if filter.Ascending {
+		order, compare = "ASC", ">"
+	}
+
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return domain.BuildsPage{}, err
+		}
+		where.add("(b.created_at "+compare+" $%[1]d OR (b.created_at = $%[1]d AND b.id "+compare+" $%[2]d))",
+			createdAt, id)
+	}
+
+	var query = `SELECT ` + buildColumns + ` FROM builds b JOIN commits c ON b.id = c.build_id
+		WHERE ` + where.String() + ` ORDER BY b.created_at ` + order + `, b.id ` + order +
+		fmt.Sprintf(" LIMIT %d", filter.Limit+1)
+
+	rows, err := b.db.Queryx(query, where.args...)
+	if err != nil {
+		return domain.BuildsPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		build, err := scanBuild(rows)
+		if err != nil {
+			return domain.BuildsPage{}, err
+		}
+		page.Builds = append(page.Builds, build)
+	}
+	if err = rows.Err(); err != nil {
+		return domain.BuildsPage{}, err
+	}
+
+	if len(page.Builds) > filter.Limit {
+		page.Builds = page.Builds[:filter.Limit]
+		var last = page.Builds[len(page.Builds)-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+	}
+
+	return page, nil
+}
+
+func (b Builds) GetById(id string) (domain.Build, error) {
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.id = $1`
+
+	build, err := scanBuild(b.db.QueryRowx(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Build{}, domain.ErrNotFound
+		}
+		return domain.Build{}, err
+	}
+
+	build.Steps, err = b.getSteps(build.Id)
+	if err != nil {
+		return domain.Build{}, err
+	}
+
+	return build, nil
+}
+
+func (b Builds) GetByNumber(repoId string, number int) (domain.Build, error) {
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1 AND b.number = $2`
+
+	build, err := scanBuild(b.db.QueryRowx(query, repoId, number))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Build{}, domain.ErrNotFound
+		}
+		return domain.Build{}, err
+	}
+
+	build.Steps, err = b.getSteps(build.Id)
+	if err != nil {
+		return domain.Build{}, err
+	}
+
+	return build, nil
+}
+
+func (b Builds) GetLatestByBranch(repoId, branch string) (domain.Build, error) {
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1 AND c.branch = $2
+		ORDER BY b.created_at DESC LIMIT 1`
+
+	build, err := scanBuild(b.db.QueryRowx(query, repoId, branch))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Build{}, domain.ErrNotFound
+		}
+		return domain.Build{}, err
+	}
+
+	return build, nil
+}
+
+func (b Builds) GetLatestFinished(repoId, branch string) (domain.Build, error) {
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1 AND ($2 = '' OR c.branch = $2) AND b.status != $3
+			AND c.tag = '' AND c.pull_request IS NULL
+		ORDER BY b.created_at DESC LIMIT 1`
+
+	build, err := scanBuild(b.db.QueryRowx(query, repoId, branch, domain.InProgress))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Build{}, domain.ErrNotFound
+		}
+		return domain.Build{}, err
+	}
+
+	return build, nil
+}
+
+func (b Builds) GetLatestByTag(repoId, tag string) (domain.Build, error) {
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1 AND c.tag = $2
+		ORDER BY b.created_at DESC LIMIT 1`
+
+	build, err := scanBuild(b.db.QueryRowx(query, repoId, tag))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Build{}, domain.ErrNotFound
+		}
+		return domain.Build{}, err
+	}
+
+	return build, nil
+}
 
-	row := b.db.QueryRowx(query, id)
+func (b Builds) GetLatestByPullRequest(repoId string, number int) (domain.Build, error) {
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1 AND c.pull_request = $2
+		ORDER BY b.created_at DESC LIMIT 1`
 
-	err = row.Scan(&build.Id, &build.RepoId, &build.Status, &build.CreatedAt, &build.Commit.Hash)
+	build, err := scanBuild(b.db.QueryRowx(query, repoId, number))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return domain.Build{}, domain.ErrNotFound
@@ -114,3 +332,146 @@ func (b Builds) GetById(id string) (build domain.Build, err error) {
 
 	return build, nil
 }
+
+func (b Builds) GetAllByPullRequest(repoId string, number int) (builds []domain.Build, err error) {
+	var query = `SELECT ` + buildColumns + ` FROM builds b
+		JOIN commits c ON b.id = c.build_id WHERE b.repo_id = $1 AND c.pull_request = $2
+		ORDER BY b.created_at`
+
+	rows, err := b.db.Queryx(query, repoId, number)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		build, err := scanBuild(rows)
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, build)
+	}
+
+	return builds, rows.Err()
+}
+
+func (b Builds) getSteps(buildId string) (steps []domain.StepAttempt, err error) {
+	var query = "SELECT name, attempt, status, error, log FROM steps WHERE build_id = $1 ORDER BY position"
+
+	rows, err := b.db.Queryx(query, buildId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step domain.StepAttempt
+		err = rows.Scan(&step.Step, &step.Attempt, &step.Status, &step.Error, &step.Log.Data)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, rows.Err()
+}
+
+func scanBuild(row interface{ Scan(...any) error }) (build domain.Build, err error) {
+	var (
+		finishedAt sql.NullTime
+		pr         nullPullRequest
+		author     domain.Author
+	)
+
+	err = row.Scan(&build.Id, &build.RepoId, &build.Number, &build.Status, &build.Trigger, &build.CreatedAt, &finishedAt,
+		&build.Commit.Hash, &build.Commit.Branch, &build.Commit.Tag, &pr.number, &pr.ref, &pr.sourceBranch,
+		&pr.targetBranch, &author.Name, &author.Email)
+	if err != nil {
+		return domain.Build{}, err
+	}
+
+	build.FinishedAt = finishedAt.Time
+	if author != (domain.Author{}) {
+		build.Commit.Author = &author
+	}
+
+	build.Commit.PullRequest = pr.pullRequest()
+
+	return build, nil
+}
+
+// nullPullRequest is a pull request stored in the nullable columns of the commits table.
+type nullPullRequest struct {
+	number       sql.NullInt64
+	ref          sql.NullString
+	sourceBranch sql.NullString
+	targetBranch sql.NullString
+}
+
+func newNullPullRequest(pr *domain.PullRequest) nullPullRequest {
+	if pr == nil {
+		return nullPullRequest{}
+	}
+	return nullPullRequest{
+		number:       sql.NullInt64{Int64: int64(pr.Number), Valid: true},
+		ref:          sql.NullString{String: pr.Ref, Valid: true},
+		sourceBranch: sql.NullString{String: pr.SourceBranch, Valid: true},
+		targetBranch: sql.NullString{String: pr.TargetBranch, Valid: true},
+	}
+}
+
+func (n nullPullRequest) pullRequest() *domain.PullRequest {
+	if !n.number.Valid {
+		return nil
+	}
+	return &domain.PullRequest{
+		Number:       int(n.number.Int64),
+		Ref:          n.ref.String,
+		SourceBranch: n.sourceBranch.String,
+		TargetBranch: n.targetBranch.String,
+	}
+}
+
+// whereClause is a conjunction of conditions with numbered placeholders.
+type whereClause struct {
+	conditions []string
+	args       []any
+}
+
+// add appends a condition whose placeholders are formatted with the indexes of the given args.
+func (w *whereClause) add(condition string, args ...any) {
+	var indexes = make([]any, len(args))
+	for i := range args {
+		indexes[i] = len(w.args) + i + 1
+	}
+	w.conditions = append(w.conditions, fmt.Sprintf(condition, indexes...))
+	w.args = append(w.args, args...)
+}
+
+func (w whereClause) String() string {
+	return strings.Join(w.conditions, " AND ")
+}
+
+// encodeCursor returns an opaque cursor pointing at the build with the given creation time and id.
+func encodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.Format(time.RFC3339Nano) + " " + id))
+}
+
+func decodeCursor(cursor string) (createdAt time.Time, id string, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", domain.ErrInvalidCursor
+	}
+
+	createdAtStr, id, ok := strings.Cut(string(data), " ")
+	if !ok {
+		return time.Time{}, "", domain.ErrInvalidCursor
+	}
+
+	createdAt, err = time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return time.Time{}, "", domain.ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
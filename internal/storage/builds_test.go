@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBuilds_GetPage(t *testing.T) {
+	forEachBackend(t, testBuildsGetPage)
+}
+
+func testBuildsGetPage(t *testing.T, db *sqlx.DB) {
+	var (
+		builds   = NewBuilds(db)
+		start    = time.Now().Add(-time.Hour)
+		failure  = domain.Failure
+		expected []string
+	)
+
+	require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: "repo", URL: "example.com"}))
+
+	for i := 0; i < 5; i++ {
+		var build = domain.Build{
+			Id:     "build" + strconv.Itoa(i),
+			RepoId: "repo",
+			Commit: domain.Commit{
+				Hash:   "abc" + strconv.Itoa(i),
+				Branch: []string{"main", "feature"}[i%2],
+				Author: &domain.Author{Name: "ci", Email: "ci@example.com"},
+			},
+			Status:    []domain.Status{domain.Success, domain.Failure}[i%2],
+			CreatedAt: start.Add(time.Minute * time.Duration(i)),
+		}
+		_, err := builds.Create(build)
+		require.NoError(t, err)
+		expected = append([]string{build.Id}, expected...)
+	}
+
+	tests := map[string]struct {
+		filter   domain.BuildsFilter
+		expected []string
+	}{
+		"newest first": {
+			filter:   domain.BuildsFilter{},
+			expected: expected,
+		},
+		"oldest first": {
+			filter:   domain.BuildsFilter{Ascending: true},
+			expected: []string{"build0", "build1", "build2", "build3", "build4"},
+		},
+		"status": {
+			filter:   domain.BuildsFilter{Status: &failure},
+			expected: []string{"build3", "build1"},
+		},
+		"branch": {
+			filter:   domain.BuildsFilter{Branch: "main"},
+			expected: []string{"build4", "build2", "build0"},
+		},
+		"commit prefix": {
+			filter:   domain.BuildsFilter{Commit: "abc2"},
+			expected: []string{"build2"},
+		},
+		"author": {
+			filter:   domain.BuildsFilter{Author: "ci@example.com", Branch: "feature"},
+			expected: []string{"build3", "build1"},
+		},
+		"date range": {
+			filter:   domain.BuildsFilter{Since: start.Add(time.Minute), Until: start.Add(time.Minute * 3)},
+			expected: []string{"build2", "build1"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var ids []string
+
+			tc.filter.RepoId = "repo"
+			tc.filter.Limit = 2
+
+			for {
+				page, err := builds.GetPage(tc.filter)
+				require.NoError(t, err)
+				assert.Equal(t, len(tc.expected), page.Total)
+
+				for _, build := range page.Builds {
+					ids = append(ids, build.Id)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				tc.filter.Cursor = page.NextCursor
+			}
+
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+
+	_, err := builds.GetPage(domain.BuildsFilter{RepoId: "repo", Limit: 1, Cursor: "-"})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+}
+
+func TestBuilds_Create_Number(t *testing.T) {
+	forEachBackend(t, testBuildsCreateNumber)
+}
+
+func testBuildsCreateNumber(t *testing.T, db *sqlx.DB) {
+	var (
+		builds       = NewBuilds(db)
+		repositories = NewRepositories(db)
+	)
+
+	for _, id := range []string{"repo0", "repo1"} {
+		require.NoError(t, repositories.Create(domain.Repository{Id: id, URL: id}))
+	}
+
+	for i, repoId := range []string{"repo0", "repo0", "repo1", "repo0"} {
+		number, err := builds.Create(domain.Build{Id: "build" + strconv.Itoa(i), RepoId: repoId})
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 1, 3}[i], number)
+	}
+
+	build, err := builds.GetByNumber("repo0", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "build3", build.Id)
+	assert.Equal(t, 3, build.Number)
+
+	_, err = builds.GetByNumber("repo1", 2)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = builds.Create(domain.Build{Id: "build4", RepoId: "-"})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestBuilds(t *testing.T) {
+	forEachBackend(t, testBuilds)
+}
+
+func testBuilds(t *testing.T, db *sqlx.DB) {
+	var (
+		builds = NewBuilds(db)
+		start  = time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+		pr     = &domain.PullRequest{Number: 7, Ref: "refs/pull/7/head", SourceBranch: "feature", TargetBranch: "main"}
+	)
+
+	require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: "repo", URL: "example.com"}))
+
+	for i, commit := range []domain.Commit{
+		{Hash: "a", Branch: "main", Author: &domain.Author{Name: "ci", Email: "ci@example.com"}},
+		{Hash: "b", Branch: "main"},
+		{Hash: "c", Tag: "v1.0.0"},
+		{Hash: "d", Branch: "feature", PullRequest: pr},
+		{Hash: "e", Branch: "feature", PullRequest: pr},
+	} {
+		_, err := builds.Create(domain.Build{
+			Id:        "build" + strconv.Itoa(i),
+			RepoId:    "repo",
+			Commit:    commit,
+			Trigger:   domain.TriggerPush,
+			Status:    domain.InProgress,
+			CreatedAt: start.Add(time.Minute * time.Duration(i)),
+		})
+		require.NoError(t, err)
+	}
+
+	var finished = domain.Build{
+		Id:     "build0",
+		Status: domain.Failure,
+		Log:    domain.Log{Data: "build log"},
+		Steps: []domain.StepAttempt{
+			{Step: "test", Attempt: 1, Status: domain.Failure, Error: "exit code 1", Log: domain.Log{Data: "FAIL"}},
+			{Step: "test", Attempt: 2, Status: domain.Success, Log: domain.Log{Data: "ok"}},
+		},
+		FinishedAt: start.Add(time.Second * 30),
+	}
+	require.NoError(t, builds.Update(finished))
+
+	build, err := builds.GetById("build0")
+	require.NoError(t, err)
+	assert.Equal(t, 1, build.Number)
+	assert.Equal(t, domain.Failure, build.Status)
+	assert.Equal(t, domain.TriggerPush, build.Trigger)
+	assert.Equal(t, &domain.Author{Name: "ci", Email: "ci@example.com"}, build.Commit.Author)
+	assert.Equal(t, finished.Steps, build.Steps)
+	assert.True(t, start.Equal(build.CreatedAt))
+	assert.Equal(t, time.Second*30, build.Duration())
+
+	_, err = builds.GetById("-")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	build, err = builds.GetLatestByBranch("repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "build1", build.Id)
+	assert.Nil(t, build.Commit.Author)
+
+	for _, id := range []string{"build2", "build4"} {
+		require.NoError(t, builds.Update(domain.Build{Id: id, Status: domain.Success, FinishedAt: time.Now()}))
+	}
+
+	build, err = builds.GetLatestFinished("repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "build0", build.Id, "the builds in progress are skipped")
+
+	build, err = builds.GetLatestFinished("repo", "")
+	require.NoError(t, err)
+	assert.Equal(t, "build0", build.Id, "the tag and pull request builds are skipped")
+
+	_, err = builds.GetLatestFinished("repo", "feature")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	build, err = builds.GetLatestByTag("repo", "v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "build2", build.Id)
+
+	build, err = builds.GetLatestByPullRequest("repo", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "build4", build.Id)
+	assert.Equal(t, pr, build.Commit.PullRequest)
+
+	_, err = builds.GetLatestByPullRequest("repo", 8)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	prBuilds, err := builds.GetAllByPullRequest("repo", 7)
+	require.NoError(t, err)
+	require.Len(t, prBuilds, 2)
+	assert.Equal(t, "build3", prBuilds[0].Id)
+
+	all, err := builds.GetAllByRepoId("repo")
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	require.NoError(t, builds.Delete("build0"))
+
+	_, err = builds.GetById("build0")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestBuilds_DeleteExpired(t *testing.T) {
+	forEachBackend(t, testBuildsDeleteExpired)
+}
+
+func testBuildsDeleteExpired(t *testing.T, db *sqlx.DB) {
+	var (
+		builds = NewBuilds(db)
+		start  = time.Now().Add(-time.Hour)
+	)
+
+	for _, id := range []string{"repo", "other"} {
+		require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: id, URL: id}))
+	}
+
+	for i, status := range []domain.Status{domain.Success, domain.InProgress, domain.Failure, domain.Success,
+		domain.Failure, domain.Failure, domain.Failure} {
+		_, err := builds.Create(domain.Build{
+			Id:        "build" + strconv.Itoa(i),
+			RepoId:    "repo",
+			Status:    status,
+			CreatedAt: start.Add(time.Minute * time.Duration(i)),
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, builds.Update(domain.Build{Id: "build0", Status: domain.Success, Log: domain.Log{Data: "log"}}))
+
+	_, err := builds.Create(domain.Build{Id: "other", RepoId: "other", CreatedAt: start})
+	require.NoError(t, err)
+
+	// build5 and build6 are the latest, build3 is the latest successful, build1 is in progress.
+	deleted, err := builds.DeleteExpired("repo", 2, start.Add(time.Minute*6))
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+
+	all, err := builds.GetAllByRepoId("repo")
+	require.NoError(t, err)
+
+	var ids []string
+	for _, build := range all {
+		ids = append(ids, build.Id)
+	}
+	assert.Equal(t, []string{"build1", "build3", "build5", "build6"}, ids)
+
+	_, err = NewLogs(db).GetByBuildId("build0")
+	assert.ErrorIs(t, err, domain.ErrNotFound, "logs are deleted along with the builds")
+
+	_, err = builds.GetById("other")
+	assert.NoError(t, err)
+
+	// Builds created since the cutoff are kept.
+	deleted, err = builds.DeleteExpired("repo", 0, start.Add(time.Minute*5))
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+}
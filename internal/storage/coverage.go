@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type Coverage struct {
+	db *sqlx.DB
+}
+
+func NewCoverage(db *sqlx.DB) *Coverage {
+	return &Coverage{db: db}
+}
+
+func (c Coverage) Save(buildId, step string, packages []domain.PackageCoverage) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM coverage WHERE build_id = $1 AND step = $2", buildId, step)
+	if err != nil {
+		return err
+	}
+
+	var query = "INSERT INTO coverage (build_id, step, package, covered, total) VALUES ($1, $2, $3, $4, $5)"
+
+	for _, pkg := range packages {
+		_, err = tx.Exec(query, buildId, step, pkg.Name, pkg.Covered, pkg.Total)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (c Coverage) GetByBuildId(buildId string) (domain.Coverage, error) {
+	return c.GetByStep(buildId, "")
+}
+
+func (c Coverage) GetByStep(buildId, step string) (coverage domain.Coverage, err error) {
+	var query = `SELECT package, MAX(covered), MAX(total) FROM coverage WHERE build_id = $1 AND ($2 = '' OR step = $2)
+		GROUP BY package ORDER BY package`
+
+	rows, err := c.db.Queryx(query, buildId, step)
+	if err != nil {
+		return domain.Coverage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pkg domain.PackageCoverage
+		err = rows.Scan(&pkg.Name, &pkg.Covered, &pkg.Total)
+		if err != nil {
+			return domain.Coverage{}, err
+		}
+		coverage.Packages = append(coverage.Packages, pkg)
+		coverage.Covered += pkg.Covered
+		coverage.Total += pkg.Total
+	}
+	if err = rows.Err(); err != nil {
+		return domain.Coverage{}, err
+	}
+
+	if coverage.Packages == nil {
+		return domain.Coverage{}, domain.ErrNotFound
+	}
+
+	coverage.BuildId = buildId
+	return coverage, nil
+}
+
+func (c Coverage) GetPrevious(repoId, branch, step string, before time.Time) (domain.Coverage, error) {
+	var query = `SELECT b.id FROM builds b JOIN commits c ON c.build_id = b.id
+		WHERE b.repo_id = $1 AND ($2 = '' OR c.branch = $2) AND b.status = $3 AND b.created_at < $4
+			AND c.tag = '' AND c.pull_request IS NULL
+			AND EXISTS (SELECT 1 FROM coverage WHERE build_id = b.id AND ($5 = '' OR step = $5))
+		ORDER BY b.created_at DESC LIMIT 1`
+
+	var buildId string
+
+	err := c.db.QueryRowx(query, repoId, branch, domain.Success, before, step).Scan(&buildId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Coverage{}, domain.ErrNotFound
+		}
+		return domain.Coverage{}, err
+	}
+
+	return c.GetByStep(buildId, step)
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCoverage(t *testing.T) {
+	forEachBackend(t, testCoverage)
+}
+
+func testCoverage(t *testing.T, db *sqlx.DB) {
+	var (
+		coverage = NewCoverage(db)
+		builds   = NewBuilds(db)
+		start    = time.Now().Add(-time.Hour)
+	)
+
+	require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: "repo", URL: "example.com"}))
+
+	// build1 failed, build2 is on another branch, build4 and build5 are a pull request and a tag build.
+	for i, build := range []struct {
+		commit domain.Commit
+		status domain.Status
+	}{
+		{domain.Commit{Branch: "main"}, domain.Success},
+		{domain.Commit{Branch: "main"}, domain.Failure},
+		{domain.Commit{Branch: "feature"}, domain.Success},
+		{domain.Commit{Branch: "main"}, domain.Success},
+		{domain.Commit{Branch: "main", PullRequest: &domain.PullRequest{Number: 1}}, domain.Success},
+		{domain.Commit{Tag: "v1.0.0"}, domain.Success},
+	} {
+		var id = "build" + strconv.Itoa(i)
+		build.commit.Hash = "abc"
+		_, err := builds.Create(domain.Build{
+			Id:        id,
+			RepoId:    "repo",
+			Commit:    build.commit,
+			CreatedAt: start.Add(time.Minute * time.Duration(i)),
+		})
+		require.NoError(t, err)
+		require.NoError(t, builds.Update(domain.Build{Id: id, Status: build.status, FinishedAt: time.Now()}))
+		require.NoError(t, coverage.Save(id, "test", []domain.PackageCoverage{{Name: "app", Covered: int64(i), Total: 4}}))
+	}
+
+	require.NoError(t, coverage.Save("build3", "unit", []domain.PackageCoverage{{Name: "stale", Covered: 1, Total: 1}}))
+	require.NoError(t, coverage.Save("build3", "unit", []domain.PackageCoverage{
+		{Name: "app", Covered: 1, Total: 2},
+		{Name: "app/internal", Covered: 1, Total: 2},
+	}))
+
+	current, err := coverage.GetByBuildId("build3")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Coverage{
+		BuildId: "build3",
+		Covered: 4,
+		Total:   6,
+		Packages: []domain.PackageCoverage{
+			{Name: "app", Covered: 3, Total: 4},
+			{Name: "app/internal", Covered: 1, Total: 2},
+		},
+	}, current, "a package reported by several steps is counted once")
+
+	current, err = coverage.GetByStep("build3", "unit")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Coverage{
+		BuildId: "build3",
+		Covered: 2,
+		Total:   4,
+		Packages: []domain.PackageCoverage{
+			{Name: "app", Covered: 1, Total: 2},
+			{Name: "app/internal", Covered: 1, Total: 2},
+		},
+	}, current)
+
+	previous, err := coverage.GetPrevious("repo", "main", "unit", start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "build3", previous.BuildId)
+	assert.Equal(t, int64(2), previous.Covered, "only the coverage of the step is returned")
+
+	_, err = coverage.GetPrevious("repo", "main", "unit", start.Add(time.Minute*3))
+	assert.ErrorIs(t, err, domain.ErrNotFound, "the builds without coverage of the step are skipped")
+
+	previous, err = coverage.GetPrevious("repo", "main", "", start.Add(time.Minute*3))
+	require.NoError(t, err)
+	assert.Equal(t, "build0", previous.BuildId, "the failed builds and the other branches are skipped")
+
+	previous, err = coverage.GetPrevious("repo", "", "", start.Add(time.Minute*3))
+	require.NoError(t, err)
+	assert.Equal(t, "build2", previous.BuildId, "every branch is considered if the branch is empty")
+
+	previous, err = coverage.GetPrevious("repo", "", "", start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "build3", previous.BuildId, "the pull request and tag builds are skipped")
+
+	_, err = coverage.GetPrevious("repo", "main", "", start)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = coverage.GetByBuildId("missing")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogs_GetByBuildId(t *testing.T) {
+	forEachBackend(t, testLogsGetByBuildId)
+}
+
+func testLogsGetByBuildId(t *testing.T, db *sqlx.DB) {
+	var (
+		builds = NewBuilds(db)
+		logs   = NewLogs(db)
+	)
+
+	require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: "repo", URL: "example.com"}))
+
+	_, err := builds.Create(domain.Build{Id: "build", RepoId: "repo"})
+	require.NoError(t, err)
+
+	_, err = logs.GetByBuildId("build")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	require.NoError(t, builds.Update(domain.Build{Id: "build", Status: domain.Success, Log: domain.Log{Data: "done"}}))
+
+	log, err := logs.GetByBuildId("build")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Log{Data: "done"}, log)
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/config"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/migrate"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrations_UpgradeBaseline upgrades a database created by the schema.sql preceding the migrations to head.
+func TestMigrations_UpgradeBaseline(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "sqlite.db")+"?_foreign_keys=on")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	schema, err := os.ReadFile(filepath.Join("testdata", "schema.sql"))
+	require.NoError(t, err)
+
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	var seed = []string{
+		`INSERT INTO repositories (id, url, branch, polling_interval, created_at)
+			VALUES ('repo', 'https://example.com/ci.git', 'main', '1m', '2026-01-01 00:00:00+00:00')`,
+		`INSERT INTO builds (id, repo_id, status, created_at)
+			VALUES ('build1', 'repo', 0, '2026-01-01 00:01:00+00:00')`,
+		`INSERT INTO builds (id, repo_id, status, created_at)
+			VALUES ('build2', 'repo', 1, '2026-01-01 00:02:00+00:00')`,
+		"INSERT INTO commits (build_id, hash) VALUES ('build1', 'abc')",
+		"INSERT INTO commits (build_id, hash) VALUES ('build2', 'def')",
+		"INSERT INTO logs (build_id, data) VALUES ('build2', 'output')",
+	}
+	for _, query := range seed {
+		_, err = db.Exec(query)
+		require.NoError(t, err)
+	}
+
+	migrations, err := migrate.Load(cfg.SQLite.Migrations)
+	require.NoError(t, err)
+
+	migrated, err := migrate.New(db.DB, migrations).Up()
+	require.NoError(t, err)
+	assert.Len(t, migrated, len(migrations))
+
+	repo, err := NewRepositories(db).GetById("repo")
+	require.NoError(t, err)
+	assert.Equal(t, pattern.List{"main"}, repo.Branches)
+	assert.Equal(t, pattern.List{}, repo.Tags)
+	assert.True(t, repo.Enabled)
+
+	builds := NewBuilds(db)
+
+	build, err := builds.GetByNumber("repo", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "build2", build.Id)
+	assert.Equal(t, domain.TriggerPush, build.Trigger)
+	assert.Equal(t, domain.Commit{Hash: "def", Branch: "main"}, build.Commit)
+
+	// The numbering continues after the existing builds.
+	number, err := builds.Create(domain.Build{Id: "build3", RepoId: "repo", Commit: domain.Commit{Branch: "main"},
+		Trigger: domain.TriggerPush, Status: domain.InProgress, CreatedAt: build.CreatedAt})
+	require.NoError(t, err)
+	assert.Equal(t, 3, number)
+
+	logs, err := NewLogs(db).GetByBuildId("build2")
+	require.NoError(t, err)
+	assert.Equal(t, "output", logs.Data)
+}
+
+func TestMigrations_DownUp(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "sqlite.db")+"?_foreign_keys=on")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := migrate.Load(cfg.SQLite.Migrations)
+	require.NoError(t, err)
+
+	var migrator = migrate.New(db.DB, migrations)
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	for range migrations {
+		_, err = migrator.Down()
+		require.NoError(t, err)
+	}
+
+	_, err = migrator.Down()
+	assert.ErrorIs(t, err, migrate.ErrNoMigration)
+
+	migrated, err := migrator.Up()
+	require.NoError(t, err)
+	assert.Len(t, migrated, len(migrations))
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+// deliveryColumns are the columns scanned by scanDelivery.
+const deliveryColumns = `id, target_id, event, payload, status, attempts, response_code, error, next_attempt_at,
+	created_at`
+
+type Notifications struct {
+	db *sqlx.DB
+}
+
+func NewNotifications(db *sqlx.DB) *Notifications {
+	return &Notifications{db: db}
+}
+
+func (n Notifications) CreateTarget(target domain.NotificationTarget) error {
+	var query = `INSERT INTO notification_targets (id, repo_id, url, secret, events, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := n.db.Exec(query, target.Id, target.RepoId, target.URL, target.Secret, joinEvents(target.Events),
+		time.Now())
+	return err
+}
+
+func (n Notifications) DeleteTarget(id string) error {
+	var query = "DELETE FROM notification_targets WHERE id = $1"
+
+	_, err := n.db.Exec(query, id)
+	return err
+}
+
+func (n Notifications) GetTargetById(id string) (domain.NotificationTarget, error) {
+	var query = "SELECT id, repo_id, url, secret, events, created_at FROM notification_targets WHERE id = $1"
+
+	target, err := scanTarget(n.db.QueryRowx(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.NotificationTarget{}, domain.ErrNotFound
+		}
+		return domain.NotificationTarget{}, err
+	}
+
+	return target, nil
+}
+
+func (n Notifications) GetTargetsByRepoId(repoId string) (targets []domain.NotificationTarget, err error) {
+	var query = "SELECT id, repo_id, url, secret, events, created_at FROM notification_targets WHERE repo_id = $1"
+
+	rows, err := n.db.Queryx(query, repoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		target, err := scanTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+func (n Notifications) CreateDelivery(delivery domain.Delivery) error {
+	var query = `INSERT INTO deliveries (` + deliveryColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err := n.db.Exec(query, delivery.Id, delivery.TargetId, delivery.Event, string(delivery.Payload),
+		delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.Error, delivery.NextAttemptAt, time.Now())
+	return err
+}
+
+func (n Notifications) UpdateDelivery(delivery domain.Delivery) error {
+	var query = `UPDATE deliveries SET status = $1, attempts = $2, response_code = $3, error = $4,
+		next_attempt_at = $5 WHERE id = $6`
+
+	_, err := n.db.Exec(query, delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.Error,
+		delivery.NextAttemptAt, delivery.Id)
+	return err
+}
+
+func (n Notifications) GetDueDeliveries(now time.Time) ([]domain.Delivery, error) {
+	var query = `SELECT ` + deliveryColumns + ` FROM deliveries WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY next_attempt_at`
+
+	return n.getDeliveries(query, domain.DeliveryPending, now)
+}
+
+func (n Notifications) GetDeliveriesByTargetId(targetId string) ([]domain.Delivery, error) {
+	var query = `SELECT ` + deliveryColumns + ` FROM deliveries WHERE target_id = $1 ORDER BY created_at DESC`
+
+	return n.getDeliveries(query, targetId)
+}
+
+func (n Notifications) getDeliveries(query string, args ...any) (deliveries []domain.Delivery, err error) {
+	rows, err := n.db.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			delivery domain.Delivery
+			payload  string
+		)
+		err = rows.Scan(&delivery.Id, &delivery.TargetId, &delivery.Event, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.ResponseCode, &delivery.Error, &delivery.NextAttemptAt, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func scanTarget(row interface{ Scan(...any) error }) (target domain.NotificationTarget, err error) {
+	var events string
+
+	err = row.Scan(&target.Id, &target.RepoId, &target.URL, &target.Secret, &events, &target.CreatedAt)
+	if err != nil {
+		return domain.NotificationTarget{}, err
+	}
+
+	target.Events = splitEvents(events)
+
+	return target, nil
+}
+
+// joinEvents and splitEvents store the events of a target as a comma separated list.
+func joinEvents(events []domain.NotificationEvent) string {
+	var s = make([]string, len(events))
+	for i, event := range events {
+		s[i] = string(event)
+	}
+	return strings.Join(s, ",")
+}
+
+func splitEvents(s string) (events []domain.NotificationEvent) {
+	if s == "" {
+		return nil
+	}
+	for _, event := range strings.Split(s, ",") {
+		events = append(events, domain.NotificationEvent(event))
+	}
+	return events
+}
@@ -8,6 +8,11 @@ import (
 	"time"
 )
 
+// repositoryColumns are the columns scanned by scanRepository.
+const repositoryColumns = `id, name, url, branches, tags, pull_requests, webhook_secret, status_provider, status_url,
+	status_token, polling_interval, enabled, retention_keep_last, retention_keep_days, created_at, last_polled_at,
+	last_poll_error, consecutive_failures, last_seen_hash`
+
 type Repositories struct {
 	db *sqlx.DB
 }
@@ -17,12 +22,39 @@ func NewRepositories(db *sqlx.DB) *Repositories {
 }
 
 func (r Repositories) Create(repo domain.Repository) error {
-	var query = "INSERT INTO repositories (id, url, branch, polling_interval, created_at) VALUES ($1, $2, $3, $4, $5)"
+	var query = `INSERT INTO repositories (id, name, url, branches, tags, pull_requests, webhook_secret,
+		status_provider, status_url, status_token, polling_interval, enabled, retention_keep_last, retention_keep_days,
+		created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
 
-	_, err := r.db.Exec(query, repo.Id, repo.URL, repo.Branch, repo.PollingInterval, time.Now())
+	_, err := r.db.Exec(query, repo.Id, repo.Name, repo.URL, repo.Branches, repo.Tags, repo.PullRequests,
+		repo.WebhookSecret, repo.StatusProvider, repo.StatusURL, repo.StatusToken, repo.PollingInterval, repo.Enabled,
+		repo.Retention.KeepLast, repo.Retention.KeepDays, repo.CreatedAt)
 	return err
 }
 
+func (r Repositories) Update(repo domain.Repository) error {
+	var query = `UPDATE repositories SET name = $1, branches = $2, tags = $3, pull_requests = $4,
+		webhook_secret = $5, status_provider = $6, status_url = $7, status_token = $8, polling_interval = $9,
+		enabled = $10, retention_keep_last = $11, retention_keep_days = $12 WHERE id = $13`
+
+	result, err := r.db.Exec(query, repo.Name, repo.Branches, repo.Tags, repo.PullRequests, repo.WebhookSecret,
+		repo.StatusProvider, repo.StatusURL, repo.StatusToken, repo.PollingInterval, repo.Enabled,
+		repo.Retention.KeepLast, repo.Retention.KeepDays, repo.Id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
 func (r Repositories) Delete(id string) error {
 	var query = "DELETE FROM repositories WHERE id = $1"
 
@@ -31,7 +63,7 @@ func (r Repositories) Delete(id string) error {
 }
 
 func (r Repositories) GetAll() (repos []domain.Repository, err error) {
-	var query = "SELECT id, url, branch, polling_interval, created_at FROM repositories"
+	var query = "SELECT " + repositoryColumns + " FROM repositories"
 
 	rows, err := r.db.Queryx(query)
 	if err != nil {
@@ -43,8 +75,7 @@ func (r Repositories) GetAll() (repos []domain.Repository, err error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var repo domain.Repository
-		err = rows.Scan(&repo.Id, &repo.URL, &repo.Branch, &repo.PollingInterval, &repo.CreatedAt)
+		repo, err := scanRepository(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -54,12 +85,10 @@ func (r Repositories) GetAll() (repos []domain.Repository, err error) {
 	return repos, rows.Err()
 }
 
-func (r Repositories) GetById(id string) (repo domain.Repository, err error) {
-	var query = "SELECT id, url, branch, polling_interval, created_at FROM repositories WHERE id = $1"
-
-	row := r.db.QueryRowx(query, id)
+func (r Repositories) GetById(id string) (domain.Repository, error) {
+	var query = "SELECT " + repositoryColumns + " FROM repositories WHERE id = $1"
 
-	err = row.Scan(&repo.Id, &repo.URL, &repo.Branch, &repo.PollingInterval, &repo.CreatedAt)
+	repo, err := scanRepository(r.db.QueryRowx(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return domain.Repository{}, domain.ErrNotFound
@@ -70,12 +99,10 @@ func (r Repositories) GetById(id string) (repo domain.Repository, err error) {
 	return repo, nil
 }
 
-func (r Repositories) GetByURL(url string) (repo domain.Repository, err error) {
-	var query = "SELECT id, url, branch, polling_interval, created_at FROM repositories WHERE url = $1"
-
-	row := r.db.QueryRowx(query, url)
+func (r Repositories) GetByURL(url string) (domain.Repository, error) {
+	var query = "SELECT " + repositoryColumns + " FROM repositories WHERE url = $1"
 
-	err = row.Scan(&repo.Id, &repo.URL, &repo.Branch, &repo.PollingInterval, &repo.CreatedAt)
+	repo, err := scanRepository(r.db.QueryRowx(query, url))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return domain.Repository{}, domain.ErrNotFound
@@ -85,3 +112,45 @@ func (r Repositories) GetByURL(url string) (repo domain.Repository, err error) {
 
 	return repo, nil
 }
+
+func (r Repositories) GetUnhealthy() (repos []domain.Repository, err error) {
+	var query = "SELECT " + repositoryColumns + " FROM repositories WHERE consecutive_failures > 0"
+
+	rows, err := r.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		repo, err := scanRepository(rows)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos, rows.Err()
+}
+
+func (r Repositories) UpdatePollStatus(id string, polledAt time.Time, hash, pollErr string) error {
+	var query = `UPDATE repositories SET last_polled_at = $1, last_poll_error = $2,
+		consecutive_failures = CASE WHEN $2 = '' THEN 0 ELSE consecutive_failures + 1 END,
+		last_seen_hash = CASE WHEN $2 = '' THEN $3 ELSE last_seen_hash END WHERE id = $4`
+
+	_, err := r.db.Exec(query, polledAt, pollErr, hash, id)
+	return err
+}
+
+func scanRepository(row interface{ Scan(...any) error }) (repo domain.Repository, err error) {
+	var lastPolledAt sql.NullTime
+
+	err = row.Scan(&repo.Id, &repo.Name, &repo.URL, &repo.Branches, &repo.Tags, &repo.PullRequests,
+		&repo.WebhookSecret, &repo.StatusProvider, &repo.StatusURL, &repo.StatusToken, &repo.PollingInterval,
+		&repo.Enabled, &repo.Retention.KeepLast, &repo.Retention.KeepDays, &repo.CreatedAt,
+		&lastPolledAt, &repo.PollStatus.LastError, &repo.PollStatus.ConsecutiveFailures, &repo.PollStatus.LastSeenHash)
+	if lastPolledAt.Valid {
+		repo.PollStatus.LastPolledAt = &lastPolledAt.Time
+	}
+	return repo, err
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/duration"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRepositories(t *testing.T) {
+	forEachBackend(t, testRepositories)
+}
+
+func testRepositories(t *testing.T, db *sqlx.DB) {
+	var (
+		repositories = NewRepositories(db)
+		now          = time.Now().Truncate(time.Microsecond)
+		repo         = domain.Repository{
+			Id:              "repo",
+			Name:            "ci",
+			URL:             "https://example.com/ci.git",
+			Branches:        pattern.List{"main", "release/*"},
+			PullRequests:    true,
+			WebhookSecret:   "secret",
+			StatusProvider:  domain.GitHub,
+			PollingInterval: duration.Duration(time.Minute),
+			Enabled:         true,
+			Retention:       domain.Retention{KeepLast: 10},
+			CreatedAt:       now,
+		}
+	)
+
+	require.NoError(t, repositories.Create(repo))
+
+	stored, err := repositories.GetByURL(repo.URL)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(stored.CreatedAt))
+	assert.Equal(t, repo.Branches, stored.Branches)
+	assert.Equal(t, pattern.List{}, stored.Tags)
+	assert.Equal(t, repo.PollingInterval, stored.PollingInterval)
+	assert.Equal(t, repo.Retention, stored.Retention)
+	assert.Nil(t, stored.PollStatus.LastPolledAt)
+
+	_, err = repositories.GetById("-")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	repo.Name, repo.Enabled, repo.PollingInterval = "renamed", false, duration.Duration(time.Hour)
+	repo.Retention = domain.Retention{KeepDays: 30}
+	require.NoError(t, repositories.Update(repo))
+
+	stored, err = repositories.GetById(repo.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", stored.Name)
+	assert.False(t, stored.Enabled)
+	assert.Equal(t, time.Hour, stored.PollingInterval.Duration())
+	assert.Equal(t, domain.Retention{KeepDays: 30}, stored.Retention)
+
+	require.NoError(t, repositories.Update(repo), "an update without changes is not a missing repository")
+	assert.ErrorIs(t, repositories.Update(domain.Repository{Id: "-"}), domain.ErrNotFound)
+
+	require.NoError(t, repositories.UpdatePollStatus(repo.Id, now, "abc", ""))
+	require.NoError(t, repositories.UpdatePollStatus(repo.Id, now, "", "timeout"))
+	require.NoError(t, repositories.UpdatePollStatus(repo.Id, now.Add(time.Minute), "", "timeout"))
+
+	unhealthy, err := repositories.GetUnhealthy()
+	require.NoError(t, err)
+	require.Len(t, unhealthy, 1)
+	assert.Equal(t, "timeout", unhealthy[0].PollStatus.LastError)
+	assert.Equal(t, 2, unhealthy[0].PollStatus.ConsecutiveFailures)
+	assert.Equal(t, "abc", unhealthy[0].PollStatus.LastSeenHash)
+	assert.True(t, now.Add(time.Minute).Equal(*unhealthy[0].PollStatus.LastPolledAt))
+
+	require.NoError(t, repositories.UpdatePollStatus(repo.Id, now, "def", ""))
+
+	unhealthy, err = repositories.GetUnhealthy()
+	require.NoError(t, err)
+	assert.Empty(t, unhealthy)
+
+	_, err = NewBuilds(db).Create(domain.Build{Id: "build", RepoId: repo.Id})
+	require.NoError(t, err)
+
+	require.NoError(t, repositories.Delete(repo.Id))
+
+	repos, err := repositories.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, repos)
+
+	_, err = NewBuilds(db).GetById("build")
+	assert.ErrorIs(t, err, domain.ErrNotFound, "builds are deleted along with the repository")
+}
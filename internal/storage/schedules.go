@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type Schedules struct {
+	db *sqlx.DB
+}
+
+func NewSchedules(db *sqlx.DB) *Schedules {
+	return &Schedules{db: db}
+}
+
+func (s Schedules) Create(schedule domain.Schedule) error {
+	var query = "INSERT INTO schedules (id, repo_id, expression, branch, created_at) VALUES ($1, $2, $3, $4, $5)"
+
+	_, err := s.db.Exec(query, schedule.Id, schedule.RepoId, schedule.Expression, schedule.Branch, time.Now())
+	return err
+}
+
+func (s Schedules) Update(schedule domain.Schedule) error {
+	var query = "UPDATE schedules SET expression = $1, branch = $2 WHERE id = $3"
+
+	_, err := s.db.Exec(query, schedule.Expression, schedule.Branch, schedule.Id)
+	return err
+}
+
+func (s Schedules) Delete(id string) error {
+	var query = "DELETE FROM schedules WHERE id = $1"
+
+	_, err := s.db.Exec(query, id)
+	return err
+}
+
+func (s Schedules) GetAll() ([]domain.Schedule, error) {
+	var query = "SELECT id, repo_id, expression, branch, created_at FROM schedules"
+
+	return s.getAll(query)
+}
+
+func (s Schedules) GetAllByRepoId(repoId string) ([]domain.Schedule, error) {
+	var query = "SELECT id, repo_id, expression, branch, created_at FROM schedules WHERE repo_id = $1"
+
+	return s.getAll(query, repoId)
+}
+
+func (s Schedules) GetById(id string) (schedule domain.Schedule, err error) {
+	var query = "SELECT id, repo_id, expression, branch, created_at FROM schedules WHERE id = $1"
+
+	row := s.db.QueryRowx(query, id)
+
+	err = row.Scan(&schedule.Id, &schedule.RepoId, &schedule.Expression, &schedule.Branch, &schedule.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Schedule{}, domain.ErrNotFound
+		}
+		return domain.Schedule{}, err
+	}
+
+	return schedule, nil
+}
+
+func (s Schedules) getAll(query string, args ...any) (schedules []domain.Schedule, err error) {
+	rows, err := s.db.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schedule domain.Schedule
+		err = rows.Scan(&schedule.Id, &schedule.RepoId, &schedule.Expression, &schedule.Branch, &schedule.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
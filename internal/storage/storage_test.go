@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/KirillMironov/ci/config"
+	"github.com/KirillMironov/ci/pkg/migrate"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// postgresDSNEnv is the environment variable with the DSN of a Postgres database used to run the storage tests.
+	// The Postgres tests are skipped if it is empty, unless postgresRequiredEnv is set.
+	postgresDSNEnv = "CI_TEST_POSTGRES_DSN"
+	// postgresRequiredEnv is the environment variable failing the Postgres tests instead of skipping them
+	// if postgresDSNEnv is empty. It is set by make test-postgres.
+	postgresRequiredEnv = "CI_TEST_POSTGRES_REQUIRED"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(postgresDSNEnv) == "" && os.Getenv(postgresRequiredEnv) == "" {
+		fmt.Fprintf(os.Stderr, "WARNING: %s is not set, the Postgres storage tests are skipped. "+
+			"Run make test-postgres to run them.\n", postgresDSNEnv)
+	}
+	os.Exit(m.Run())
+}
+
+// forEachBackend runs the test against an empty migrated database of every storage backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, db *sqlx.DB)) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "sqlite.db")+"?_foreign_keys=on")
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		migrateDB(t, db, cfg.SQLite.Migrations)
+		test(t, db)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		var dsn = os.Getenv(postgresDSNEnv)
+		if dsn == "" {
+			if os.Getenv(postgresRequiredEnv) != "" {
+				t.Fatalf("%s is not set", postgresDSNEnv)
+			}
+			t.Skipf("%s is not set", postgresDSNEnv)
+		}
+
+		admin, err := sqlx.Open("postgres", dsn)
+		require.NoError(t, err)
+		t.Cleanup(func() { admin.Close() })
+
+		// Every test gets its own schema, dropped afterwards.
+		var schema = "test_" + xid.New().String()
+
+		_, err = admin.Exec("CREATE SCHEMA " + schema)
+		require.NoError(t, err)
+		t.Cleanup(func() { _, _ = admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+		db, err := sqlx.Open("postgres", withSearchPath(t, dsn, schema))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		migrateDB(t, db, cfg.Postgres.Migrations)
+		test(t, db)
+	})
+}
+
+func migrateDB(t *testing.T, db *sqlx.DB, dir fs.FS) {
+	t.Helper()
+
+	migrations, err := migrate.Load(dir)
+	require.NoError(t, err)
+
+	_, err = migrate.New(db.DB, migrations).Up()
+	require.NoError(t, err)
+}
+
+// withSearchPath returns the Postgres DSN, given as a URL or as key=value pairs, with the schema search path set.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	t.Helper()
+
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
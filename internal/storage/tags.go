@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type Tags struct {
+	db *sqlx.DB
+}
+
+func NewTags(db *sqlx.DB) *Tags {
+	return &Tags{db: db}
+}
+
+func (t Tags) GetBaseline(repoId string) (baseline domain.TagBaseline, err error) {
+	err = t.db.QueryRowx("SELECT patterns FROM tag_baselines WHERE repo_id = $1", repoId).Scan(&baseline.Patterns)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.TagBaseline{}, domain.ErrNotFound
+		}
+		return domain.TagBaseline{}, err
+	}
+
+	rows, err := t.db.Queryx("SELECT tag FROM seen_tags WHERE repo_id = $1 ORDER BY tag", repoId)
+	if err != nil {
+		return domain.TagBaseline{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return domain.TagBaseline{}, err
+		}
+		baseline.Tags = append(baseline.Tags, tag)
+	}
+
+	return baseline, rows.Err()
+}
+
+func (t Tags) SetBaseline(repoId string, baseline domain.TagBaseline) error {
+	tx, err := t.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM tag_baselines WHERE repo_id = $1", repoId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO tag_baselines (repo_id, patterns) VALUES ($1, $2)", repoId, baseline.Patterns)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM seen_tags WHERE repo_id = $1", repoId)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range baseline.Tags {
+		_, err = tx.Exec("INSERT INTO seen_tags (repo_id, tag) VALUES ($1, $2)", repoId, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
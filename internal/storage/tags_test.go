@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	forEachBackend(t, testTags)
+}
+
+func testTags(t *testing.T, db *sqlx.DB) {
+	var tags = NewTags(db)
+
+	require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: "repo", URL: "example.com"}))
+
+	_, err := tags.GetBaseline("repo")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	require.NoError(t, tags.SetBaseline("repo", domain.TagBaseline{
+		Patterns: pattern.List{"v*"},
+		Tags:     []string{"v1.1.0", "v1.0.0"},
+	}))
+
+	baseline, err := tags.GetBaseline("repo")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TagBaseline{
+		Patterns: pattern.List{"v*"},
+		Tags:     []string{"v1.0.0", "v1.1.0"},
+	}, baseline)
+
+	require.NoError(t, tags.SetBaseline("repo", domain.TagBaseline{Patterns: pattern.List{"release-*"}}))
+
+	baseline, err = tags.GetBaseline("repo")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TagBaseline{Patterns: pattern.List{"release-*"}}, baseline,
+		"the tags of the previous baseline are replaced")
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type Tests struct {
+	db *sqlx.DB
+}
+
+func NewTests(db *sqlx.DB) *Tests {
+	return &Tests{db: db}
+}
+
+func (t Tests) Save(buildId, step string, attempt int, tests []domain.TestCase) error {
+	tx, err := t.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM tests WHERE build_id = $1 AND step = $2 AND attempt = $3", buildId, step,
+		attempt)
+	if err != nil {
+		return err
+	}
+
+	var query = `INSERT INTO tests (build_id, step, attempt, position, class_name, name, duration, status, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	for i, test := range tests {
+		_, err = tx.Exec(query, buildId, step, attempt, i, test.ClassName, test.Name, int64(test.Duration), test.Status,
+			test.Message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (t Tests) GetAllByBuildId(buildId string) (tests []domain.TestCase, err error) {
+	var query = `SELECT build_id, step, attempt, class_name, name, duration, status, message FROM tests
+		WHERE build_id = $1 ORDER BY step, attempt, position`
+
+	rows, err := t.db.Queryx(query, buildId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var test domain.TestCase
+		err = rows.Scan(&test.BuildId, &test.Step, &test.Attempt, &test.ClassName, &test.Name, &test.Duration,
+			&test.Status, &test.Message)
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, test)
+	}
+
+	return tests, rows.Err()
+}
+
+func (t Tests) GetFlaky(repoId, branch string, builds int) (tests []domain.TestCase, err error) {
+	var query = `SELECT DISTINCT t.step, t.class_name, t.name FROM tests t JOIN commits c ON c.build_id = t.build_id
+		WHERE t.build_id IN (
+			SELECT b.id FROM builds b JOIN commits c ON c.build_id = b.id
+			WHERE b.repo_id = $1 AND c.branch = $2 ORDER BY b.created_at DESC LIMIT $3
+		)
+		GROUP BY t.step, t.class_name, t.name, c.hash
+		HAVING SUM(CASE WHEN t.status = $4 THEN 1 ELSE 0 END) > 0
+			AND SUM(CASE WHEN t.status = $5 THEN 1 ELSE 0 END) > 0
+		ORDER BY t.step, t.class_name, t.name`
+
+	rows, err := t.db.Queryx(query, repoId, branch, builds, domain.Success, domain.Failure)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var test domain.TestCase
+		err = rows.Scan(&test.Step, &test.ClassName, &test.Name)
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, test)
+	}
+
+	return tests, rows.Err()
+}
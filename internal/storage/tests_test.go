@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTests(t *testing.T) {
+	forEachBackend(t, testTests)
+}
+
+func testTests(t *testing.T, db *sqlx.DB) {
+	var (
+		tests  = NewTests(db)
+		builds = NewBuilds(db)
+		start  = time.Now().Add(-time.Hour)
+	)
+
+	require.NoError(t, NewRepositories(db).Create(domain.Repository{Id: "repo", URL: "example.com"}))
+
+	// build0 and build1 are rebuilds of the same commit on main, build2 is on feature, build3 and build4 are
+	// the latest commits on main.
+	for i, commit := range []domain.Commit{
+		{Hash: "a", Branch: "main"},
+		{Hash: "a", Branch: "main"},
+		{Hash: "a", Branch: "feature"},
+		{Hash: "b", Branch: "main"},
+		{Hash: "c", Branch: "main"},
+	} {
+		_, err := builds.Create(domain.Build{
+			Id:        "build" + strconv.Itoa(i),
+			RepoId:    "repo",
+			Commit:    commit,
+			CreatedAt: start.Add(time.Minute * time.Duration(i)),
+		})
+		require.NoError(t, err)
+	}
+
+	// Test0 and Test1 flip on the same commit, Test2 flips on another branch, Test3 regresses and is then fixed.
+	var results = map[string][]domain.Status{
+		"build0": {domain.Failure, domain.Success, domain.Success, domain.Success},
+		"build1": {domain.Success, domain.Failure, domain.Success, domain.Skipped},
+		"build2": {domain.Success, domain.Success, domain.Failure, domain.Success},
+		"build3": {domain.Success, domain.Success, domain.Success, domain.Failure},
+		"build4": {domain.Success, domain.Success, domain.Success, domain.Success},
+	}
+	for buildId, statuses := range results {
+		var cases []domain.TestCase
+		for i, status := range statuses {
+			cases = append(cases, domain.TestCase{ClassName: "pkg", Name: "Test" + strconv.Itoa(i), Status: status})
+		}
+		require.NoError(t, tests.Save(buildId, "test", 1, cases))
+	}
+
+	// TestRetried fails on the first attempt of the latest build and passes when the step is retried.
+	var retried = func(status domain.Status) []domain.TestCase {
+		return []domain.TestCase{{Name: "TestRetried", Status: status}}
+	}
+	require.NoError(t, tests.Save("build4", "retry", 1, retried(domain.Failure)))
+	require.NoError(t, tests.Save("build4", "retry", 2, retried(domain.Success)))
+
+	require.NoError(t, tests.Save("build1", "lint", 1, []domain.TestCase{{Name: "stale", Status: domain.Failure}}))
+	require.NoError(t, tests.Save("build1", "lint", 1, []domain.TestCase{{
+		ClassName: "lint",
+		Name:      "vet",
+		Duration:  time.Millisecond * 1500,
+		Status:    domain.Failure,
+		Message:   "unreachable code",
+	}}))
+
+	all, err := tests.GetAllByBuildId("build1")
+	require.NoError(t, err)
+	require.Len(t, all, 5, "the tests of a step attempt are replaced")
+	assert.Equal(t, domain.TestCase{
+		BuildId:   "build1",
+		Step:      "lint",
+		Attempt:   1,
+		ClassName: "lint",
+		Name:      "vet",
+		Duration:  time.Millisecond * 1500,
+		Status:    domain.Failure,
+		Message:   "unreachable code",
+	}, all[0])
+	assert.Equal(t, []string{"Test0", "Test1", "Test2", "Test3"},
+		[]string{all[1].Name, all[2].Name, all[3].Name, all[4].Name})
+
+	var names = func(tests []domain.TestCase) (names []string) {
+		for _, test := range tests {
+			names = append(names, test.Step+"/"+test.ClassName+"/"+test.Name)
+		}
+		return names
+	}
+
+	flaky, err := tests.GetFlaky("repo", "main", 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"retry//TestRetried", "test/pkg/Test0", "test/pkg/Test1"}, names(flaky),
+		"a regression fixed by a later commit is not flaky")
+
+	flaky, err = tests.GetFlaky("repo", "main", 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"retry//TestRetried"}, names(flaky), "only the latest builds are compared")
+
+	all, err = tests.GetAllByBuildId("build4")
+	require.NoError(t, err)
+	require.Len(t, all, 6, "the tests of every attempt are kept")
+	assert.Equal(t, []int{1, 2}, []int{all[0].Attempt, all[1].Attempt})
+
+	flaky, err = tests.GetFlaky("repo", "feature", 3)
+	require.NoError(t, err)
+	assert.Empty(t, flaky)
+}
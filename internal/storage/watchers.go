@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type Watchers struct {
+	db *sqlx.DB
+}
+
+func NewWatchers(db *sqlx.DB) *Watchers {
+	return &Watchers{db: db}
+}
+
+func (w Watchers) Create(watcher domain.Watcher) error {
+	var query = "INSERT INTO watchers (repo_id, email, created_at) VALUES ($1, $2, $3)"
+
+	_, err := w.db.Exec(query, watcher.RepoId, watcher.Email, time.Now())
+	return err
+}
+
+func (w Watchers) Delete(repoId, email string) error {
+	var query = "DELETE FROM watchers WHERE repo_id = $1 AND email = $2"
+
+	_, err := w.db.Exec(query, repoId, email)
+	return err
+}
+
+func (w Watchers) GetAllByRepoId(repoId string) (watchers []domain.Watcher, err error) {
+	var query = "SELECT repo_id, email, created_at FROM watchers WHERE repo_id = $1 ORDER BY email"
+
+	rows, err := w.db.Queryx(query, repoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var watcher domain.Watcher
+		err = rows.Scan(&watcher.RepoId, &watcher.Email, &watcher.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, watcher)
+	}
+
+	return watchers, rows.Err()
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+func (h Handler) getArtifacts(c echo.Context) error {
+	build, err := h.findBuild(c)
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := h.artifactsStorage.GetAllByBuildId(build.Id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"artifacts": artifacts})
+}
+
+func (h Handler) downloadArtifact(c echo.Context) error {
+	build, err := h.findBuild(c)
+	if err != nil {
+		return err
+	}
+
+	// The path is left escaped if the request path is escaped in a non-default way.
+	var name = c.Param("*")
+	if c.Request().URL.RawPath != "" {
+		name, err = url.PathUnescape(name)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+	}
+
+	artifact, err := h.artifactsStorage.GetByPath(build.Id, name)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	file, err := h.artifactFiles.Open(artifact.Checksum)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	defer file.Close()
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=%q", path.Base(artifact.Path)))
+	http.ServeContent(c.Response(), c.Request(), artifact.Path, artifact.CreatedAt, file)
+	return nil
+}
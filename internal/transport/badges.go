@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/badge"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// badgeMaxAge is how long a badge is cached before it is revalidated with its ETag.
+const badgeMaxAge = time.Minute
+
+type badgeForm struct {
+	Branch string `query:"branch"`
+	Label  string `query:"label" validate:"max=64"`
+}
+
+func (h Handler) getStatusBadge(c echo.Context) error {
+	var form badgeForm
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	// The route parameter is the file name, such as <repoId>.svg.
+	var file = c.Param("repoId")
+	if !strings.HasSuffix(file, ".svg") {
+		return echo.NewHTTPError(http.StatusNotFound, domain.ErrNotFound)
+	}
+
+	var repoId = strings.TrimSuffix(file, ".svg")
+
+	branch, err := h.badgeBranch(repoId, form.Branch)
+	if err != nil {
+		return err
+	}
+
+	var message, color = "unknown", badge.Grey
+
+	build, err := h.buildsStorage.GetLatestFinished(repoId, branch)
+	switch {
+	case err == nil:
+		message, color = statusBadge(build.Status)
+	case !errors.Is(err, domain.ErrNotFound):
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return serveBadge(c, form.label("build"), message, color)
+}
+
+func (h Handler) getCoverageBadge(c echo.Context) error {
+	var form badgeForm
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	var repoId = c.Param("repoId")
+
+	branch, err := h.badgeBranch(repoId, form.Branch)
+	if err != nil {
+		return err
+	}
+
+	var message, color = "unknown", badge.Grey
+
+	coverage, err := h.coverageStorage.GetPrevious(repoId, branch, "", time.Now())
+	switch {
+	case err == nil:
+		message = strconv.FormatFloat(coverage.Percent(), 'f', 1, 64) + "%"
+		color = coverageBadgeColor(coverage.Percent())
+	case !errors.Is(err, domain.ErrNotFound):
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return serveBadge(c, form.label("coverage"), message, color)
+}
+
+// badgeBranch returns the branch given in the query or, if it is empty, the default branch of the repository.
+func (h Handler) badgeBranch(repoId, branch string) (string, error) {
+	repo, err := h.repositoriesStorage.GetById(repoId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return "", echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if branch == "" {
+		return repo.DefaultBranch(), nil
+	}
+	return branch, nil
+}
+
+// label returns the label given in the query or the default one.
+func (f badgeForm) label(fallback string) string {
+	if f.Label == "" {
+		return fallback
+	}
+	return f.Label
+}
+
+func statusBadge(status domain.Status) (message, color string) {
+	switch status {
+	case domain.Success:
+		return "passing", badge.Green
+	case domain.Failure:
+		return "failing", badge.Red
+	default:
+		return status.String(), badge.Grey
+	}
+}
+
+func coverageBadgeColor(percent float64) string {
+	switch {
+	case percent >= 80:
+		return badge.Green
+	case percent >= 60:
+		return badge.Yellow
+	default:
+		return badge.Red
+	}
+}
+
+// serveBadge renders the badge, responding with 304 Not Modified if the client has the same badge.
+func serveBadge(c echo.Context, label, message, color string) error {
+	var (
+		svg  = badge.Render(label, message, color)
+		sum  = sha256.Sum256(svg)
+		etag = `"` + hex.EncodeToString(sum[:8]) + `"`
+	)
+
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(badgeMaxAge.Seconds())))
+
+	if strings.Contains(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, "image/svg+xml", svg)
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/mock"
+	"github.com/KirillMironov/ci/pkg/pattern"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBadges(t *testing.T) {
+	var (
+		repositoriesStorage = mock.NewRepositories()
+		buildsStorage       = mock.NewBuilds()
+		coverageStorage     = mock.NewCoverage()
+		router              = NewHandler(t.TempDir(), nil, repositoriesStorage, buildsStorage, nil, nil, nil, nil, nil,
+			nil, coverageStorage, nil, nil, nil, nil).Routes()
+		now = time.Now()
+	)
+
+	for _, repo := range []domain.Repository{
+		{Id: "repo", URL: "repo", Branches: pattern.List{"release/*", "main", "feature"}},
+		{Id: "glob", URL: "glob", Branches: pattern.List{"*"}},
+	} {
+		require.NoError(t, repositoriesStorage.Create(repo))
+	}
+
+	for i, build := range []domain.Build{
+		{Id: "0", Commit: domain.Commit{Branch: "main"}, Status: domain.Success},
+		{Id: "1", Commit: domain.Commit{Branch: "feature"}, Status: domain.Failure},
+		{Id: "2", Commit: domain.Commit{Branch: "main"}, Status: domain.InProgress},
+		{Id: "3", Commit: domain.Commit{Branch: "main", PullRequest: &domain.PullRequest{Number: 1}},
+			Status: domain.Failure},
+		{Id: "4", Commit: domain.Commit{Tag: "v1.0.0"}, Status: domain.Failure},
+		{Id: "5", RepoId: "glob", Commit: domain.Commit{Branch: "dev"}, Status: domain.Failure},
+		{Id: "6", RepoId: "glob", Commit: domain.Commit{Tag: "v1.0.0"}, Status: domain.Success},
+	} {
+		if build.RepoId == "" {
+			build.RepoId = "repo"
+		}
+		build.CreatedAt = now.Add(time.Minute * time.Duration(i))
+		_, err := buildsStorage.Create(build)
+		require.NoError(t, err)
+	}
+	coverageStorage.Previous = &domain.Coverage{Covered: 3, Total: 4}
+
+	tests := map[string]struct {
+		target       string
+		expectedCode int
+		expectedText string
+	}{
+		"default branch": {
+			target:       "/badge/repo.svg",
+			expectedCode: http.StatusOK,
+			expectedText: "build: passing",
+		},
+		"branch": {
+			target:       "/badge/repo.svg?branch=feature",
+			expectedCode: http.StatusOK,
+			expectedText: "build: failing",
+		},
+		"any branch without default": {
+			target:       "/badge/glob.svg",
+			expectedCode: http.StatusOK,
+			expectedText: "build: failing",
+		},
+		"label": {
+			target:       "/badge/repo.svg?branch=main&label=ci",
+			expectedCode: http.StatusOK,
+			expectedText: "ci: passing",
+		},
+		"no builds": {
+			target:       "/badge/repo.svg?branch=dev",
+			expectedCode: http.StatusOK,
+			expectedText: "build: unknown",
+		},
+		"unknown repository": {
+			target:       "/badge/other.svg",
+			expectedCode: http.StatusNotFound,
+		},
+		"coverage": {
+			target:       "/badge/repo/coverage.svg",
+			expectedCode: http.StatusOK,
+			expectedText: "coverage: 75.0%",
+		},
+		"coverage of unknown repository": {
+			target:       "/badge/other/coverage.svg",
+			expectedCode: http.StatusNotFound,
+		},
+		"not svg": {
+			target:       "/badge/repo",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var rec = httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			require.Equal(t, tc.expectedCode, rec.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Body.String(), "<title>"+tc.expectedText+"</title>")
+
+			var req = httptest.NewRequest(http.MethodGet, tc.target, nil)
+			req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+
+			rec = httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusNotModified, rec.Code)
+			assert.Empty(t, rec.Body.String())
+		})
+	}
+}
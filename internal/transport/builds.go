@@ -5,26 +5,103 @@ import (
 	"github.com/KirillMironov/ci/internal/domain"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// defaultBuildsLimit is the number of builds per page if no limit is given.
+const defaultBuildsLimit = 20
+
 func (h Handler) getBuildById(c echo.Context) error {
-	build, err := h.buildsStorage.GetById(c.Param("buildId"))
+	build, err := h.findBuild(c)
+	if err != nil {
+		return err
+	}
+
+	build.Coverage, err = h.buildCoverage(build)
 	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			return echo.NewHTTPError(http.StatusNotFound, err)
-		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
 	return c.JSON(http.StatusOK, build)
 }
 
-func (h Handler) getBuildsByRepoId(c echo.Context) error {
-	builds, err := h.buildsStorage.GetAllByRepoId(c.Param("repoId"))
+// findBuild returns the build with the id given in the path or, if the id is a number, the build with that number.
+func (h Handler) findBuild(c echo.Context) (build domain.Build, err error) {
+	if number, convErr := strconv.Atoi(c.Param("buildId")); convErr == nil {
+		build, err = h.buildsStorage.GetByNumber(c.Param("repoId"), number)
+	} else {
+		build, err = h.buildsStorage.GetById(c.Param("buildId"))
+	}
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
-			return echo.NewHTTPError(http.StatusNotFound, err)
+			return domain.Build{}, echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return domain.Build{}, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return build, nil
+}
+
+func (h Handler) getBuildsByRepoId(c echo.Context) error {
+	var form struct {
+		Cursor string    `query:"cursor"`
+		Limit  int       `query:"limit" validate:"omitempty,min=1,max=100"`
+		Status string    `query:"status" validate:"omitempty,oneof=success failure skipped 'in progress'"`
+		Branch string    `query:"branch"`
+		Commit string    `query:"commit" validate:"omitempty,hexadecimal,max=40"`
+		Author string    `query:"author"`
+		Since  time.Time `query:"since"`
+		Until  time.Time `query:"until"`
+		Sort   string    `query:"sort" validate:"omitempty,oneof=asc desc"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	var filter = domain.BuildsFilter{
+		RepoId:    c.Param("repoId"),
+		Branch:    form.Branch,
+		Commit:    form.Commit,
+		Author:    form.Author,
+		Since:     form.Since,
+		Until:     form.Until,
+		Ascending: form.Sort == "asc",
+		Cursor:    form.Cursor,
+		Limit:     form.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultBuildsLimit
+	}
+	if form.Status != "" {
+		status, err := domain.ParseStatus(form.Status)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		filter.Status = &status
+	}
+
+	page, err := h.buildsStorage.GetPage(filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCursor) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"builds": page.Builds, "total": page.Total, "next_cursor": page.NextCursor})
+}
+
+func (h Handler) getBuildsByPullRequest(c echo.Context) error {
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	builds, err := h.buildsStorage.GetAllByPullRequest(c.Param("repoId"), number)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
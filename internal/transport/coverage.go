@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h Handler) getCoverage(c echo.Context) error {
+	build, err := h.findBuild(c)
+	if err != nil {
+		return err
+	}
+
+	coverage, err := h.buildCoverage(build)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if coverage == nil {
+		return echo.NewHTTPError(http.StatusNotFound, domain.ErrNotFound)
+	}
+
+	return c.JSON(http.StatusOK, coverage)
+}
+
+// buildCoverage returns the coverage of the build along with its delta against the previous successful build
+// of the branch, or nil if the build has no coverage.
+func (h Handler) buildCoverage(build domain.Build) (*domain.Coverage, error) {
+	coverage, err := h.coverageStorage.GetByBuildId(build.Id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if build.Commit.Branch == "" {
+		return &coverage, nil
+	}
+
+	previous, err := h.coverageStorage.GetPrevious(build.RepoId, build.Commit.Branch, "", build.CreatedAt)
+	switch {
+	case err == nil:
+		var delta = coverage.Percent() - previous.Percent()
+		coverage.Delta = &delta
+	case !errors.Is(err, domain.ErrNotFound):
+		return nil, err
+	}
+
+	return &coverage, nil
+}
@@ -1,35 +1,76 @@
 package transport
 
 import (
+	"context"
 	"github.com/KirillMironov/ci/internal/domain"
 	"github.com/KirillMironov/ci/pkg/echox"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"net/http"
+	"os"
 	"strings"
 )
 
 // Handler used to handle HTTP requests.
 type Handler struct {
-	staticRootDir       string
-	scheduler           scheduler
-	repositoriesStorage domain.RepositoriesStorage
-	buildsStorage       domain.BuildsStorage
-	logsStorage         domain.LogsStorage
+	staticRootDir        string
+	scheduler            scheduler
+	repositoriesStorage  domain.RepositoriesStorage
+	buildsStorage        domain.BuildsStorage
+	logsStorage          domain.LogsStorage
+	schedulesStorage     domain.SchedulesStorage
+	notificationsStorage domain.NotificationsStorage
+	watchersStorage      domain.WatchersStorage
+	artifactsStorage     domain.ArtifactsStorage
+	testsStorage         domain.TestsStorage
+	coverageStorage      domain.CoverageStorage
+	artifactFiles        artifactFiles
+	janitor              janitor
+	metrics              http.Handler
+	health               health
+}
+
+type health interface {
+	Check(context.Context) (results map[string]error, ok bool)
+}
+
+type artifactFiles interface {
+	Open(checksum string) (*os.File, error)
+}
+
+type janitor interface {
+	Run(context.Context) domain.CleanupReport
 }
 
 type scheduler interface {
-	Add(domain.Repository)
-	Remove(id string)
+	Add(domain.Repository) (domain.Repository, error)
+	Remove(id string) error
+	Update(id string, update func(*domain.Repository)) (domain.Repository, error)
+	Pause(id string) error
+	Resume(id string) error
+	Trigger(domain.Repository, ...domain.Commit)
 }
 
 func NewHandler(staticRootDir string, s scheduler, rs domain.RepositoriesStorage, bs domain.BuildsStorage,
-	ls domain.LogsStorage) *Handler {
+	ls domain.LogsStorage, ss domain.SchedulesStorage, ns domain.NotificationsStorage,
+	ws domain.WatchersStorage, as domain.ArtifactsStorage, ts domain.TestsStorage, cs domain.CoverageStorage,
+	artifactFiles artifactFiles, janitor janitor, metrics http.Handler, health health) *Handler {
 	return &Handler{
-		staticRootDir:       staticRootDir,
-		scheduler:           s,
-		repositoriesStorage: rs,
-		buildsStorage:       bs,
-		logsStorage:         ls,
+		staticRootDir:        staticRootDir,
+		scheduler:            s,
+		repositoriesStorage:  rs,
+		buildsStorage:        bs,
+		logsStorage:          ls,
+		schedulesStorage:     ss,
+		notificationsStorage: ns,
+		watchersStorage:      ws,
+		artifactsStorage:     as,
+		testsStorage:         ts,
+		coverageStorage:      cs,
+		artifactFiles:        artifactFiles,
+		janitor:              janitor,
+		metrics:              metrics,
+		health:               health,
 	}
 }
 
@@ -42,17 +83,30 @@ func (h Handler) Routes() *echo.Echo {
 		middleware.Recover(),
 		middleware.CORSWithConfig(middleware.CORSConfig{
 			AllowOrigins: []string{"*"},
-			AllowMethods: []string{echo.GET, echo.POST, echo.DELETE, echo.OPTIONS},
+			AllowMethods: []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE, echo.OPTIONS},
 		}),
 		middleware.StaticWithConfig(middleware.StaticConfig{
 			Root:  h.staticRootDir,
 			HTML5: true,
 			Skipper: func(c echo.Context) bool {
-				return strings.HasPrefix(c.Request().URL.Path, "/api/")
+				switch c.Request().URL.Path {
+				case "/metrics", "/healthz", "/readyz":
+					return true
+				}
+				return strings.HasPrefix(c.Request().URL.Path, "/api/") ||
+					strings.HasPrefix(c.Request().URL.Path, "/badge/")
 			},
 		}),
 	)
 
+	router.GET("/metrics", echo.WrapHandler(h.metrics))
+	router.GET("/healthz", h.healthz)
+	router.GET("/readyz", h.readyz)
+
+	// The badges are embedded in READMEs, so they are served outside the API.
+	router.GET("/badge/:repoId", h.getStatusBadge)
+	router.GET("/badge/:repoId/coverage.svg", h.getCoverageBadge)
+
 	api := router.Group("/api/v1")
 	{
 		repositories := api.Group("/repositories")
@@ -61,16 +115,50 @@ func (h Handler) Routes() *echo.Echo {
 			repositories.DELETE("", h.removeRepository)
 			repositories.GET("", h.getRepositories)
 			repositories.GET("/:repoId", h.getRepositoryById)
+			repositories.PATCH("/:repoId", h.updateRepository)
+			repositories.POST("/:repoId/pause", h.pauseRepository)
+			repositories.POST("/:repoId/resume", h.resumeRepository)
+			repositories.POST("/:repoId/webhook", h.receiveWebhook)
 		}
 		builds := api.Group("/repositories/:repoId/builds")
 		{
 			builds.GET("", h.getBuildsByRepoId)
 			builds.GET("/:buildId", h.getBuildById)
+			builds.GET("/:buildId/artifacts", h.getArtifacts)
+			builds.GET("/:buildId/artifacts/*", h.downloadArtifact)
+			builds.GET("/:buildId/tests", h.getTests)
+			builds.GET("/:buildId/coverage", h.getCoverage)
+		}
+		pulls := api.Group("/repositories/:repoId/pulls")
+		{
+			pulls.GET("/:number/builds", h.getBuildsByPullRequest)
+		}
+		schedules := api.Group("/repositories/:repoId/schedules")
+		{
+			schedules.POST("", h.addSchedule)
+			schedules.GET("", h.getSchedulesByRepoId)
+			schedules.GET("/:scheduleId", h.getScheduleById)
+			schedules.PUT("/:scheduleId", h.updateSchedule)
+			schedules.DELETE("/:scheduleId", h.removeSchedule)
+		}
+		notifications := api.Group("/repositories/:repoId/notifications")
+		{
+			notifications.POST("", h.addNotificationTarget)
+			notifications.GET("", h.getNotificationTargetsByRepoId)
+			notifications.DELETE("/:targetId", h.removeNotificationTarget)
+			notifications.GET("/:targetId/deliveries", h.getDeliveries)
+		}
+		watchers := api.Group("/repositories/:repoId/watchers")
+		{
+			watchers.POST("", h.addWatcher)
+			watchers.GET("", h.getWatchersByRepoId)
+			watchers.DELETE("/:email", h.removeWatcher)
 		}
 		logs := api.Group("/logs")
 		{
 			logs.GET("/:buildId", h.getLogById)
 		}
+		api.POST("/janitor/run", h.runJanitor)
 	}
 
 	return router
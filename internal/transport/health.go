@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// healthz reports that the process is alive.
+func (h Handler) healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
+
+// readyz runs the readiness checks and reports the result of each one.
+func (h Handler) readyz(c echo.Context) error {
+	results, ok := h.health.Check(c.Request().Context())
+
+	var checks = make(map[string]string, len(results))
+	for name, err := range results {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = err.Error()
+		}
+	}
+
+	if !ok {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"status": "unavailable", "checks": checks})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "checks": checks})
+}
@@ -0,0 +1,10 @@
+package transport
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h Handler) runJanitor(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.janitor.Run(c.Request().Context()))
+}
@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"net/http"
+)
+
+func (h Handler) addNotificationTarget(c echo.Context) error {
+	var form struct {
+		RepoId string                     `param:"repoId"`
+		URL    string                     `json:"url" validate:"required,url"`
+		Secret string                     `json:"secret" validate:"required"`
+		Events []domain.NotificationEvent `json:"events" validate:"min=1,dive,oneof=started succeeded failed fixed broken"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.repositoriesStorage.GetById(form.RepoId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var id = xid.New().String()
+
+	err = h.notificationsStorage.CreateTarget(domain.NotificationTarget{
+		Id:     id,
+		RepoId: form.RepoId,
+		URL:    form.URL,
+		Secret: form.Secret,
+		Events: form.Events,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	target, err := h.notificationsStorage.GetTargetById(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, target)
+}
+
+func (h Handler) removeNotificationTarget(c echo.Context) error {
+	target, err := h.getNotificationTarget(c.Param("repoId"), c.Param("targetId"))
+	if err != nil {
+		return err
+	}
+
+	err = h.notificationsStorage.DeleteTarget(target.Id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h Handler) getNotificationTargetsByRepoId(c echo.Context) error {
+	targets, err := h.notificationsStorage.GetTargetsByRepoId(c.Param("repoId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"notifications": targets})
+}
+
+// getDeliveries returns the delivery history of the notification target, newest first.
+func (h Handler) getDeliveries(c echo.Context) error {
+	target, err := h.getNotificationTarget(c.Param("repoId"), c.Param("targetId"))
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := h.notificationsStorage.GetDeliveriesByTargetId(target.Id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"deliveries": deliveries})
+}
+
+// getNotificationTarget returns the notification target with the given id if it belongs to the repository.
+func (h Handler) getNotificationTarget(repoId, targetId string) (domain.NotificationTarget, error) {
+	target, err := h.notificationsStorage.GetTargetById(targetId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.NotificationTarget{}, echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return domain.NotificationTarget{}, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if target.RepoId != repoId {
+		return domain.NotificationTarget{}, echo.NewHTTPError(http.StatusNotFound, domain.ErrNotFound)
+	}
+
+	return target, nil
+}
@@ -4,15 +4,24 @@ import (
 	"errors"
 	"github.com/KirillMironov/ci/internal/domain"
 	"github.com/KirillMironov/ci/pkg/duration"
+	"github.com/KirillMironov/ci/pkg/pattern"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
 
 func (h Handler) addRepository(c echo.Context) error {
 	var form struct {
+		Name            string            `json:"name" validate:"max=255"`
 		URL             string            `json:"url" validate:"required"`
-		Branch          string            `json:"branch" validate:"required"`
+		Branches        pattern.List      `json:"branches" validate:"required,min=1,dive,required,glob"`
+		Tags            pattern.List      `json:"tags" validate:"dive,required,glob"`
+		PullRequests    bool              `json:"pull_requests"`
+		WebhookSecret   string            `json:"webhook_secret"`
+		StatusProvider  string            `json:"status_provider" validate:"omitempty,oneof=github gitlab gitea"`
+		StatusURL       string            `json:"status_url" validate:"required_with=StatusProvider,omitempty,url"`
+		StatusToken     string            `json:"status_token" validate:"required_with=StatusProvider"`
 		PollingInterval duration.Duration `json:"polling_interval" validate:"required"`
+		Retention       retentionForm     `json:"retention"`
 	}
 
 	err := c.Bind(&form)
@@ -20,13 +29,99 @@ func (h Handler) addRepository(c echo.Context) error {
 		return err
 	}
 
-	h.scheduler.Add(domain.Repository{
+	repository, err := h.scheduler.Add(domain.Repository{
+		Name:            form.Name,
 		URL:             form.URL,
-		Branch:          form.Branch,
+		Branches:        form.Branches,
+		Tags:            form.Tags,
+		PullRequests:    form.PullRequests,
+		WebhookSecret:   form.WebhookSecret,
+		StatusProvider:  domain.StatusProvider(form.StatusProvider),
+		StatusURL:       form.StatusURL,
+		StatusToken:     form.StatusToken,
 		PollingInterval: form.PollingInterval,
+		Enabled:         true,
+		Retention:       domain.Retention(form.Retention),
 	})
+	if err != nil {
+		if errors.Is(err, domain.ErrAlreadyExists) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
 
-	return c.NoContent(http.StatusCreated)
+	return c.JSON(http.StatusCreated, repository)
+}
+
+// retentionForm is a domain.Retention with validated rules. Zero rules fall back to the global retention.
+type retentionForm struct {
+	KeepLast int `json:"keep_last" validate:"gte=0"`
+	KeepDays int `json:"keep_days" validate:"gte=0"`
+}
+
+func (h Handler) updateRepository(c echo.Context) error {
+	var form struct {
+		Name            *string            `json:"name" validate:"omitempty,max=255"`
+		Branches        *pattern.List      `json:"branches" validate:"omitempty,min=1,dive,required,glob"`
+		PollingInterval *duration.Duration `json:"polling_interval" validate:"omitempty,gt=0"`
+		Enabled         *bool              `json:"enabled"`
+		Retention       *retentionForm     `json:"retention"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	repository, err := h.scheduler.Update(c.Param("repoId"), func(repository *domain.Repository) {
+		if form.Name != nil {
+			repository.Name = *form.Name
+		}
+		if form.Branches != nil {
+			repository.Branches = *form.Branches
+		}
+		if form.PollingInterval != nil {
+			repository.PollingInterval = *form.PollingInterval
+		}
+		if form.Enabled != nil {
+			repository.Enabled = *form.Enabled
+		}
+		if form.Retention != nil {
+			repository.Retention = domain.Retention(*form.Retention)
+		}
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, repository)
+}
+
+func (h Handler) pauseRepository(c echo.Context) error {
+	err := h.scheduler.Pause(c.Param("repoId"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h Handler) resumeRepository(c echo.Context) error {
+	err := h.scheduler.Resume(c.Param("repoId"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
 }
 
 func (h Handler) removeRepository(c echo.Context) error {
@@ -39,13 +134,33 @@ func (h Handler) removeRepository(c echo.Context) error {
 		return err
 	}
 
-	h.scheduler.Remove(form.Id)
+	err = h.scheduler.Remove(form.Id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
 
 	return c.NoContent(http.StatusNoContent)
 }
 
 func (h Handler) getRepositories(c echo.Context) error {
-	repositories, err := h.repositoriesStorage.GetAll()
+	var form struct {
+		Unhealthy bool `query:"unhealthy"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	var repositories []domain.Repository
+	if form.Unhealthy {
+		repositories, err = h.repositoriesStorage.GetUnhealthy()
+	} else {
+		repositories, err = h.repositoriesStorage.GetAll()
+	}
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
 			return echo.NewHTTPError(http.StatusNotFound, err)
@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"net/http"
+)
+
+func (h Handler) addSchedule(c echo.Context) error {
+	var form struct {
+		RepoId     string `param:"repoId"`
+		Expression string `json:"expression" validate:"required,cron"`
+		Branch     string `json:"branch"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.repositoriesStorage.GetById(form.RepoId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var id = xid.New().String()
+
+	err = h.schedulesStorage.Create(domain.Schedule{
+		Id:         id,
+		RepoId:     form.RepoId,
+		Expression: form.Expression,
+		Branch:     form.Branch,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	schedule, err := h.schedulesStorage.GetById(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, schedule)
+}
+
+func (h Handler) updateSchedule(c echo.Context) error {
+	var form struct {
+		RepoId     string `param:"repoId"`
+		ScheduleId string `param:"scheduleId"`
+		Expression string `json:"expression" validate:"required,cron"`
+		Branch     string `json:"branch"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	schedule, err := h.getSchedule(form.RepoId, form.ScheduleId)
+	if err != nil {
+		return err
+	}
+
+	schedule.Expression = form.Expression
+	schedule.Branch = form.Branch
+
+	err = h.schedulesStorage.Update(schedule)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+func (h Handler) removeSchedule(c echo.Context) error {
+	schedule, err := h.getSchedule(c.Param("repoId"), c.Param("scheduleId"))
+	if err != nil {
+		return err
+	}
+
+	err = h.schedulesStorage.Delete(schedule.Id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h Handler) getSchedulesByRepoId(c echo.Context) error {
+	schedules, err := h.schedulesStorage.GetAllByRepoId(c.Param("repoId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"schedules": schedules})
+}
+
+func (h Handler) getScheduleById(c echo.Context) error {
+	schedule, err := h.getSchedule(c.Param("repoId"), c.Param("scheduleId"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// getSchedule returns the schedule with the given id if it belongs to the repository.
+func (h Handler) getSchedule(repoId, scheduleId string) (domain.Schedule, error) {
+	schedule, err := h.schedulesStorage.GetById(scheduleId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.Schedule{}, echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return domain.Schedule{}, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if schedule.RepoId != repoId {
+		return domain.Schedule{}, echo.NewHTTPError(http.StatusNotFound, domain.ErrNotFound)
+	}
+
+	return schedule, nil
+}
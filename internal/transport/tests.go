@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// flakyTestsBuilds is the number of the latest builds of a branch compared to find the flaky tests.
+const flakyTestsBuilds = 20
+
+func (h Handler) getTests(c echo.Context) error {
+	var form struct {
+		Status string `query:"status" validate:"omitempty,oneof=success failure skipped"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	build, err := h.findBuild(c)
+	if err != nil {
+		return err
+	}
+
+	tests, err := h.testsStorage.GetAllByBuildId(build.Id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var flaky = make(map[[3]string]bool)
+
+	if build.Commit.Branch != "" {
+		flakyTests, err := h.testsStorage.GetFlaky(build.RepoId, build.Commit.Branch, flakyTestsBuilds)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		for _, test := range flakyTests {
+			flaky[[3]string{test.Step, test.ClassName, test.Name}] = true
+		}
+	}
+
+	var filtered = make([]domain.TestCase, 0, len(tests))
+
+	for _, test := range tests {
+		if form.Status != "" && test.Status.String() != form.Status {
+			continue
+		}
+		test.Flaky = flaky[[3]string{test.Step, test.ClassName, test.Name}]
+		filtered = append(filtered, test)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"tests": filtered})
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h Handler) addWatcher(c echo.Context) error {
+	var form struct {
+		RepoId string `param:"repoId"`
+		Email  string `json:"email" validate:"required,email"`
+	}
+
+	err := c.Bind(&form)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.repositoriesStorage.GetById(form.RepoId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	err = h.watchersStorage.Create(domain.Watcher{RepoId: form.RepoId, Email: form.Email})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusCreated)
+}
+
+func (h Handler) removeWatcher(c echo.Context) error {
+	err := h.watchersStorage.Delete(c.Param("repoId"), c.Param("email"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h Handler) getWatchersByRepoId(c echo.Context) error {
+	watchers, err := h.watchersStorage.GetAllByRepoId(c.Param("repoId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"watchers": watchers})
+}
@@ -0,0 +1,192 @@
+package transport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var errInvalidSignature = errors.New("invalid webhook signature")
+
+// receiveWebhook handles GitHub, Gitea and GitLab webhooks.
+// Push events poll the repository immediately, pull and merge request events build the request head.
+func (h Handler) receiveWebhook(c echo.Context) error {
+	repo, err := h.repositoriesStorage.GetById(c.Param("repoId"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if !verifyWebhook(c.Request().Header, body, repo.WebhookSecret) {
+		return echo.NewHTTPError(http.StatusUnauthorized, errInvalidSignature)
+	}
+
+	event, err := parseWebhook(c.Request().Header, body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	switch {
+	case event.push:
+		h.scheduler.Trigger(repo)
+	case event.pullRequest != nil && repo.PullRequests:
+		h.scheduler.Trigger(repo, *event.pullRequest)
+	default:
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// webhookEvent is a webhook event that triggers a build.
+type webhookEvent struct {
+	push        bool
+	pullRequest *domain.Commit
+}
+
+// verifyWebhook checks the webhook signature (GitHub, Gitea) or token (GitLab) against the repository secret.
+// Webhooks are rejected if the secret is not configured.
+func verifyWebhook(header http.Header, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+
+	var signature = strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	if signature == "" {
+		signature = header.Get("X-Gitea-Signature")
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func parseWebhook(header http.Header, body []byte) (webhookEvent, error) {
+	switch {
+	case header.Get("X-Gitea-Event") != "":
+		return parseGitHubWebhook(header.Get("X-Gitea-Event"), body)
+	case header.Get("X-GitHub-Event") != "":
+		return parseGitHubWebhook(header.Get("X-GitHub-Event"), body)
+	case header.Get("X-Gitlab-Event") != "":
+		return parseGitLabWebhook(header.Get("X-Gitlab-Event"), body)
+	default:
+		return webhookEvent{}, errors.New("unknown webhook provider")
+	}
+}
+
+// parseGitHubWebhook parses GitHub and Gitea webhooks, which share the payload format.
+func parseGitHubWebhook(event string, body []byte) (webhookEvent, error) {
+	switch event {
+	case "push":
+		return webhookEvent{push: true}, nil
+	case "pull_request":
+		var payload struct {
+			Action      string `json:"action"`
+			PullRequest struct {
+				Number int `json:"number"`
+				Head   struct {
+					Ref string `json:"ref"`
+					SHA string `json:"sha"`
+				} `json:"head"`
+				Base struct {
+					Ref string `json:"ref"`
+				} `json:"base"`
+			} `json:"pull_request"`
+		}
+
+		err := json.Unmarshal(body, &payload)
+		if err != nil {
+			return webhookEvent{}, err
+		}
+
+		switch payload.Action {
+		case "opened", "reopened", "synchronize", "synchronized":
+		default:
+			return webhookEvent{}, nil
+		}
+
+		var pr = payload.PullRequest
+
+		return webhookEvent{pullRequest: &domain.Commit{
+			Hash: pr.Head.SHA,
+			PullRequest: &domain.PullRequest{
+				Number:       pr.Number,
+				Ref:          fmt.Sprintf("refs/pull/%d/head", pr.Number),
+				SourceBranch: pr.Head.Ref,
+				TargetBranch: pr.Base.Ref,
+			},
+		}}, nil
+	default:
+		return webhookEvent{}, nil
+	}
+}
+
+func parseGitLabWebhook(event string, body []byte) (webhookEvent, error) {
+	switch event {
+	case "Push Hook", "Tag Push Hook":
+		return webhookEvent{push: true}, nil
+	case "Merge Request Hook":
+		var payload struct {
+			ObjectAttributes struct {
+				IId          int    `json:"iid"`
+				Action       string `json:"action"`
+				SourceBranch string `json:"source_branch"`
+				TargetBranch string `json:"target_branch"`
+				LastCommit   struct {
+					Id string `json:"id"`
+				} `json:"last_commit"`
+			} `json:"object_attributes"`
+		}
+
+		err := json.Unmarshal(body, &payload)
+		if err != nil {
+			return webhookEvent{}, err
+		}
+
+		var mr = payload.ObjectAttributes
+
+		switch mr.Action {
+		case "open", "reopen", "update":
+		default:
+			return webhookEvent{}, nil
+		}
+
+		return webhookEvent{pullRequest: &domain.Commit{
+			Hash: mr.LastCommit.Id,
+			PullRequest: &domain.PullRequest{
+				Number:       mr.IId,
+				Ref:          fmt.Sprintf("refs/merge-requests/%d/head", mr.IId),
+				SourceBranch: mr.SourceBranch,
+				TargetBranch: mr.TargetBranch,
+			},
+		}}, nil
+	default:
+		return webhookEvent{}, nil
+	}
+}
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	var (
+		secret = "secret"
+		body   = []byte(`{}`)
+		mac    = hmac.New(sha256.New, []byte(secret))
+	)
+	mac.Write(body)
+	var signature = hex.EncodeToString(mac.Sum(nil))
+
+	tests := map[string]struct {
+		header   http.Header
+		secret   string
+		expected bool
+	}{
+		"github": {
+			header:   http.Header{"X-Hub-Signature-256": {"sha256=" + signature}},
+			secret:   secret,
+			expected: true,
+		},
+		"gitea": {
+			header:   http.Header{"X-Gitea-Signature": {signature}},
+			secret:   secret,
+			expected: true,
+		},
+		"gitlab": {
+			header:   http.Header{"X-Gitlab-Token": {secret}},
+			secret:   secret,
+			expected: true,
+		},
+		"invalid signature": {
+			header:   http.Header{"X-Hub-Signature-256": {"sha256=00"}},
+			secret:   secret,
+			expected: false,
+		},
+		"invalid token": {
+			header:   http.Header{"X-Gitlab-Token": {"-"}},
+			secret:   secret,
+			expected: false,
+		},
+		"missing signature": {
+			header:   http.Header{},
+			secret:   secret,
+			expected: false,
+		},
+		"secret not configured": {
+			header:   http.Header{"X-Gitlab-Token": {""}},
+			secret:   "",
+			expected: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, verifyWebhook(tc.header, body, tc.secret))
+		})
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	tests := map[string]struct {
+		header   http.Header
+		body     string
+		expected webhookEvent
+	}{
+		"github push": {
+			header:   http.Header{"X-Github-Event": {"push"}},
+			body:     `{}`,
+			expected: webhookEvent{push: true},
+		},
+		"github pull request": {
+			header: http.Header{"X-Github-Event": {"pull_request"}},
+			body: `{"action": "synchronize", "pull_request": {"number": 7,
+				"head": {"ref": "feature", "sha": "abc"}, "base": {"ref": "main"}}}`,
+			expected: webhookEvent{pullRequest: &domain.Commit{
+				Hash: "abc",
+				PullRequest: &domain.PullRequest{Number: 7, Ref: "refs/pull/7/head", SourceBranch: "feature",
+					TargetBranch: "main"},
+			}},
+		},
+		"github closed pull request": {
+			header:   http.Header{"X-Github-Event": {"pull_request"}},
+			body:     `{"action": "closed", "pull_request": {"number": 7}}`,
+			expected: webhookEvent{},
+		},
+		"gitea pull request": {
+			header: http.Header{"X-Gitea-Event": {"pull_request"}},
+			body: `{"action": "opened", "pull_request": {"number": 3,
+				"head": {"ref": "feature", "sha": "abc"}, "base": {"ref": "main"}}}`,
+			expected: webhookEvent{pullRequest: &domain.Commit{
+				Hash: "abc",
+				PullRequest: &domain.PullRequest{Number: 3, Ref: "refs/pull/3/head", SourceBranch: "feature",
+					TargetBranch: "main"},
+			}},
+		},
+		"gitlab merge request": {
+			header: http.Header{"X-Gitlab-Event": {"Merge Request Hook"}},
+			body: `{"object_attributes": {"iid": 5, "action": "update", "source_branch": "feature",
+				"target_branch": "main", "last_commit": {"id": "abc"}}}`,
+			expected: webhookEvent{pullRequest: &domain.Commit{
+				Hash: "abc",
+				PullRequest: &domain.PullRequest{Number: 5, Ref: "refs/merge-requests/5/head", SourceBranch: "feature",
+					TargetBranch: "main"},
+			}},
+		},
+		"gitlab tag push": {
+			header:   http.Header{"X-Gitlab-Event": {"Tag Push Hook"}},
+			body:     `{}`,
+			expected: webhookEvent{push: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			event, err := parseWebhook(tc.header, []byte(tc.body))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, event)
+		})
+	}
+
+	_, err := parseWebhook(http.Header{}, []byte(`{}`))
+	assert.Error(t, err)
+}
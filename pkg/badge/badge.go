@@ -0,0 +1,87 @@
+// Package badge renders shields-style SVG badges.
+package badge
+
+import (
+	"bytes"
+	"html/template"
+)
+
+// Badge colors.
+const (
+	Green  = "#4c1"
+	Yellow = "#dfb317"
+	Red    = "#e05d44"
+	Grey   = "#9f9f9f"
+)
+
+const (
+	height = 20
+	// padding on both sides of a text.
+	padding = 6
+)
+
+var svg = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" ` +
+	`width="{{.Width}}" height="20" role="img" aria-label="{{.Label}}: {{.Message}}">` +
+	`<title>{{.Label}}: {{.Message}}</title>` +
+	`<linearGradient id="s" x2="0" y2="100%">` +
+	`<stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/>` +
+	`</linearGradient>` +
+	`<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)">` +
+	`<rect width="{{.LabelWidth}}" height="20" fill="#555"/>` +
+	`<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/>` +
+	`<rect width="{{.Width}}" height="20" fill="url(#s)"/>` +
+	`</g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{.Label}}</text>` +
+	`<text x="{{.LabelX}}" y="14">{{.Label}}</text>` +
+	`<text x="{{.MessageX}}" y="15" fill="#010101" fill-opacity=".3">{{.Message}}</text>` +
+	`<text x="{{.MessageX}}" y="14">{{.Message}}</text>` +
+	`</g></svg>`))
+
+// Render returns the SVG of a badge with the label on the left and the message on the right, on the background
+// of the given color.
+func Render(label, message, color string) []byte {
+	var (
+		labelWidth   = textWidth(label) + padding*2
+		messageWidth = textWidth(message) + padding*2
+		buf          bytes.Buffer
+	)
+
+	// The template is parsed and the texts are escaped, so executing it into a buffer cannot fail.
+	_ = svg.Execute(&buf, struct {
+		Label, Message, Color           string
+		Width, LabelWidth, MessageWidth int
+		LabelX, MessageX                float64
+	}{
+		Label:        label,
+		Message:      message,
+		Color:        color,
+		Width:        labelWidth + messageWidth,
+		LabelWidth:   labelWidth,
+		MessageWidth: messageWidth,
+		LabelX:       float64(labelWidth) / 2,
+		MessageX:     float64(labelWidth) + float64(messageWidth)/2,
+	})
+
+	return buf.Bytes()
+}
+
+// textWidth approximates the width of the text in pixels in 11px Verdana.
+func textWidth(text string) (width int) {
+	for _, r := range text {
+		switch {
+		case r == ' ':
+			width += 4
+		case r == 'i' || r == 'l' || r == 'I' || r == 'j' || r == '.' || r == ',' || r == ':' || r == '|':
+			width += 3
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W' || r == '%':
+			width += 10
+		case r >= 'A' && r <= 'Z':
+			width += 8
+		default:
+			width += 7
+		}
+	}
+	return width
+}
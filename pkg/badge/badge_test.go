@@ -0,0 +1,32 @@
+package badge
+
+import (
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := map[string]struct {
+		label, message string
+	}{
+		"status":   {label: "build", message: "passing"},
+		"coverage": {label: "coverage", message: "87.5%"},
+		"escaped":  {label: `<script>&"`, message: "unknown"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var svg struct {
+				Width int    `xml:"width,attr"`
+				Title string `xml:"title"`
+			}
+
+			err := xml.Unmarshal(Render(tc.label, tc.message, Green), &svg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.label+": "+tc.message, svg.Title)
+			assert.Equal(t, textWidth(tc.label)+textWidth(tc.message)+padding*4, svg.Width)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package cas stores files on disk under the SHA-256 checksum of their content.
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInvalidChecksum is returned if a checksum is not a hex-encoded SHA-256.
+var ErrInvalidChecksum = errors.New("invalid checksum")
+
+// tmpDir is the directory of the store where files are written before they are moved under their checksum.
+const tmpDir = "tmp"
+
+// Store keeps every file at <dir>/<first two checksum characters>/<checksum>, so equal files are stored once.
+type Store struct {
+	dir string
+}
+
+// Blob is a stored file.
+type Blob struct {
+	Checksum string
+	// ModTime is the time the file was last put.
+	ModTime time.Time
+}
+
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Put stores the content and returns its checksum and size.
+func (s Store) Put(r io.Reader) (checksum string, size int64, err error) {
+	err = os.MkdirAll(filepath.Join(s.dir, tmpDir), 0o755)
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, tmpDir), "blob-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var hash = sha256.New()
+
+	size, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return "", 0, err
+	}
+
+	checksum = hex.EncodeToString(hash.Sum(nil))
+
+	var path = s.path(checksum)
+
+	// The existing file is touched, so it is not taken for an unused one.
+	var now = time.Now()
+	if err = os.Chtimes(path, now, now); err == nil {
+		return checksum, size, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return checksum, size, os.Rename(tmp.Name(), path)
+}
+
+// Open opens the file with the checksum.
+func (s Store) Open(checksum string) (*os.File, error) {
+	if !valid(checksum) {
+		return nil, ErrInvalidChecksum
+	}
+	return os.Open(s.path(checksum))
+}
+
+// Remove removes the file with the checksum.
+func (s Store) Remove(checksum string) error {
+	if !valid(checksum) {
+		return ErrInvalidChecksum
+	}
+	return os.Remove(s.path(checksum))
+}
+
+// List returns every stored file.
+func (s Store) List() (blobs []Blob, err error) {
+	err = filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && path == s.dir:
+			return fs.SkipDir
+		case err != nil:
+			return err
+		case entry.IsDir() && entry.Name() == tmpDir && filepath.Dir(path) == filepath.Clean(s.dir):
+			return fs.SkipDir
+		case entry.IsDir() || !valid(entry.Name()):
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		blobs = append(blobs, Blob{Checksum: entry.Name(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", s.dir, err)
+	}
+
+	return blobs, nil
+}
+
+func (s Store) path(checksum string) string {
+	return filepath.Join(s.dir, checksum[:2], checksum)
+}
+
+func valid(checksum string) bool {
+	if len(checksum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(checksum)
+	return err == nil
+}
@@ -0,0 +1,57 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	var (
+		store    = New(t.TempDir())
+		sum      = sha256.Sum256([]byte("content"))
+		expected = hex.EncodeToString(sum[:])
+	)
+
+	blobs, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+
+	for i := 0; i < 2; i++ {
+		checksum, size, err := store.Put(strings.NewReader("content"))
+		require.NoError(t, err)
+		assert.Equal(t, expected, checksum)
+		assert.Equal(t, int64(7), size)
+	}
+
+	blobs, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, blobs, 1, "equal files are stored once")
+	assert.Equal(t, expected, blobs[0].Checksum)
+
+	file, err := store.Open(expected)
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Equal(t, "content", string(content))
+
+	_, err = store.Open("../" + expected[3:])
+	assert.ErrorIs(t, err, ErrInvalidChecksum)
+
+	require.NoError(t, store.Remove(expected))
+
+	blobs, err = store.List()
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+}
+
+func TestStore_List_MissingDir(t *testing.T) {
+	blobs, err := New(t.TempDir() + "/missing").List()
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+}
@@ -0,0 +1,160 @@
+// Package coverage parses Go cover profiles and Cobertura XML reports.
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Package is the coverage of a package: the statements of a Go package or the lines of a Cobertura package.
+type Package struct {
+	Name    string
+	Covered int64
+	Total   int64
+}
+
+type (
+	cobertura struct {
+		Packages []struct {
+			Name    string `xml:"name,attr"`
+			Classes []struct {
+				Filename string `xml:"filename,attr"`
+				Lines    []struct {
+					Number int   `xml:"number,attr"`
+					Hits   int64 `xml:"hits,attr"`
+				} `xml:"lines>line"`
+			} `xml:"classes>class"`
+		} `xml:"packages>package"`
+	}
+	// counts are the units of the packages, keyed by a block of a Go profile or a line of a Cobertura report.
+	counts map[string]map[string]unit
+	unit   struct {
+		// Statements of a block, 1 for a line.
+		statements int64
+		covered    bool
+	}
+)
+
+// Parse returns the packages of the Go cover profile or of the Cobertura XML report, sorted by name.
+func Parse(r io.Reader) ([]Package, error) {
+	var reader = bufio.NewReader(r)
+
+	start, err := reader.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimLeft(start, "\ufeff \t\r\n"), []byte("<")) {
+		return parseCobertura(reader)
+	}
+	return parseProfile(reader)
+}
+
+// parseProfile parses the Go cover profile. A block repeated in a merged profile is counted once.
+func parseProfile(r io.Reader) ([]Package, error) {
+	var (
+		scanner = bufio.NewScanner(r)
+		pkgs    = make(counts)
+	)
+
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "mode:") {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid cover profile: missing mode line")
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		// name.go:line.column,line.column numberOfStatements count
+		fields := strings.Fields(text)
+		file, _, ok := strings.Cut(text, ":")
+		if len(fields) != 3 || !ok {
+			return nil, fmt.Errorf("invalid cover profile line %d: %q", line, text)
+		}
+
+		statements, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cover profile line %d: %w", line, err)
+		}
+		count, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cover profile line %d: %w", line, err)
+		}
+
+		pkgs.add(path.Dir(file), fields[0], unit{statements: statements, covered: count > 0})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return pkgs.packages(), nil
+}
+
+// parseCobertura parses the Cobertura XML report. The classes without a package name belong to their directories.
+func parseCobertura(r io.Reader) ([]Package, error) {
+	var report cobertura
+
+	err := xml.NewDecoder(r).Decode(&report)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs = make(counts)
+
+	for _, pkg := range report.Packages {
+		for _, class := range pkg.Classes {
+			var name = pkg.Name
+			if name == "" {
+				name = path.Dir(class.Filename)
+			}
+			for _, line := range class.Lines {
+				pkgs.add(name, class.Filename+":"+strconv.Itoa(line.Number), unit{statements: 1, covered: line.Hits > 0})
+			}
+		}
+	}
+
+	return pkgs.packages(), nil
+}
+
+// add counts the block or the line of the package, which is covered if it is covered anywhere.
+func (c counts) add(pkg, key string, u unit) {
+	if c[pkg] == nil {
+		c[pkg] = make(map[string]unit)
+	}
+	u.covered = u.covered || c[pkg][key].covered
+	c[pkg][key] = u
+}
+
+func (c counts) packages() []Package {
+	var pkgs = make([]Package, 0, len(c))
+
+	for name, units := range c {
+		var pkg = Package{Name: name}
+		for _, u := range units {
+			pkg.Total += u.statements
+			if u.covered {
+				pkg.Covered += u.statements
+			}
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+
+	return pkgs
+}
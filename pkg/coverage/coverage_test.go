@@ -0,0 +1,80 @@
+package coverage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		report           string
+		expectedPackages []Package
+		expectError      bool
+	}{
+		"go profile": {
+			report: `mode: set
+example.com/app/a.go:3.14,5.2 2 1
+example.com/app/a.go:7.14,9.2 3 0
+example.com/app/b.go:3.14,5.2 1 0
+example.com/app/internal/c.go:3.14,5.2 4 1
+example.com/app/a.go:7.14,9.2 3 1
+`,
+			expectedPackages: []Package{
+				{Name: "example.com/app", Covered: 5, Total: 6},
+				{Name: "example.com/app/internal", Covered: 4, Total: 4},
+			},
+		},
+		"cobertura": {
+			report: `<?xml version="1.0" ?>
+<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">
+<coverage line-rate="0.5">
+	<packages>
+		<package name="app">
+			<classes>
+				<class filename="app/main.py">
+					<lines>
+						<line number="1" hits="1"/>
+						<line number="2" hits="0"/>
+					</lines>
+				</class>
+				<class filename="app/util.py">
+					<lines><line number="1" hits="3"/></lines>
+				</class>
+			</classes>
+		</package>
+		<package name="">
+			<classes>
+				<class filename="lib/io.py"><lines><line number="1" hits="0"/></lines></class>
+			</classes>
+		</package>
+	</packages>
+</coverage>`,
+			expectedPackages: []Package{
+				{Name: "app", Covered: 2, Total: 3},
+				{Name: "lib", Covered: 0, Total: 1},
+			},
+		},
+		"missing mode": {
+			report:      "example.com/app/a.go:3.14,5.2 2 1\n",
+			expectError: true,
+		},
+		"invalid line": {
+			report:      "mode: count\nexample.com/app/a.go 2\n",
+			expectError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			pkgs, err := Parse(strings.NewReader(tc.report))
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPackages, pkgs)
+		})
+	}
+}
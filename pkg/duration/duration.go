@@ -27,13 +27,36 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+
+	err := unmarshal(&str)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
 func (d Duration) Value() (driver.Value, error) {
 	return d.Duration().String(), nil
 }
 
 func (d *Duration) Scan(src any) error {
-	str, ok := src.(string)
-	if !ok {
+	var str string
+
+	switch src := src.(type) {
+	case string:
+		str = src
+	case []byte:
+		str = string(src)
+	default:
 		return errors.New("incompatible source type")
 	}
 
@@ -3,6 +3,7 @@ package duration
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 	"testing"
 	"time"
 )
@@ -17,3 +18,31 @@ func TestDuration(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, Duration(time.Minute+time.Second*15), duration)
 }
+
+func TestDuration_UnmarshalYAML(t *testing.T) {
+	var duration Duration
+	err := yaml.Unmarshal([]byte("1m15s"), &duration)
+	assert.NoError(t, err)
+	assert.Equal(t, Duration(time.Minute+time.Second*15), duration)
+
+	err = yaml.Unmarshal([]byte("-"), &duration)
+	assert.Error(t, err)
+}
+
+func TestDuration_ValueScan(t *testing.T) {
+	var duration = Duration(time.Minute + time.Second*15)
+
+	value, err := duration.Value()
+	assert.NoError(t, err)
+
+	for _, src := range []any{value, []byte(value.(string))} {
+		var scanned Duration
+		err = scanned.Scan(src)
+		assert.NoError(t, err)
+		assert.Equal(t, duration, scanned)
+	}
+
+	var scanned Duration
+	err = scanned.Scan(1)
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package echox
 
 import (
 	"github.com/labstack/echo/v4"
+	"net/http"
 )
 
 type Binder struct{}
@@ -14,5 +15,10 @@ func (Binder) Bind(i interface{}, c echo.Context) error {
 		return err
 	}
 
-	return c.Validate(i)
+	err = c.Validate(i)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return nil
 }
@@ -1,15 +1,34 @@
 package echox
 
-import "github.com/go-playground/validator/v10"
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/robfig/cron/v3"
+	"path"
+)
 
 type Validator struct {
 	validator *validator.Validate
 }
 
 func NewValidator() *Validator {
-	return &Validator{validator: validator.New()}
+	v := validator.New()
+	_ = v.RegisterValidation("cron", validateCron)
+	_ = v.RegisterValidation("glob", validateGlob)
+	return &Validator{validator: v}
 }
 
 func (v *Validator) Validate(i interface{}) error {
 	return v.validator.Struct(i)
 }
+
+// validateCron checks that the field is a standard cron expression.
+func validateCron(fl validator.FieldLevel) bool {
+	_, err := cron.ParseStandard(fl.Field().String())
+	return err == nil
+}
+
+// validateGlob checks that the field is a well-formed glob pattern, as accepted by path.Match.
+func validateGlob(fl validator.FieldLevel) bool {
+	_, err := path.Match(fl.Field().String(), "")
+	return err == nil
+}
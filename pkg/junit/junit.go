@@ -0,0 +1,101 @@
+// Package junit parses JUnit XML test reports.
+package junit
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Passed Result = iota
+	Failed
+	Skipped
+)
+
+// Result of a test case. Errored test cases are Failed.
+type Result uint8
+
+// Case is a test case of a report.
+type Case struct {
+	ClassName string
+	Name      string
+	Time      time.Duration
+	Result    Result
+	// Message of the failure or of the skip.
+	Message string
+}
+
+type (
+	suite struct {
+		Suites []suite    `xml:"testsuite"`
+		Cases  []testCase `xml:"testcase"`
+	}
+	testCase struct {
+		ClassName string   `xml:"classname,attr"`
+		Name      string   `xml:"name,attr"`
+		Time      string   `xml:"time,attr"`
+		Failure   *message `xml:"failure"`
+		Error     *message `xml:"error"`
+		Skipped   *message `xml:"skipped"`
+	}
+	message struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// Parse returns the test cases of all test suites of the report, either a <testsuites> or a <testsuite> document.
+func Parse(r io.Reader) ([]Case, error) {
+	var root suite
+
+	err := xml.NewDecoder(r).Decode(&root)
+	if err != nil {
+		return nil, err
+	}
+
+	return root.cases(nil), nil
+}
+
+// cases appends the test cases of the suite and of its nested suites.
+func (s suite) cases(cases []Case) []Case {
+	for _, tc := range s.Cases {
+		var c = Case{ClassName: tc.ClassName, Name: tc.Name, Time: parseTime(tc.Time)}
+
+		switch {
+		case tc.Failure != nil:
+			c.Result, c.Message = Failed, tc.Failure.String()
+		case tc.Error != nil:
+			c.Result, c.Message = Failed, tc.Error.String()
+		case tc.Skipped != nil:
+			c.Result, c.Message = Skipped, tc.Skipped.String()
+		}
+
+		cases = append(cases, c)
+	}
+
+	for _, nested := range s.Suites {
+		cases = nested.cases(cases)
+	}
+
+	return cases
+}
+
+// String returns the message attribute, falling back to the element text.
+func (m message) String() string {
+	if m.Message != "" {
+		return m.Message
+	}
+	return strings.TrimSpace(m.Text)
+}
+
+// parseTime parses the time in seconds, which some tools write with thousands separators.
+func parseTime(s string) time.Duration {
+	seconds, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
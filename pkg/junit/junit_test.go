@@ -0,0 +1,75 @@
+package junit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		report        string
+		expectedCases []Case
+		expectError   bool
+	}{
+		"test suites": {
+			report: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite name="pkg" tests="3">
+		<testcase classname="pkg" name="TestOk" time="0.5"></testcase>
+		<testcase classname="pkg" name="TestFail" time="1,200.25">
+			<failure message="Failed" type="">expected 1, got 2</failure>
+		</testcase>
+		<testcase classname="pkg" name="TestSkip" time="0">
+			<skipped message="skipped in short mode"></skipped>
+		</testcase>
+	</testsuite>
+	<testsuite name="other">
+		<testcase classname="other" name="TestPanic">
+			<error>
+				panic: nil map
+			</error>
+		</testcase>
+	</testsuite>
+</testsuites>`,
+			expectedCases: []Case{
+				{ClassName: "pkg", Name: "TestOk", Time: time.Millisecond * 500, Result: Passed},
+				{ClassName: "pkg", Name: "TestFail", Time: time.Millisecond * 1200250, Result: Failed, Message: "Failed"},
+				{ClassName: "pkg", Name: "TestSkip", Result: Skipped, Message: "skipped in short mode"},
+				{ClassName: "other", Name: "TestPanic", Result: Failed, Message: "panic: nil map"},
+			},
+		},
+		"nested test suite": {
+			report: `<testsuite name="root">
+	<testcase classname="root" name="a"/>
+	<testsuite name="nested"><testcase classname="nested" name="b"/></testsuite>
+</testsuite>`,
+			expectedCases: []Case{
+				{ClassName: "root", Name: "a"},
+				{ClassName: "nested", Name: "b"},
+			},
+		},
+		"empty": {
+			report:        `<testsuites/>`,
+			expectedCases: nil,
+		},
+		"not xml": {
+			report:      `ok  	pkg	0.1s`,
+			expectError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cases, err := Parse(strings.NewReader(tc.report))
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCases, cases)
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// Package migrate applies numbered SQL migrations to a database and records them in the schema_migrations table.
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoMigration is returned by Down if no migration is applied.
+var ErrNoMigration = errors.New("no migration to revert")
+
+// Migration is a numbered schema change with the statements applying and reverting it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration with the time it was applied. AppliedAt is zero if the migration is pending.
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Load reads the migrations from the files named <version>_<name>.up.sql and <version>_<name>.down.sql
+// in the root of fsys. The migrations are sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var byVersion = make(map[int]*Migration)
+
+	for _, file := range files {
+		var base = path.Base(file)
+
+		name, direction, ok := cutDirection(base)
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", base)
+		}
+
+		versionStr, name, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name> prefix", base)
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", base, err)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %s: version %d is already named %s", base, version, migration.Name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	var migrations = make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up migration", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// cutDirection splits the file name into the migration name and its direction.
+func cutDirection(file string) (name, direction string, ok bool) {
+	for _, direction = range []string{"up", "down"} {
+		var suffix = "." + direction + ".sql"
+		if strings.HasSuffix(file, suffix) {
+			return strings.TrimSuffix(file, suffix), direction, true
+		}
+	}
+	return "", "", false
+}
+
+// Migrator applies and reverts migrations. Every migration runs in its own transaction.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Status returns every known migration along with the time it was applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses = make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{Migration: migration, AppliedAt: applied[migration.Version]})
+	}
+
+	return statuses, nil
+}
+
+// Up applies the pending migrations in order and returns them.
+func (m *Migrator) Up() (migrated []Migration, err error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err = m.run(migration.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			migration.Version, migration.Name, time.Now())
+		if err != nil {
+			return migrated, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		migrated = append(migrated, migration)
+	}
+
+	return migrated, nil
+}
+
+// Down reverts the latest applied migration and returns it.
+func (m *Migrator) Down() (Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return Migration{}, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		var migration = m.migrations[i]
+
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if migration.Down == "" {
+			return Migration{}, fmt.Errorf("migration %d_%s: missing down migration", migration.Version,
+				migration.Name)
+		}
+
+		err = m.run(migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		if err != nil {
+			return Migration{}, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		return migration, nil
+	}
+
+	return Migration{}, ErrNoMigration
+}
+
+// run executes the statements and the bookkeeping query in a transaction.
+func (m *Migrator) run(statements, query string, args ...any) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(statements)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applied returns the application time of every applied migration by version.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	var query = `CREATE TABLE IF NOT EXISTS schema_migrations
+	(
+		version INTEGER,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL,
+		CONSTRAINT schema_migrations_pk PRIMARY KEY (version)
+	)`
+
+	_, err := m.db.Exec(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied = make(map[int]time.Time)
+
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
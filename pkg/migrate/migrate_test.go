@@ -0,0 +1,131 @@
+package migrate
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	tests := map[string]struct {
+		fsys          fstest.MapFS
+		expected      []Migration
+		expectedError bool
+	}{
+		"sorted by version": {
+			fsys: fstest.MapFS{
+				"0010_b.up.sql":   {Data: []byte("b up")},
+				"0002_a.up.sql":   {Data: []byte("a up")},
+				"0002_a.down.sql": {Data: []byte("a down")},
+			},
+			expected: []Migration{
+				{Version: 2, Name: "a", Up: "a up", Down: "a down"},
+				{Version: 10, Name: "b", Up: "b up"},
+			},
+		},
+		"missing up migration": {
+			fsys:          fstest.MapFS{"0001_a.down.sql": {}},
+			expectedError: true,
+		},
+		"invalid version": {
+			fsys:          fstest.MapFS{"first_a.up.sql": {}},
+			expectedError: true,
+		},
+		"conflicting names": {
+			fsys:          fstest.MapFS{"0001_a.up.sql": {}, "0001_b.down.sql": {}},
+			expectedError: true,
+		},
+		"unknown suffix": {
+			fsys:          fstest.MapFS{"0001_a.sql": {}},
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			migrations, err := Load(tc.fsys)
+			assert.Equal(t, tc.expectedError, err != nil)
+			if err == nil {
+				assert.Equal(t, tc.expected, migrations)
+			}
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var migrator = New(db, []Migration{
+		{Version: 1, Name: "a", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Version: 2, Name: "b", Up: "CREATE TABLE b (id INTEGER); INSERT INTO b VALUES (1)", Down: "DROP TABLE b"},
+	})
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].AppliedAt.IsZero())
+
+	migrated, err := migrator.Up()
+	require.NoError(t, err)
+	assert.Len(t, migrated, 2)
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM b").Scan(&count))
+	assert.Equal(t, 1, count)
+
+	migrated, err = migrator.Up()
+	require.NoError(t, err)
+	assert.Empty(t, migrated)
+
+	statuses, err = migrator.Status()
+	require.NoError(t, err)
+	assert.False(t, statuses[1].AppliedAt.IsZero())
+
+	reverted, err := migrator.Down()
+	require.NoError(t, err)
+	assert.Equal(t, 2, reverted.Version)
+
+	_, err = db.Exec("SELECT * FROM b")
+	assert.Error(t, err)
+
+	statuses, err = migrator.Status()
+	require.NoError(t, err)
+	assert.False(t, statuses[0].AppliedAt.IsZero())
+	assert.True(t, statuses[1].AppliedAt.IsZero())
+
+	_, err = migrator.Down()
+	require.NoError(t, err)
+
+	_, err = migrator.Down()
+	assert.ErrorIs(t, err, ErrNoMigration)
+}
+
+func TestMigrator_Up_Rollback(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var migrator = New(db, []Migration{
+		{Version: 1, Name: "a", Up: "CREATE TABLE a (id INTEGER)"},
+		{Version: 2, Name: "b", Up: "CREATE TABLE b (id INTEGER); INSERT INTO missing VALUES (1)"},
+	})
+
+	migrated, err := migrator.Up()
+	assert.Error(t, err)
+	assert.Len(t, migrated, 1)
+
+	_, err = db.Exec("SELECT * FROM b")
+	assert.Error(t, err, "the failed migration is rolled back")
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	assert.False(t, statuses[0].AppliedAt.IsZero())
+	assert.True(t, statuses[1].AppliedAt.IsZero())
+}
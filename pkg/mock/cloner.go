@@ -0,0 +1,79 @@
+package mock
+
+import (
+	"errors"
+	"github.com/KirillMironov/ci/internal/domain"
+	"github.com/KirillMironov/ci/pkg/cas"
+	"sync"
+)
+
+// Cloner lists Commits once Failures calls to GetLatestCommits have failed with Err.
+// CloneRepository always fails, so no build is run.
+type Cloner struct {
+	Commits  []domain.Commit
+	Failures int
+	Err      error
+	calls    int
+	cloned   []domain.Commit
+	mu       sync.Mutex
+}
+
+func (c *Cloner) GetLatestCommits(domain.Repository) ([]domain.Commit, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if c.calls <= c.Failures {
+		return nil, c.Err
+	}
+	return c.Commits, nil
+}
+
+func (c *Cloner) CloneRepository(_ domain.Repository, commit domain.Commit) (string, domain.Author, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cloned = append(c.cloned, commit)
+	return "", domain.Author{}, errors.New("not implemented")
+}
+
+// Cloned returns the commits passed to CloneRepository.
+func (c *Cloner) Cloned() []domain.Commit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]domain.Commit(nil), c.cloned...)
+}
+
+// Caches lists RepoIds as cloned and records the removed ones.
+type Caches struct {
+	RepoIds []string
+	Removed []string
+}
+
+func (c *Caches) Caches() ([]string, error) {
+	return c.RepoIds, nil
+}
+
+func (c *Caches) RemoveCache(repoId string) error {
+	c.Removed = append(c.Removed, repoId)
+	return nil
+}
+
+// Files lists Blobs as stored and records the removed ones.
+type Files struct {
+	Blobs   []cas.Blob
+	Removed []string
+}
+
+func (f *Files) List() ([]cas.Blob, error) {
+	return f.Blobs, nil
+}
+
+func (f *Files) Remove(checksum string) error {
+	for i, blob := range f.Blobs {
+		if blob.Checksum == checksum {
+			f.Blobs = append(f.Blobs[:i], f.Blobs[i+1:]...)
+			break
+		}
+	}
+	f.Removed = append(f.Removed, checksum)
+	return nil
+}
@@ -8,15 +8,56 @@ import (
 )
 
 type Executor struct {
-	HasError bool
-	Log      string
+	HasError  bool
+	Log       string
+	Artifacts []domain.Artifact
 }
 
-func (e Executor) ExecuteStep(context.Context, domain.Step, string) (io.ReadCloser, error) {
+func (e Executor) ExecuteStep(context.Context, domain.Step, string) (io.ReadCloser, []domain.Artifact, error) {
 	var logs = io.NopCloser(strings.NewReader(e.Log))
 
 	if e.HasError {
-		return logs, domain.ExitError{Code: 1}
+		return logs, e.Artifacts, domain.ExitError{Code: 1}
 	}
-	return logs, nil
+	return logs, e.Artifacts, nil
+}
+
+// FlakyExecutor fails with Err and FailureArtifacts the first Failures times it is called,
+// then succeeds with Artifacts.
+type FlakyExecutor struct {
+	Failures         int
+	Err              error
+	Log              string
+	FailureArtifacts []domain.Artifact
+	Artifacts        []domain.Artifact
+	calls            int
+}
+
+func (e *FlakyExecutor) ExecuteStep(context.Context, domain.Step, string) (io.ReadCloser, []domain.Artifact, error) {
+	e.calls++
+	if e.calls <= e.Failures {
+		return nil, e.FailureArtifacts, e.Err
+	}
+	return io.NopCloser(strings.NewReader(e.Log)), e.Artifacts, nil
+}
+
+// RecordingExecutor records the executed steps.
+type RecordingExecutor struct {
+	Steps []domain.Step
+}
+
+func (e *RecordingExecutor) ExecuteStep(_ context.Context, step domain.Step, _ string) (io.ReadCloser,
+	[]domain.Artifact, error) {
+	e.Steps = append(e.Steps, step)
+	return io.NopCloser(strings.NewReader("")), nil, nil
+}
+
+// Pruner reports Containers and Images as removed.
+type Pruner struct {
+	Containers []string
+	Images     []string
+}
+
+func (p Pruner) Prune(context.Context) ([]string, []string, uint64, error) {
+	return p.Containers, p.Images, uint64(len(p.Images)), nil
 }
@@ -0,0 +1,23 @@
+package mock
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"sync"
+)
+
+// Notifier records the notified events.
+type Notifier struct {
+	Events []domain.NotificationEvent
+	mu     sync.Mutex
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{}
+}
+
+func (n *Notifier) Notify(_ domain.Repository, _ domain.Build, events ...domain.NotificationEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Events = append(n.Events, events...)
+	return nil
+}
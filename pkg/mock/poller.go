@@ -3,8 +3,60 @@ package mock
 import (
 	"context"
 	"github.com/KirillMironov/ci/internal/domain"
+	"sync"
 )
 
 type Poller struct{}
 
 func (Poller) AddRepository(context.Context, domain.Repository) {}
+
+func (Poller) Trigger(context.Context, domain.Repository, domain.Trigger) {}
+
+func (Poller) TriggerCommit(context.Context, domain.Repository, domain.Commit) {}
+
+// RecordingPoller records the repositories added for polling and the triggered builds.
+type RecordingPoller struct {
+	Poller
+	polled    []Polling
+	triggered []Triggering
+	mu        sync.Mutex
+}
+
+// Polling is a repository added for polling until Ctx is done.
+type Polling struct {
+	Ctx  context.Context
+	Repo domain.Repository
+}
+
+// Triggering is a build of a repository triggered to run until Ctx is done.
+type Triggering struct {
+	Ctx     context.Context
+	Repo    domain.Repository
+	Trigger domain.Trigger
+}
+
+func (p *RecordingPoller) AddRepository(ctx context.Context, repo domain.Repository) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.polled = append(p.polled, Polling{Ctx: ctx, Repo: repo})
+}
+
+// Polled returns the repositories added for polling.
+func (p *RecordingPoller) Polled() []Polling {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Polling(nil), p.polled...)
+}
+
+func (p *RecordingPoller) Trigger(ctx context.Context, repo domain.Repository, trigger domain.Trigger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.triggered = append(p.triggered, Triggering{Ctx: ctx, Repo: repo, Trigger: trigger})
+}
+
+// Triggered returns the triggered builds.
+func (p *RecordingPoller) Triggered() []Triggering {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Triggering(nil), p.triggered...)
+}
@@ -0,0 +1,27 @@
+package mock
+
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"sync"
+)
+
+// Publisher records the published events.
+type Publisher struct {
+	events []domain.Event
+	mu     sync.Mutex
+}
+
+func (p *Publisher) Publish(event domain.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+}
+
+// Events returns the published events and forgets them.
+func (p *Publisher) Events() []domain.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	events := p.events
+	p.events = nil
+	return events
+}
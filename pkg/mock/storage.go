@@ -1,33 +1,86 @@
 package mock
 
-import "github.com/KirillMironov/ci/internal/domain"
+import (
+	"github.com/KirillMironov/ci/internal/domain"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
 type builds struct {
 	storage map[string]domain.Build
+	numbers map[string]int
+	mu      *sync.RWMutex
 }
 
 func NewBuilds() *builds {
 	return &builds{
 		storage: make(map[string]domain.Build),
+		numbers: make(map[string]int),
+		mu:      &sync.RWMutex{},
 	}
 }
 
-func (b builds) Create(build domain.Build) error {
+func (b builds) Create(build domain.Build) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.numbers[build.RepoId]++
+	build.Number = b.numbers[build.RepoId]
 	b.storage[build.Id] = build
-	return nil
+	return build.Number, nil
 }
 
 func (b builds) Update(build domain.Build) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.storage[build.Id] = build
 	return nil
 }
 
 func (b builds) Delete(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	delete(b.storage, id)
 	return nil
 }
 
+func (b builds) DeleteExpired(repoId string, keepLast int, before time.Time) (deleted int, _ error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var repoBuilds []domain.Build
+	for _, build := range b.storage {
+		if build.RepoId == repoId {
+			repoBuilds = append(repoBuilds, build)
+		}
+	}
+	sort.Slice(repoBuilds, func(i, j int) bool {
+		if repoBuilds[i].CreatedAt.Equal(repoBuilds[j].CreatedAt) {
+			return repoBuilds[i].Id > repoBuilds[j].Id
+		}
+		return repoBuilds[i].CreatedAt.After(repoBuilds[j].CreatedAt)
+	})
+
+	var successKept bool
+	for i, build := range repoBuilds {
+		var latestSuccess = build.Status == domain.Success && !successKept
+		if build.Status == domain.Success {
+			successKept = true
+		}
+		if i < keepLast || latestSuccess || build.Status == domain.InProgress || !build.CreatedAt.Before(before) {
+			continue
+		}
+		delete(b.storage, build.Id)
+		deleted++
+	}
+
+	return deleted, nil
+}
+
 func (b builds) GetAllByRepoId(repoId string) (builds []domain.Build, _ error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	for _, build := range b.storage {
 		if build.RepoId == repoId {
 			builds = append(builds, build)
@@ -39,10 +92,615 @@ func (b builds) GetAllByRepoId(repoId string) (builds []domain.Build, _ error) {
 	return builds, nil
 }
 
+// GetPage returns the builds matching the filter. The cursor is the id of the last build of the previous page.
+func (b builds) GetPage(filter domain.BuildsFilter) (page domain.BuildsPage, _ error) {
+	b.mu.RLock()
+	var matched []domain.Build
+	for _, build := range b.storage {
+		var (
+			commit = build.Commit
+			author = commit.Author
+		)
+		switch {
+		case build.RepoId != filter.RepoId,
+			filter.Status != nil && build.Status != *filter.Status,
+			filter.Branch != "" && commit.Branch != filter.Branch,
+			!strings.HasPrefix(commit.Hash, filter.Commit),
+			filter.Author != "" && (author == nil || author.Name != filter.Author && author.Email != filter.Author),
+			!filter.Since.IsZero() && build.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !build.CreatedAt.Before(filter.Until):
+			continue
+		}
+		matched = append(matched, build)
+	}
+	b.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if filter.Ascending {
+			return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+		}
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	page.Total = len(matched)
+	if filter.Cursor != "" {
+		var i = 0
+		for i < len(matched) && matched[i].Id != filter.Cursor {
+			i++
+		}
+		if i == len(matched) {
+			return domain.BuildsPage{}, domain.ErrInvalidCursor
+		}
+		matched = matched[i+1:]
+	}
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+		page.NextCursor = matched[len(matched)-1].Id
+	}
+	page.Builds = matched
+	return page, nil
+}
+
 func (b builds) GetById(id string) (domain.Build, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	build, ok := b.storage[id]
 	if !ok {
 		return domain.Build{}, domain.ErrNotFound
 	}
 	return build, nil
 }
+
+func (b builds) GetByNumber(repoId string, number int) (domain.Build, error) {
+	return b.latest(func(build domain.Build) bool {
+		return build.RepoId == repoId && build.Number == number
+	})
+}
+
+func (b builds) GetLatestByBranch(repoId, branch string) (domain.Build, error) {
+	return b.latest(func(build domain.Build) bool {
+		return build.RepoId == repoId && build.Commit.Branch == branch
+	})
+}
+
+func (b builds) GetLatestFinished(repoId, branch string) (domain.Build, error) {
+	return b.latest(func(build domain.Build) bool {
+		return build.RepoId == repoId && (branch == "" || build.Commit.Branch == branch) &&
+			build.Status != domain.InProgress && build.Commit.Tag == "" && build.Commit.PullRequest == nil
+	})
+}
+
+func (b builds) GetLatestByTag(repoId, tag string) (domain.Build, error) {
+	return b.latest(func(build domain.Build) bool {
+		return build.RepoId == repoId && build.Commit.Tag == tag
+	})
+}
+
+func (b builds) GetLatestByPullRequest(repoId string, number int) (domain.Build, error) {
+	return b.latest(func(build domain.Build) bool {
+		return build.RepoId == repoId && build.Commit.PullRequest != nil && build.Commit.PullRequest.Number == number
+	})
+}
+
+func (b builds) GetAllByPullRequest(repoId string, number int) (builds []domain.Build, _ error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, build := range b.storage {
+		if build.RepoId == repoId && build.Commit.PullRequest != nil && build.Commit.PullRequest.Number == number {
+			builds = append(builds, build)
+		}
+	}
+	return builds, nil
+}
+
+func (b builds) latest(match func(domain.Build) bool) (latest domain.Build, _ error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var found bool
+	for _, build := range b.storage {
+		if match(build) && (!found || build.CreatedAt.After(latest.CreatedAt)) {
+			latest, found = build, true
+		}
+	}
+	if !found {
+		return domain.Build{}, domain.ErrNotFound
+	}
+	return latest, nil
+}
+
+type notifications struct {
+	targets    map[string]domain.NotificationTarget
+	deliveries map[string]domain.Delivery
+	mu         *sync.RWMutex
+}
+
+func NewNotifications() *notifications {
+	return &notifications{
+		targets:    make(map[string]domain.NotificationTarget),
+		deliveries: make(map[string]domain.Delivery),
+		mu:         &sync.RWMutex{},
+	}
+}
+
+func (n notifications) CreateTarget(target domain.NotificationTarget) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.targets[target.Id] = target
+	return nil
+}
+
+func (n notifications) DeleteTarget(id string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.targets, id)
+	return nil
+}
+
+func (n notifications) GetTargetById(id string) (domain.NotificationTarget, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	target, ok := n.targets[id]
+	if !ok {
+		return domain.NotificationTarget{}, domain.ErrNotFound
+	}
+	return target, nil
+}
+
+func (n notifications) GetTargetsByRepoId(repoId string) (targets []domain.NotificationTarget, _ error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, target := range n.targets {
+		if target.RepoId == repoId {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+func (n notifications) CreateDelivery(delivery domain.Delivery) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries[delivery.Id] = delivery
+	return nil
+}
+
+func (n notifications) UpdateDelivery(delivery domain.Delivery) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries[delivery.Id] = delivery
+	return nil
+}
+
+func (n notifications) GetDueDeliveries(now time.Time) (deliveries []domain.Delivery, _ error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, delivery := range n.deliveries {
+		if delivery.Status == domain.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (n notifications) GetDeliveriesByTargetId(targetId string) (deliveries []domain.Delivery, _ error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, delivery := range n.deliveries {
+		if delivery.TargetId == targetId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+type schedules struct {
+	storage map[string]domain.Schedule
+	mu      *sync.RWMutex
+}
+
+func NewSchedules() *schedules {
+	return &schedules{
+		storage: make(map[string]domain.Schedule),
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (s schedules) Create(schedule domain.Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.storage[schedule.Id] = schedule
+	return nil
+}
+
+func (s schedules) Update(schedule domain.Schedule) error {
+	return s.Create(schedule)
+}
+
+func (s schedules) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.storage, id)
+	return nil
+}
+
+func (s schedules) GetAll() ([]domain.Schedule, error) {
+	return s.GetAllByRepoId("")
+}
+
+func (s schedules) GetAllByRepoId(repoId string) (schedules []domain.Schedule, _ error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, schedule := range s.storage {
+		if repoId == "" || schedule.RepoId == repoId {
+			schedules = append(schedules, schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Id < schedules[j].Id
+	})
+	return schedules, nil
+}
+
+func (s schedules) GetById(id string) (domain.Schedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schedule, ok := s.storage[id]
+	if !ok {
+		return domain.Schedule{}, domain.ErrNotFound
+	}
+	return schedule, nil
+}
+
+type watchers struct {
+	storage map[string][]domain.Watcher
+	mu      *sync.RWMutex
+}
+
+func NewWatchers() *watchers {
+	return &watchers{
+		storage: make(map[string][]domain.Watcher),
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (w watchers) Create(watcher domain.Watcher) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.storage[watcher.RepoId] = append(w.storage[watcher.RepoId], watcher)
+	return nil
+}
+
+func (w watchers) Delete(repoId, email string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var kept []domain.Watcher
+	for _, watcher := range w.storage[repoId] {
+		if watcher.Email != email {
+			kept = append(kept, watcher)
+		}
+	}
+	w.storage[repoId] = kept
+	return nil
+}
+
+func (w watchers) GetAllByRepoId(repoId string) ([]domain.Watcher, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.storage[repoId], nil
+}
+
+type tags struct {
+	storage map[string]domain.TagBaseline
+	mu      *sync.RWMutex
+}
+
+func NewTags() *tags {
+	return &tags{
+		storage: make(map[string]domain.TagBaseline),
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (t tags) GetBaseline(repoId string) (domain.TagBaseline, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	baseline, ok := t.storage[repoId]
+	if !ok {
+		return domain.TagBaseline{}, domain.ErrNotFound
+	}
+	return baseline, nil
+}
+
+func (t tags) SetBaseline(repoId string, baseline domain.TagBaseline) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	baseline.Tags = append([]string(nil), baseline.Tags...)
+	sort.Strings(baseline.Tags)
+	t.storage[repoId] = baseline
+	return nil
+}
+
+type repositories struct {
+	storage map[string]domain.Repository
+	mu      *sync.RWMutex
+}
+
+func NewRepositories() *repositories {
+	return &repositories{
+		storage: make(map[string]domain.Repository),
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (r repositories) Create(repo domain.Repository) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.storage[repo.Id] = repo
+	return nil
+}
+
+func (r repositories) Update(repo domain.Repository) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.storage[repo.Id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	repo.URL, repo.CreatedAt, repo.PollStatus = stored.URL, stored.CreatedAt, stored.PollStatus
+	r.storage[repo.Id] = repo
+	return nil
+}
+
+func (r repositories) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.storage, id)
+	return nil
+}
+
+func (r repositories) GetAll() ([]domain.Repository, error) {
+	return r.filter(func(domain.Repository) bool { return true }), nil
+}
+
+func (r repositories) GetById(id string) (domain.Repository, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	repo, ok := r.storage[id]
+	if !ok {
+		return domain.Repository{}, domain.ErrNotFound
+	}
+	return repo, nil
+}
+
+func (r repositories) GetByURL(url string) (domain.Repository, error) {
+	repos := r.filter(func(repo domain.Repository) bool { return repo.URL == url })
+	if len(repos) == 0 {
+		return domain.Repository{}, domain.ErrNotFound
+	}
+	return repos[0], nil
+}
+
+func (r repositories) GetUnhealthy() ([]domain.Repository, error) {
+	return r.filter(func(repo domain.Repository) bool { return !repo.PollStatus.Healthy() }), nil
+}
+
+func (r repositories) UpdatePollStatus(id string, polledAt time.Time, hash, pollErr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, ok := r.storage[id]
+	if !ok {
+		return nil
+	}
+	repo.PollStatus.LastPolledAt = &polledAt
+	repo.PollStatus.LastError = pollErr
+	if pollErr != "" {
+		repo.PollStatus.ConsecutiveFailures++
+	} else {
+		repo.PollStatus.ConsecutiveFailures = 0
+		repo.PollStatus.LastSeenHash = hash
+	}
+	r.storage[id] = repo
+	return nil
+}
+
+func (r repositories) filter(match func(domain.Repository) bool) (repos []domain.Repository) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, repo := range r.storage {
+		if match(repo) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+type artifacts struct {
+	storage map[string]map[string]domain.Artifact
+	mu      *sync.RWMutex
+}
+
+func NewArtifacts() *artifacts {
+	return &artifacts{
+		storage: make(map[string]map[string]domain.Artifact),
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (a artifacts) Save(artifact domain.Artifact) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.storage[artifact.BuildId] == nil {
+		a.storage[artifact.BuildId] = make(map[string]domain.Artifact)
+	}
+	a.storage[artifact.BuildId][artifact.Path] = artifact
+	return nil
+}
+
+func (a artifacts) GetAllByBuildId(buildId string) (artifacts []domain.Artifact, _ error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, artifact := range a.storage[buildId] {
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Path < artifacts[j].Path
+	})
+	return artifacts, nil
+}
+
+func (a artifacts) GetByPath(buildId, path string) (domain.Artifact, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	artifact, ok := a.storage[buildId][path]
+	if !ok {
+		return domain.Artifact{}, domain.ErrNotFound
+	}
+	return artifact, nil
+}
+
+func (a artifacts) Referenced(checksum string) (bool, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, build := range a.storage {
+		for _, artifact := range build {
+			if artifact.Checksum == checksum {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+type tests struct {
+	storage map[string]map[string][]domain.TestCase
+	// Flaky is returned by GetFlaky.
+	Flaky []domain.TestCase
+	mu    *sync.RWMutex
+}
+
+func NewTests() *tests {
+	return &tests{
+		storage: make(map[string]map[string][]domain.TestCase),
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (t *tests) Save(buildId, step string, attempt int, tests []domain.TestCase) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.storage[buildId] == nil {
+		t.storage[buildId] = make(map[string][]domain.TestCase)
+	}
+	var saved []domain.TestCase
+	for _, test := range t.storage[buildId][step] {
+		if test.Attempt != attempt {
+			saved = append(saved, test)
+		}
+	}
+	for _, test := range tests {
+		test.BuildId = buildId
+		test.Step = step
+		test.Attempt = attempt
+		saved = append(saved, test)
+	}
+	sort.SliceStable(saved, func(i, j int) bool { return saved[i].Attempt < saved[j].Attempt })
+	t.storage[buildId][step] = saved
+	return nil
+}
+
+func (t *tests) GetAllByBuildId(buildId string) (tests []domain.TestCase, _ error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var steps []string
+	for step := range t.storage[buildId] {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		tests = append(tests, t.storage[buildId][step]...)
+	}
+	return tests, nil
+}
+
+func (t *tests) GetFlaky(string, string, int) ([]domain.TestCase, error) {
+	return t.Flaky, nil
+}
+
+type coverage struct {
+	storage map[string]map[string][]domain.PackageCoverage
+	// Previous is returned by GetPrevious for the whole build, if set.
+	Previous *domain.Coverage
+	// PreviousSteps are returned by GetPrevious for the steps.
+	PreviousSteps map[string]domain.Coverage
+	mu            *sync.RWMutex
+}
+
+func NewCoverage() *coverage {
+	return &coverage{
+		storage: make(map[string]map[string][]domain.PackageCoverage),
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (c *coverage) Save(buildId, step string, packages []domain.PackageCoverage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.storage[buildId] == nil {
+		c.storage[buildId] = make(map[string][]domain.PackageCoverage)
+	}
+	c.storage[buildId][step] = append([]domain.PackageCoverage(nil), packages...)
+	return nil
+}
+
+func (c *coverage) GetByBuildId(buildId string) (domain.Coverage, error) {
+	return c.GetByStep(buildId, "")
+}
+
+func (c *coverage) GetByStep(buildId, step string) (domain.Coverage, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var sums = make(map[string]domain.PackageCoverage)
+	for name, packages := range c.storage[buildId] {
+		if step != "" && name != step {
+			continue
+		}
+		for _, pkg := range packages {
+			sum := sums[pkg.Name]
+			sum.Name = pkg.Name
+			if pkg.Covered > sum.Covered {
+				sum.Covered = pkg.Covered
+			}
+			if pkg.Total > sum.Total {
+				sum.Total = pkg.Total
+			}
+			sums[pkg.Name] = sum
+		}
+	}
+	if len(sums) == 0 {
+		return domain.Coverage{}, domain.ErrNotFound
+	}
+	var coverage = domain.Coverage{BuildId: buildId}
+	for _, pkg := range sums {
+		coverage.Packages = append(coverage.Packages, pkg)
+		coverage.Covered += pkg.Covered
+		coverage.Total += pkg.Total
+	}
+	sort.Slice(coverage.Packages, func(i, j int) bool {
+		return coverage.Packages[i].Name < coverage.Packages[j].Name
+	})
+	return coverage, nil
+}
+
+func (c *coverage) GetPrevious(_, _, step string, _ time.Time) (domain.Coverage, error) {
+	if step != "" {
+		previous, ok := c.PreviousSteps[step]
+		if !ok {
+			return domain.Coverage{}, domain.ErrNotFound
+		}
+		return previous, nil
+	}
+	if c.Previous == nil {
+		return domain.Coverage{}, domain.ErrNotFound
+	}
+	return *c.Previous, nil
+}
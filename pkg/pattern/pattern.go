@@ -0,0 +1,62 @@
+package pattern
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"path"
+)
+
+// List is a list of glob patterns, as accepted by path.Match.
+type List []string
+
+// Match reports whether the name matches any of the patterns.
+func (l List) Match(name string) bool {
+	for _, pattern := range l {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalYAML accepts either a single pattern or a list of patterns.
+func (l *List) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var pattern string
+
+	err := unmarshal(&pattern)
+	if err == nil {
+		*l = List{pattern}
+		return nil
+	}
+
+	return unmarshal((*[]string)(l))
+}
+
+func (l List) Value() (driver.Value, error) {
+	if l == nil {
+		l = List{}
+	}
+
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func (l *List) Scan(src any) error {
+	var data []byte
+
+	switch src := src.(type) {
+	case string:
+		data = []byte(src)
+	case []byte:
+		data = src
+	default:
+		return errors.New("incompatible source type")
+	}
+
+	return json.Unmarshal(data, (*[]string)(l))
+}
@@ -0,0 +1,45 @@
+package pattern
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestList_Match(t *testing.T) {
+	var list = List{"main", "release/*"}
+
+	assert.True(t, list.Match("main"))
+	assert.True(t, list.Match("release/1.0"))
+	assert.False(t, list.Match("release/1.0/hotfix"))
+	assert.False(t, list.Match("feature"))
+	assert.False(t, List{}.Match("main"))
+}
+
+func TestList_ValueScan(t *testing.T) {
+	var list = List{"main", "release/*"}
+
+	value, err := list.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `["main","release/*"]`, value)
+
+	var scanned List
+	err = scanned.Scan(value)
+	assert.NoError(t, err)
+	assert.Equal(t, list, scanned)
+
+	err = scanned.Scan(1)
+	assert.Error(t, err)
+}
+
+func TestList_UnmarshalYAML(t *testing.T) {
+	var list List
+
+	err := yaml.Unmarshal([]byte("main"), &list)
+	assert.NoError(t, err)
+	assert.Equal(t, List{"main"}, list)
+
+	err = yaml.Unmarshal([]byte("[main, release/*]"), &list)
+	assert.NoError(t, err)
+	assert.Equal(t, List{"main", "release/*"}, list)
+}
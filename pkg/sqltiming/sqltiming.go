@@ -0,0 +1,90 @@
+// Package sqltiming wraps a database/sql driver to time the executed queries.
+package sqltiming
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// ObserveFunc is called with the query text and its duration after every query or statement execution.
+type ObserveFunc func(query string, duration time.Duration)
+
+type connector struct {
+	driver  driver.Driver
+	dsn     string
+	observe ObserveFunc
+}
+
+// NewConnector returns a connector opening connections of the driver that report query timings to observe.
+// Use it with sql.OpenDB.
+func NewConnector(d driver.Driver, dsn string, observe ObserveFunc) driver.Connector {
+	return connector{driver: d, dsn: dsn, observe: observe}
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{Conn: conn, observe: c.observe}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// timedConn times ExecContext and QueryContext, other methods are passed through to the wrapped connection.
+type timedConn struct {
+	driver.Conn
+	observe ObserveFunc
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.observe(query, time.Since(start))
+	}
+	return result, err
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.observe(query, time.Since(start))
+	}
+	return rows, err
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
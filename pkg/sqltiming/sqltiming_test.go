@@ -0,0 +1,42 @@
+package sqltiming
+
+import (
+	"database/sql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewConnector(t *testing.T) {
+	var queries []string
+
+	db := sql.OpenDB(NewConnector(&sqlite3.SQLiteDriver{}, ":memory:", func(query string, d time.Duration) {
+		assert.Positive(t, d)
+		queries = append(queries, query)
+	}))
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	require.NoError(t, db.Ping())
+
+	_, err := db.Exec("CREATE TABLE t (id INTEGER)")
+	require.NoError(t, err)
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO t (id) VALUES ($1)", 1)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	var id int
+	require.NoError(t, db.QueryRow("SELECT id FROM t WHERE id = $1", 1).Scan(&id))
+	assert.Equal(t, 1, id)
+
+	assert.Equal(t, []string{
+		"CREATE TABLE t (id INTEGER)",
+		"INSERT INTO t (id) VALUES ($1)",
+		"SELECT id FROM t WHERE id = $1",
+	}, queries)
+}